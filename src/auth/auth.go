@@ -0,0 +1,33 @@
+// Package auth holds what RAIS needs to restrict access to images under the
+// IIIF Authorization Flow API 2.0: access decisions, a store for expiring
+// tokens, and a stand-in identity provider for testing without a real login
+// service.
+package auth
+
+import (
+	"rais/src/iiif"
+	"rais/src/img"
+)
+
+// Access describes how much of an image a user may see
+type Access int
+
+// Access levels, from most to least permissive
+const (
+	Full Access = iota
+	Degraded
+	Denied
+)
+
+// Decision is a policy's ruling on a single image for a single user
+type Decision struct {
+	Access Access
+
+	// Max limits the image size served when Access is Degraded.  Zero values
+	// impose no limit.
+	Max img.Constraint
+}
+
+// Policy returns the access decision for the given image and user.  user is
+// empty for anonymous requests.
+type Policy func(id iiif.ID, user string) Decision
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestTokens(t *testing.T) {
+	var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var current = start
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	var tokens = NewTokens(time.Minute)
+	var a = tokens.Issue("alice")
+	var b = tokens.Issue("bob")
+	assert.True(a != b, "tokens are unique", t)
+
+	var user, ok = tokens.User(a)
+	assert.True(ok, "alice's token is valid", t)
+	assert.Equal("alice", user, "alice's token user", t)
+
+	tokens.Revoke(b)
+	_, ok = tokens.User(b)
+	assert.False(ok, "revoked tokens are invalid", t)
+
+	current = start.Add(time.Minute)
+	_, ok = tokens.User(a)
+	assert.False(ok, "expired tokens are invalid", t)
+
+	tokens.Issue("carol")
+	assert.Equal(1, len(tokens.grants), "expired tokens are pruned on issue", t)
+}
+
+func TestParseLocalUsers(t *testing.T) {
+	var p, err = ParseLocalUsers("alice:secret, bob:pass:word,")
+	assert.NilError(err, "valid users parse", t)
+	assert.True(p.Authenticate("alice", "secret"), "alice can log in", t)
+	assert.True(p.Authenticate("bob", "pass:word"), "passwords may contain colons", t)
+	assert.False(p.Authenticate("alice", "secre"), "wrong password", t)
+	assert.False(p.Authenticate("carol", ""), "unknown user", t)
+
+	_, err = ParseLocalUsers("alice")
+	assert.True(err != nil, "users need a password", t)
+	_, err = ParseLocalUsers(":secret")
+	assert.True(err != nil, "users need a name", t)
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// LocalProvider is a stand-in identity provider for running the auth flow
+// offline, such as in development and tests.  Users and passwords are
+// configured directly and held in memory as plain text, so it should never
+// be the only thing protecting real restricted content.
+type LocalProvider struct {
+	users map[string]string
+}
+
+// ParseLocalUsers reads a comma-separated list of "user:password" pairs into
+// a LocalProvider
+func ParseLocalUsers(s string) (*LocalProvider, error) {
+	var p = &LocalProvider{users: make(map[string]string)}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		var user, pass, ok = strings.Cut(pair, ":")
+		if !ok || user == "" || pass == "" {
+			return nil, fmt.Errorf("invalid user %q: must be in the form user:password", pair)
+		}
+		p.users[user] = pass
+	}
+
+	return p, nil
+}
+
+// Authenticate returns true if user exists and pass is their password
+func (p *LocalProvider) Authenticate(user, pass string) bool {
+	var expected, ok = p.users[user]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) == 1
+}
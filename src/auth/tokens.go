@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// now is swapped out in tests to check expiration
+var now = time.Now
+
+type grant struct {
+	user    string
+	expires time.Time
+}
+
+// Tokens is a concurrency-safe, in-memory store of random tokens, each tied
+// to a user and expiring after a fixed lifetime.  It's used both for the
+// session cookies the access service sets and the tokens the token service
+// hands to clients.
+type Tokens struct {
+	TTL time.Duration
+
+	m      sync.Mutex
+	grants map[string]grant
+}
+
+// NewTokens returns a store whose tokens expire after ttl
+func NewTokens(ttl time.Duration) *Tokens {
+	return &Tokens{TTL: ttl, grants: make(map[string]grant)}
+}
+
+// RandomToken returns a new random, hex-encoded token
+func RandomToken() string {
+	var buf = make([]byte, 32)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Issue returns a new token for user.  Expired tokens are pruned here so the
+// store doesn't grow without bound.
+func (t *Tokens) Issue(user string) string {
+	var token = RandomToken()
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	var n = now()
+	for k, g := range t.grants {
+		if !n.Before(g.expires) {
+			delete(t.grants, k)
+		}
+	}
+	t.grants[token] = grant{user: user, expires: n.Add(t.TTL)}
+
+	return token
+}
+
+// User returns the user a token was issued to, and false if the token is
+// unknown or has expired
+func (t *Tokens) User(token string) (string, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	var g, ok = t.grants[token]
+	if !ok || !now().Before(g.expires) {
+		return "", false
+	}
+	return g.user, true
+}
+
+// Revoke removes a token from the store
+func (t *Tokens) Revoke(token string) {
+	t.m.Lock()
+	delete(t.grants, token)
+	t.m.Unlock()
+}
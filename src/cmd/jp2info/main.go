@@ -48,6 +48,13 @@ func printScanResults(i *jp2info.Info, err error) {
 }
 
 func printInfo(i *jp2info.Info) {
-	fmt.Printf("dim:%dx%d tiles:%dx%d levels:%d %d-bit %s\n",
-		i.Width, i.Height, i.TileWidth(), i.TileHeight(), i.Levels, i.BPC, i.ColorSpace.String())
+	fmt.Printf("%s dim:%dx%d tiles:%dx%d levels:%d %d-bit %s",
+		i.Format, i.Width, i.Height, i.TileWidth(), i.TileHeight(), i.Levels, i.MaxPrecision(), i.ColorSpace.String())
+	if x, y := i.DPI(); x > 0 && y > 0 {
+		fmt.Printf(" dpi:%.0fx%.0f", x, y)
+	}
+	if len(i.ICCProfile) > 0 {
+		fmt.Printf(" icc:%d bytes", len(i.ICCProfile))
+	}
+	fmt.Println()
 }
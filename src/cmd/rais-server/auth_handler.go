@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"rais/src/auth"
+	"rais/src/iiif"
+	"rais/src/img"
+	"strings"
+	"time"
+)
+
+// sessionCookie is the name of the cookie the access service sets once a
+// user has logged in
+const sessionCookie = "rais-session"
+
+// sessionTTL is how long a login lasts
+const sessionTTL = 12 * time.Hour
+
+// csrfCookie is the name of the cookie holding the login form's CSRF token,
+// which has to match the token submitted with the form
+const csrfCookie = "rais-login-csrf"
+
+// AuthHandler implements the IIIF Authorization Flow API 2.0 services: the
+// probe, access (login), token, and logout services.  It also decides what
+// each image request may see, adding the services to info responses for any
+// image that's restricted to anonymous users.
+type AuthHandler struct {
+	PathPrefix string
+	Policy     auth.Policy
+	Provider   *auth.LocalProvider
+
+	// AllowedOrigins lists the viewer origins (e.g., "https://viewer.example.com")
+	// the token service will send access tokens to.  Any other origin gets an
+	// invalidOrigin error, so other sites can't read a logged-in user's token.
+	AllowedOrigins []string
+
+	sessions *auth.Tokens
+	tokens   *auth.Tokens
+}
+
+// NewAuthHandler returns an AuthHandler serving under pathPrefix.  Tokens
+// handed to clients expire after tokenTTL.
+func NewAuthHandler(pathPrefix string, policy auth.Policy, provider *auth.LocalProvider, tokenTTL time.Duration) *AuthHandler {
+	return &AuthHandler{
+		PathPrefix: pathPrefix,
+		Policy:     policy,
+		Provider:   provider,
+		sessions:   auth.NewTokens(sessionTTL),
+		tokens:     auth.NewTokens(tokenTTL),
+	}
+}
+
+// ServeHTTP routes requests to the individual auth services
+func (a *AuthHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var p = strings.TrimPrefix(req.URL.Path, a.PathPrefix)
+	switch {
+	case strings.HasPrefix(p, "/probe/"):
+		a.probe(w, req, iiif.URLToID(strings.TrimPrefix(p, "/probe/")))
+	case p == "/login":
+		a.login(w, req)
+	case p == "/token":
+		a.token(w, req)
+	case p == "/logout":
+		a.logout(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// sessionUser returns the user logged in via the session cookie, if any
+func (a *AuthHandler) sessionUser(req *http.Request) string {
+	var c, err = req.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	var user, _ = a.sessions.User(c.Value)
+	return user
+}
+
+// tokenUser returns the user the request's bearer token was issued to, if any
+func (a *AuthHandler) tokenUser(req *http.Request) string {
+	var token, ok = strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	var user, _ = a.tokens.User(token)
+	return user
+}
+
+// services returns the service description for the image with the given ID,
+// with URLs built from base
+func (a *AuthHandler) services(base *url.URL, id iiif.ID) []iiif.AuthService {
+	var prefix = (&url.URL{Scheme: base.Scheme, Host: base.Host, Path: a.PathPrefix}).String()
+	return []iiif.AuthService{{
+		ID:   prefix + "/probe/" + id.Escaped(),
+		Type: iiif.AuthProbeService2,
+		Service: []iiif.AuthService{{
+			ID:      prefix + "/login",
+			Type:    iiif.AuthAccessService2,
+			Profile: "active",
+			Label:   iiif.LanguageMap{"en": {"Log in to view this image"}},
+			Heading: iiif.LanguageMap{"en": {"This image is restricted"}},
+			Service: []iiif.AuthService{
+				{ID: prefix + "/token", Type: iiif.AuthAccessTokenService2},
+				{ID: prefix + "/logout", Type: iiif.AuthLogoutService2, Label: iiif.LanguageMap{"en": {"Log out"}}},
+			},
+		}},
+	}}
+}
+
+// probe tells clients whether the user holding the request's token can see
+// the given image
+func (a *AuthHandler) probe(w http.ResponseWriter, req *http.Request, id iiif.ID) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if req.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		return
+	}
+
+	var result = iiif.NewAuthProbeResult(http.StatusOK)
+	switch a.Policy(id, a.tokenUser(req)).Access {
+	case auth.Degraded:
+		result.Status = http.StatusUnauthorized
+		result.Heading = iiif.LanguageMap{"en": {"This image is restricted"}}
+		result.Note = iiif.LanguageMap{"en": {"Only a reduced-size version is available"}}
+	case auth.Denied:
+		result.Status = http.StatusUnauthorized
+		result.Heading = iiif.LanguageMap{"en": {"This image is restricted"}}
+		result.Note = iiif.LanguageMap{"en": {"You must log in to view this image"}}
+	}
+
+	var data, err = json.Marshal(result)
+	if err != nil {
+		Logger.Errorf("Unable to marshal probe result: %s", err)
+		http.Error(w, "server error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><title>Log in</title></head><body>
+{{if .Done}}<p>You are logged in.</p><script>window.close();</script>
+{{else}}{{if .Failed}}<p>Invalid username or password.</p>{{end}}
+<form method="post">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<label>Username <input name="username" autofocus></label>
+<label>Password <input name="password" type="password"></label>
+<button type="submit">Log in</button>
+</form>{{end}}
+</body></html>
+`))
+
+// login is the access service: it's opened by the client in a new window,
+// where the user logs in against the local identity provider.  Success sets
+// the session cookie and closes the window.
+//
+// Each form gets a CSRF token, sent both as a cookie and a hidden field; a
+// post is only accepted if the two match, so other sites can't submit the
+// form on a user's behalf.
+func (a *AuthHandler) login(w http.ResponseWriter, req *http.Request) {
+	var data struct {
+		Done, Failed bool
+		CSRF         string
+	}
+	if req.Method == http.MethodPost {
+		if !a.validCSRF(req) {
+			http.Error(w, "Invalid or missing form token", http.StatusForbidden)
+			return
+		}
+		var user = req.PostFormValue("username")
+		if a.Provider != nil && a.Provider.Authenticate(user, req.PostFormValue("password")) {
+			http.SetCookie(w, a.cookie(req, a.sessions.Issue(user), 0))
+			http.SetCookie(w, a.csrfCookie(req, "", -1))
+			data.Done = true
+		} else {
+			data.Failed = true
+		}
+	}
+
+	if !data.Done {
+		data.CSRF = auth.RandomToken()
+		http.SetCookie(w, a.csrfCookie(req, data.CSRF, 0))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if data.Failed {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	loginTemplate.Execute(w, data)
+}
+
+// validCSRF returns true if the posted form's CSRF token matches the cookie
+func (a *AuthHandler) validCSRF(req *http.Request) bool {
+	var c, err = req.Cookie(csrfCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(req.PostFormValue("csrf"))) == 1
+}
+
+// csrfCookie returns the login form's CSRF cookie.  The form is only ever
+// posted from the login page itself, so the cookie is never sent cross-site.
+func (a *AuthHandler) csrfCookie(req *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     csrfCookie,
+		Value:    value,
+		Path:     a.PathPrefix + "/login",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   getRequestURL(req).Scheme == "https",
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+var tokenTemplate = template.Must(template.New("token").Parse(`<!DOCTYPE html>
+<html><body><script>window.parent.postMessage({{.Message}}, {{.Origin}});</script></body></html>
+`))
+
+// token is the token service: the client loads it in an iframe, and it posts
+// an access token (or an error) back to the client's origin, based on the
+// session cookie the access service set.  Only allowed origins get tokens.
+func (a *AuthHandler) token(w http.ResponseWriter, req *http.Request) {
+	var q = req.URL.Query()
+	var messageID, origin = q.Get("messageId"), q.Get("origin")
+	if messageID == "" || origin == "" {
+		http.Error(w, "messageId and origin are required", 400)
+		return
+	}
+
+	var msg any = iiif.NewAuthAccessTokenError(iiif.TokenErrMissingAspect, messageID)
+	var c, err = req.Cookie(sessionCookie)
+	if !a.allowedOrigin(origin) {
+		msg = iiif.NewAuthAccessTokenError(iiif.TokenErrInvalidOrigin, messageID)
+	} else if err == nil {
+		var user, ok = a.sessions.User(c.Value)
+		if ok {
+			msg = iiif.NewAuthAccessToken(a.tokens.Issue(user), int(a.tokens.TTL.Seconds()), messageID)
+		} else {
+			msg = iiif.NewAuthAccessTokenError(iiif.TokenErrExpiredAspect, messageID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tokenTemplate.Execute(w, struct {
+		Message any
+		Origin  string
+	}{msg, origin})
+}
+
+// allowedOrigin returns true if origin is one of the handler's allowed
+// origins.  Origins are compared by scheme and host, ignoring case.
+func (a *AuthHandler) allowedOrigin(origin string) bool {
+	var o = normalizeOrigin(origin)
+	if o == "" {
+		return false
+	}
+	for _, allowed := range a.AllowedOrigins {
+		if normalizeOrigin(allowed) == o {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOrigin returns the lowercased "scheme://host[:port]" form of an
+// origin, or "" if it isn't a valid origin
+func normalizeOrigin(origin string) string {
+	var u, err = url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// logout ends the user's session
+func (a *AuthHandler) logout(w http.ResponseWriter, req *http.Request) {
+	var c, err = req.Cookie(sessionCookie)
+	if err == nil {
+		a.sessions.Revoke(c.Value)
+	}
+	http.SetCookie(w, a.cookie(req, "", -1))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte("<!DOCTYPE html>\n<html><body><p>You are logged out.</p></body></html>\n"))
+}
+
+// cookie returns the session cookie.  It has to be sent with requests from
+// viewers on other sites, so it's SameSite=None when the request is secure.
+func (a *AuthHandler) cookie(req *http.Request, value string, maxAge int) *http.Cookie {
+	var c = &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if getRequestURL(req).Scheme == "https" {
+		c.Secure = true
+		c.SameSite = http.SameSiteNoneMode
+	}
+	return c
+}
+
+// authorize returns what the request may see of the given image.  Images
+// anonymous users can't fully see get the auth services added to their info,
+// and degraded access lowers the info's maximums, which in turn limits the
+// sizes Command will serve.
+func (ih *ImageHandler) authorize(req *http.Request, base *url.URL, id iiif.ID, info *iiif.Info) auth.Access {
+	if ih.Auth == nil {
+		return auth.Full
+	}
+
+	var d = ih.Auth.Policy(id, "")
+	if d.Access == auth.Full {
+		return auth.Full
+	}
+	info.Service = ih.Auth.services(base, id)
+
+	var user = ih.Auth.sessionUser(req)
+	if user != "" {
+		d = ih.Auth.Policy(id, user)
+	}
+	if d.Access == auth.Degraded {
+		ih.degrade(info, d.Max)
+	}
+
+	return d.Access
+}
+
+// degrade lowers info's maximums to fit within max, and drops any listed
+// sizes which no longer fit.  All three maximums are set explicitly, so the
+// result means the same thing to 2.x and 3.0 requests.
+func (ih *ImageHandler) degrade(info *iiif.Info, max img.Constraint) {
+	var cur = ih.maximums(info, iiif.Version2)
+	if max.Width > 0 {
+		cur.Width = min(cur.Width, max.Width)
+	}
+	if max.Height > 0 {
+		cur.Height = min(cur.Height, max.Height)
+	}
+	if max.Area > 0 {
+		cur.Area = min(cur.Area, max.Area)
+	}
+
+	var sizes []iiif.ListedSize
+	for _, s := range info.Sizes {
+		if !cur.SmallerThanAny(s.Width, s.Height) {
+			sizes = append(sizes, s)
+		}
+	}
+	info.Sizes = sizes
+
+	info.Profile.MaxWidth = cur.Width
+	info.Profile.MaxHeight = cur.Height
+	info.Profile.MaxArea = cur.Area
+}
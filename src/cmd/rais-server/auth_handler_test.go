@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"rais/src/auth"
+	"rais/src/fakehttp"
+	"rais/src/iiif"
+	"rais/src/img"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+var testWorldID = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2"
+
+// testPolicy hides the test image from anonymous users if access is Denied,
+// shrinks it to 300px wide if Degraded, and lets alice see everything
+func testPolicy(access auth.Access) auth.Policy {
+	return func(id iiif.ID, user string) auth.Decision {
+		if user == "alice" {
+			return auth.Decision{Access: auth.Full}
+		}
+		return auth.Decision{Access: access, Max: img.Constraint{Width: 300}}
+	}
+}
+
+func newTestAuthHandler(access auth.Access) *AuthHandler {
+	var p, _ = auth.ParseLocalUsers("alice:secret")
+	var a = NewAuthHandler("/foo/auth", testPolicy(access), p, time.Hour)
+	a.AllowedOrigins = []string{"http://viewer.example.com"}
+	return a
+}
+
+func doauthrequest(a *AuthHandler, method, path string, body string, cookie *http.Cookie, t *testing.T) *fakehttp.ResponseWriter {
+	u, _ := url.Parse("http://example.com")
+	w := fakehttp.NewResponseWriter()
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Errorf("Unable to create fake request: %s", err)
+	}
+	req.RequestURI = path
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	if strings.HasPrefix(path, a.PathPrefix) {
+		a.ServeHTTP(w, req)
+		return w
+	}
+
+	h := NewImageHandler(rootDir(), "/foo/bar")
+	h.BaseURL = u
+	h.Auth = a
+	h.IIIFRoute(w, req)
+	return w
+}
+
+func cookieFrom(w *fakehttp.ResponseWriter, name string) *http.Cookie {
+	var resp = http.Response{Header: w.Headers}
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func sessionFrom(w *fakehttp.ResponseWriter) *http.Cookie {
+	return cookieFrom(w, sessionCookie)
+}
+
+// login loads the login form, then posts it with the form's CSRF token and
+// the given credentials
+func login(a *AuthHandler, user, pass string, t *testing.T) *fakehttp.ResponseWriter {
+	var w = doauthrequest(a, "GET", "/foo/auth/login", "", nil, t)
+	var csrf = cookieFrom(w, csrfCookie)
+	assert.True(csrf != nil, "login form sets the CSRF cookie", t)
+	assert.True(strings.Contains(string(w.Output), `value="`+csrf.Value+`"`), "login form has the CSRF token", t)
+
+	var body = url.Values{"username": {user}, "password": {pass}, "csrf": {csrf.Value}}
+	return doauthrequest(a, "POST", "/foo/auth/login", body.Encode(), csrf, t)
+}
+
+func TestAuthInfoDegraded(t *testing.T) {
+	var a = newTestAuthHandler(auth.Degraded)
+	w := doauthrequest(a, "GET", "/foo/bar/"+testWorldID+"/info.json", "", nil, t)
+	var data iiif.Info
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	assert.Equal(300, data.Profile.MaxWidth, "degraded info has a lower maxWidth", t)
+	for _, s := range data.Sizes {
+		assert.True(s.Width <= 300, "listed sizes fit the degraded maximums", t)
+	}
+
+	assert.Equal(1, len(data.Service), "one probe service", t)
+	var probe = data.Service[0]
+	assert.Equal(iiif.AuthProbeService2, probe.Type, "probe type", t)
+	assert.Equal("http://example.com/foo/auth/probe/"+testWorldID, probe.ID, "probe id", t)
+	var access = probe.Service[0]
+	assert.Equal(iiif.AuthAccessService2, access.Type, "access type", t)
+	assert.Equal("active", access.Profile, "access profile", t)
+	assert.Equal("http://example.com/foo/auth/token", access.Service[0].ID, "token service id", t)
+	assert.Equal("http://example.com/foo/auth/logout", access.Service[1].ID, "logout service id", t)
+}
+
+func TestAuthUnrestricted(t *testing.T) {
+	var a = newTestAuthHandler(auth.Full)
+	w := doauthrequest(a, "GET", "/foo/bar/"+testWorldID+"/info.json", "", nil, t)
+	var data iiif.Info
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	assert.Equal(0, len(data.Service), "unrestricted images have no auth services", t)
+	assert.Equal(0, data.Profile.MaxWidth, "unrestricted images aren't degraded", t)
+}
+
+func TestAuthDenied(t *testing.T) {
+	var a = newTestAuthHandler(auth.Denied)
+	w := doauthrequest(a, "GET", "/foo/bar/"+testWorldID+"/info.json", "", nil, t)
+	assert.Equal(-1, w.StatusCode, "info requests are still allowed", t)
+	var data iiif.Info
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	assert.Equal(1, len(data.Service), "denied images list the auth services", t)
+
+	w = doauthrequest(a, "GET", "/foo/bar/"+testWorldID+"/full/full/0/default.jpg", "", nil, t)
+	assert.Equal(401, w.StatusCode, "image requests are unauthorized", t)
+
+	w = doauthrequest(a, "GET", "/foo/auth/probe/"+testWorldID, "", nil, t)
+	var probe iiif.AuthProbeResult
+	assert.NilError(json.Unmarshal(w.Output, &probe), "unmarshal doesn't throw an error", t)
+	assert.Equal(401, probe.Status, "anonymous probe is unauthorized", t)
+}
+
+func TestAuthDegradedTileCache(t *testing.T) {
+	tileCache, _ = lru.New2Q(10)
+	defer func() { tileCache = nil }()
+
+	// Stand in for a tile alice's request cached earlier, so the test doesn't
+	// depend on a real JP2 decode
+	var path = "/foo/bar/" + testWorldID + "/full/400,/0/default.jpg"
+	var tile = []byte("full-size tile")
+	tileCache.Add(testWorldID+"/full/400,/0/default.jpg", tile)
+
+	var a = newTestAuthHandler(auth.Degraded)
+	w := login(a, "alice", "secret", t)
+	w = doauthrequest(a, "GET", path, "", sessionFrom(w), t)
+	assert.Equal(-1, w.StatusCode, "full access is served from the cache", t)
+	assert.Equal(string(tile), string(w.Output), "full access gets the cached tile", t)
+
+	w = doauthrequest(a, "GET", path, "", nil, t)
+	assert.Equal(501, w.StatusCode, "degraded access can't exceed its maximums", t)
+	assert.False(strings.Contains(string(w.Output), string(tile)), "degraded access doesn't get the cached tile", t)
+}
+
+func TestAuthFlow(t *testing.T) {
+	var a = newTestAuthHandler(auth.Denied)
+
+	w := login(a, "alice", "wrong", t)
+	assert.Equal(401, w.StatusCode, "bad password", t)
+	assert.True(sessionFrom(w) == nil, "no session for a bad password", t)
+
+	w = doauthrequest(a, "POST", "/foo/auth/login", "username=alice&password=secret", nil, t)
+	assert.Equal(403, w.StatusCode, "no login without the CSRF token", t)
+	assert.True(sessionFrom(w) == nil, "no session without the CSRF token", t)
+
+	var forged = &http.Cookie{Name: csrfCookie, Value: "abc"}
+	w = doauthrequest(a, "POST", "/foo/auth/login", "username=alice&password=secret&csrf=def", forged, t)
+	assert.Equal(403, w.StatusCode, "no login with a mismatched CSRF token", t)
+
+	w = login(a, "alice", "secret", t)
+	var session = sessionFrom(w)
+	assert.True(session != nil, "login sets the session cookie", t)
+
+	w = doauthrequest(a, "GET", "/foo/bar/"+testWorldID+"/info.json", "", session, t)
+	var data iiif.Info
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	assert.Equal(1, len(data.Service), "services are still listed for logged-in users", t)
+
+	w = doauthrequest(a, "GET", "/foo/auth/token?messageId=1&origin=http://viewer.example.com", "", nil, t)
+	assert.True(strings.Contains(string(w.Output), iiif.TokenErrMissingAspect), "no token without a session", t)
+
+	w = doauthrequest(a, "GET", "/foo/auth/token?messageId=1&origin=http://viewer.example.com", "", session, t)
+	var out = string(w.Output)
+	assert.True(strings.Contains(out, "AuthAccessToken2"), "token is issued with a session", t)
+	assert.True(strings.Contains(out, `"http://viewer.example.com"`), "token is posted to the origin", t)
+
+	w = doauthrequest(a, "GET", "/foo/auth/token?messageId=1&origin=http://evil.example.com", "", session, t)
+	assert.True(strings.Contains(string(w.Output), iiif.TokenErrInvalidOrigin), "no token for other origins", t)
+	assert.False(strings.Contains(string(w.Output), "AuthAccessToken2"), "other origins only get an error", t)
+
+	var m = regexp.MustCompile(`"accessToken":"([0-9a-f]+)"`).FindStringSubmatch(out)
+	assert.Equal(2, len(m), "the access token is in the message", t)
+	var token = m[1]
+
+	var req, _ = http.NewRequest("GET", "/foo/auth/probe/"+testWorldID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = fakehttp.NewResponseWriter()
+	a.ServeHTTP(w, req)
+	var probe iiif.AuthProbeResult
+	assert.NilError(json.Unmarshal(w.Output, &probe), "unmarshal doesn't throw an error", t)
+	assert.Equal(200, probe.Status, "probe with a valid token succeeds", t)
+
+	doauthrequest(a, "GET", "/foo/auth/logout", "", session, t)
+	assert.Equal("", a.sessionUser(&http.Request{Header: http.Header{"Cookie": {session.String()}}}), "logout ends the session", t)
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	var a = newTestAuthHandler(auth.Full)
+	assert.True(a.allowedOrigin("http://viewer.example.com"), "exact match", t)
+	assert.True(a.allowedOrigin("HTTP://Viewer.Example.com/"), "case and a trailing slash are ignored", t)
+	assert.False(a.allowedOrigin("https://viewer.example.com"), "scheme must match", t)
+	assert.False(a.allowedOrigin("http://viewer.example.com:8080"), "port must match", t)
+	assert.False(a.allowedOrigin("http://viewer.example.com.evil.com"), "host must match exactly", t)
+	assert.False(a.allowedOrigin("*"), "wildcards aren't origins", t)
+
+	var _, err = parseAllowedOrigins("https://a.example.com, http://localhost:8080")
+	assert.NilError(err, "valid origins", t)
+	_, err = parseAllowedOrigins("https://a.example.com/viewer")
+	assert.True(err != nil, "origins can't have paths", t)
+}
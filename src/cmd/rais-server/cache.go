@@ -11,6 +11,7 @@
 )
 
 var infoCache *lru.Cache
+var rightsCache *lru.Cache
 var tileCache *lru.TwoQueueCache
 
 // setupCaches looks for config for caching and sets up the tile/info caches
@@ -28,6 +29,15 @@ func setupCaches() {
 		stats.InfoCache.Enabled = true
 		purgeCachePlugins = append(purgeCachePlugins, infoCache.Purge)
 		expireCachedImagePlugins = append(expireCachedImagePlugins, func(id iiif.ID) { infoCache.Remove(id) })
+
+		// Rights data is cached alongside info data, but in its own cache so
+		// the two don't compete for space
+		rightsCache, err = lru.New(icl)
+		if err != nil {
+			Logger.Fatalf("Unable to start rights cache: %s", err)
+		}
+		purgeCachePlugins = append(purgeCachePlugins, rightsCache.Purge)
+		expireCachedImagePlugins = append(expireCachedImagePlugins, func(id iiif.ID) { rightsCache.Remove(id) })
 	}
 
 	tcl := viper.GetInt("TileCacheLen")
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"rais/src/iiif"
+	"rais/src/img"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// serverFeatures returns everything this RAIS build can actually do: all of
+// iiif.AllFeatures plus GIF output (which works, but is too slow to advertise
+// by default), minus any output format which fails to encode a tiny test
+// image or has no known mime type.
+func serverFeatures() *iiif.FeatureSet {
+	var fs = iiif.AllFeatures()
+	fs.Gif = true
+
+	var m = image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for _, f := range []struct {
+		format  iiif.Format
+		enabled *bool
+	}{
+		{iiif.FmtJPG, &fs.Jpg},
+		{iiif.FmtPNG, &fs.Png},
+		{iiif.FmtGIF, &fs.Gif},
+		{iiif.FmtTIF, &fs.Tif},
+		{iiif.FmtJP2, &fs.Jp2},
+		{iiif.FmtPDF, &fs.Pdf},
+		{iiif.FmtWEBP, &fs.Webp},
+	} {
+		if mime.TypeByExtension("."+string(f.format)) == "" {
+			Logger.Warnf("%s output is unavailable: unknown mime type", f.format)
+			*f.enabled = false
+			continue
+		}
+		var err = EncodeImage(io.Discard, m, f.format, img.Resolution{}, nil)
+		if err != nil {
+			Logger.Warnf("%s output is unavailable: %s", f.format, err)
+			*f.enabled = false
+		}
+	}
+
+	return fs
+}
+
+// loadCapabilities reads a capabilities file into a FeatureSet.  Keys which
+// don't match any feature are returned so they can be reported, since
+// they're almost certainly typos.
+func loadCapabilities(capfile string) (fs *iiif.FeatureSet, unknown []string, err error) {
+	fs = &iiif.FeatureSet{}
+	var md toml.MetaData
+	md, err = toml.DecodeFile(capfile, fs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, key := range md.Undecoded() {
+		unknown = append(unknown, key.String())
+	}
+	return fs, unknown, nil
+}
+
+// validateFeatures cross-checks a configured FeatureSet against what the
+// server can do.  Errors are claims the server can't honor, which would
+// result in failed requests for anything relying on them.  Warnings are
+// settings which are legal but are likely mistakes.
+func validateFeatures(fs, server *iiif.FeatureSet) (errs, warnings []string) {
+	var _, impossible, _ = iiif.FeatureCompare(fs, server)
+	for _, name := range sortedFeatures(impossible) {
+		errs = append(errs, fmt.Sprintf("%q is enabled, but this server can't support it", name))
+	}
+
+	for _, ts := range fs.TileSizes {
+		if ts.Width < 1 || ts.Height < 0 || len(ts.ScaleFactors) == 0 {
+			errs = append(errs, fmt.Sprintf("invalid tile size %dx%d with scale factors %v", ts.Width, ts.Height, ts.ScaleFactors))
+			continue
+		}
+		for _, sf := range ts.ScaleFactors {
+			if sf < 1 {
+				errs = append(errs, fmt.Sprintf("invalid scale factor %d for tile size %dx%d", sf, ts.Width, ts.Height))
+			}
+		}
+	}
+
+	if !fs.Default {
+		warnings = append(warnings, `"default" quality is disabled, but every IIIF compliance level requires it`)
+	}
+	if !fs.Jpg {
+		warnings = append(warnings, `"jpg" format is disabled, but every IIIF compliance level requires it`)
+	}
+	if fs.SizeAboveFull && !(fs.SizeByW || fs.SizeByH || fs.SizeByPct || fs.SizeByWh || fs.SizeByForcedWh) {
+		warnings = append(warnings, `"sizeAboveFull" is enabled, but no size features are, so it has no effect`)
+	}
+
+	return errs, warnings
+}
+
+// sortedFeatures returns the names in a FeaturesMap in a stable order for
+// reporting
+func sortedFeatures(m iiif.FeaturesMap) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// featureReport describes the server's effective features for the admin
+// server
+type featureReport struct {
+	Features *iiif.FeatureSet
+	Profile  string
+	Profile3 string
+	Maximums img.Constraint
+	Schemes  map[string]*featureReport `json:",omitempty"`
+	Warnings []string                  `json:",omitempty"`
+}
+
+func newFeatureReport(fs *iiif.FeatureSet, max img.Constraint) *featureReport {
+	return &featureReport{
+		Features: fs,
+		Profile:  fs.ProfileURI(iiif.Version2),
+		Profile3: fs.ProfileURI(iiif.Version3),
+		Maximums: max,
+	}
+}
+
+// adminFeatures returns a handler reporting the features and size limits the
+// image handler is using, globally and for any scheme with its own settings
+func adminFeatures(ih *ImageHandler, warnings []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		var report = newFeatureReport(ih.FeatureSet, ih.Maximums)
+		report.Warnings = warnings
+		var addScheme = func(scheme string) {
+			if report.Schemes == nil {
+				report.Schemes = make(map[string]*featureReport)
+			}
+			var id = iiif.ID(scheme + "://")
+			report.Schemes[scheme] = newFeatureReport(ih.features(id), ih.limits(id))
+		}
+		for scheme := range ih.SchemeFeatures {
+			addScheme(scheme)
+		}
+		for scheme := range ih.SchemeMaximums {
+			addScheme(scheme)
+		}
+
+		var data, err = json.Marshal(report)
+		if err != nil {
+			http.Error(w, "error generating json: "+err.Error(), 500)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
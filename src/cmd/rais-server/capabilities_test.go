@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"rais/src/fakehttp"
+	"rais/src/iiif"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestServerFeatures(t *testing.T) {
+	var fs = serverFeatures()
+	assert.True(fs.Jpg && fs.Png && fs.Tif && fs.Pdf, "pure-Go formats are always available", t)
+	assert.True(fs.Gif, "GIF output is possible, even though it's not advertised by default", t)
+	assert.True(fs.RotationArbitrary, "non-format features come from AllFeatures", t)
+}
+
+func TestLoadCapabilities(t *testing.T) {
+	var fname = filepath.Join(t.TempDir(), "caps.toml")
+	var caps = "Default = true\nJpg = true\nWebpp = true\n\n[[TileSizes]]\nWidth = 512\nScaleFactors = [1, 2]\n"
+	assert.NilError(os.WriteFile(fname, []byte(caps), 0644), "writing the capabilities file", t)
+
+	var fs, unknown, err = loadCapabilities(fname)
+	assert.NilError(err, "valid TOML loads", t)
+	assert.True(fs.Jpg, "known keys are read", t)
+	assert.Equal(512, fs.TileSizes[0].Width, "tile sizes are read", t)
+	if diff := cmp.Diff([]string{"Webpp"}, unknown); diff != "" {
+		t.Errorf("unknown keys: %s", diff)
+	}
+}
+
+func TestValidateFeatures(t *testing.T) {
+	var server = iiif.AllFeatures()
+	server.Webp = false
+
+	var errs, warnings = validateFeatures(iiif.FeatureSet2(), server)
+	assert.Equal(0, len(errs), "level 2 has no errors", t)
+	assert.Equal(0, len(warnings), "level 2 has no warnings", t)
+
+	var fs = &iiif.FeatureSet{Webp: true, Gif: true, SizeAboveFull: true}
+	fs.TileSizes = []iiif.TileSize{{Width: 0, ScaleFactors: []int{1}}, {Width: 256, ScaleFactors: []int{1, 0}}}
+	errs, warnings = validateFeatures(fs, server)
+	var wantErrs = []string{
+		`"gif" is enabled, but this server can't support it`,
+		`"webp" is enabled, but this server can't support it`,
+		"invalid tile size 0x0 with scale factors [1]",
+		"invalid scale factor 0 for tile size 256x0",
+	}
+	if diff := cmp.Diff(wantErrs, errs); diff != "" {
+		t.Errorf("errors: %s", diff)
+	}
+	assert.Equal(3, len(warnings), "default, jpg, and sizeAboveFull warnings", t)
+}
+
+func TestAdminFeatures(t *testing.T) {
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	h.FeatureSet = iiif.FeatureSet1()
+	var w = fakehttp.NewResponseWriter()
+	var req, _ = http.NewRequest("GET", "/admin/features.json", nil)
+	adminFeatures(h, []string{"a warning"}).ServeHTTP(w, req)
+
+	var report featureReport
+	assert.NilError(json.Unmarshal(w.Output, &report), "unmarshal doesn't throw an error", t)
+	assert.Equal(iiif.ProfileLevel1URI, report.Profile, "2.x profile", t)
+	assert.True(report.Features.SizeByW, "features are reported", t)
+	assert.Equal("a warning", report.Warnings[0], "warnings are reported", t)
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
+	"image/color"
 	"math"
 	"net/url"
 	"os"
+	"rais/src/goimage"
+	"rais/src/img"
+	"rais/src/transform"
+	"runtime"
+	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -20,6 +27,18 @@ func parseConf() {
 	var defaultLogLevel = logger.Debug.String()
 	var defaultPlugins = "-"
 	var defaultJPGQuality = 75
+	var defaultWebPQuality = 75
+	var defaultRotationFill = "#ffffff"
+	var defaultScaleFilter = "bilinear"
+	var defaultTransformWorkers = runtime.NumCPU()
+	var defaultDecodeThreads = min(4, runtime.NumCPU())
+	var defaultMaxDecodeThreads = runtime.NumCPU()
+	var defaultBitonalMode = "otsu"
+	var defaultColorManagement = "convert"
+	var defaultJP2TileSize = 512
+	var defaultJP2Levels = 5
+	var defaultJP2CompressionRatio = 20.0
+	var defaultAuthTokenSeconds = 3600
 
 	// Defaults
 	viper.SetDefault("Address", defaultAddress)
@@ -28,6 +47,22 @@ func parseConf() {
 	viper.SetDefault("LogLevel", defaultLogLevel)
 	viper.SetDefault("Plugins", defaultPlugins)
 	viper.SetDefault("JPGQuality", defaultJPGQuality)
+	viper.SetDefault("WebPQuality", defaultWebPQuality)
+	viper.SetDefault("RotationFill", defaultRotationFill)
+	viper.SetDefault("ScaleFilter", defaultScaleFilter)
+	viper.SetDefault("TransformWorkers", defaultTransformWorkers)
+	viper.SetDefault("DecodeThreads", defaultDecodeThreads)
+	viper.SetDefault("MaxDecodeThreads", defaultMaxDecodeThreads)
+	viper.SetDefault("MaxSourcePixels", goimage.DefaultMaxPixels)
+	viper.SetDefault("BitonalMode", defaultBitonalMode)
+	viper.SetDefault("BitonalThreshold", img.DefaultBitonalThreshold)
+	viper.SetDefault("BitonalWindow", img.DefaultBitonalWindow)
+	viper.SetDefault("BitonalK", img.DefaultBitonalK)
+	viper.SetDefault("ColorManagement", defaultColorManagement)
+	viper.SetDefault("JP2TileSize", defaultJP2TileSize)
+	viper.SetDefault("JP2Levels", defaultJP2Levels)
+	viper.SetDefault("JP2CompressionRatio", defaultJP2CompressionRatio)
+	viper.SetDefault("AuthTokenSeconds", defaultAuthTokenSeconds)
 
 	// Allow all configuration to be in environment variables
 	viper.SetEnvPrefix("RAIS")
@@ -50,6 +85,12 @@ func parseConf() {
 	viper.BindPFlag("IIIFBaseURL", pflag.CommandLine.Lookup("iiif-base-url"))
 	pflag.String("iiif-web-path", "/iiif", `Base path for serving IIIF requests, e.g., "/iiif"`)
 	viper.BindPFlag("IIIFWebPath", pflag.CommandLine.Lookup("iiif-web-path"))
+	pflag.String("iiif3-web-path", "", `Base path for serving IIIF Image API 3.0 requests, e.g., "/iiif/3" `+
+		"(3.0 info responses are still available on the main path via content negotiation)")
+	viper.BindPFlag("IIIF3WebPath", pflag.CommandLine.Lookup("iiif3-web-path"))
+	pflag.String("manifest-web-path", "", `Base path for serving IIIF Presentation 3.0 manifests, `+
+		`e.g., "/iiif/manifest" (manifests aren't served unless this is set)`)
+	viper.BindPFlag("ManifestWebPath", pflag.CommandLine.Lookup("manifest-web-path"))
 	pflag.String("address", defaultAddress, "http service address")
 	viper.BindPFlag("Address", pflag.CommandLine.Lookup("address"))
 	pflag.String("admin-address", defaultAdminAddress, "http service for administrative endpoints")
@@ -74,9 +115,75 @@ func parseConf() {
 	viper.BindPFlag("Plugins", pflag.CommandLine.Lookup("plugins"))
 	pflag.Int("jpg-quality", 75, "Quality of JPEG output")
 	viper.BindPFlag("JPGQuality", pflag.CommandLine.Lookup("jpg-quality"))
+	pflag.Int("webp-quality", defaultWebPQuality, "Quality of lossy WebP output")
+	viper.BindPFlag("WebPQuality", pflag.CommandLine.Lookup("webp-quality"))
+	pflag.Bool("webp-lossless", false, "Encode WebP output losslessly (ignores webp-quality)")
+	viper.BindPFlag("WebPLossless", pflag.CommandLine.Lookup("webp-lossless"))
+	pflag.Int("jp2-tile-size", defaultJP2TileSize, "Tile width and height of JP2 output (-1 for a single tile)")
+	viper.BindPFlag("JP2TileSize", pflag.CommandLine.Lookup("jp2-tile-size"))
+	pflag.Int("jp2-levels", defaultJP2Levels, "Resolution (wavelet decomposition) levels of JP2 output")
+	viper.BindPFlag("JP2Levels", pflag.CommandLine.Lookup("jp2-levels"))
+	pflag.Bool("jp2-lossless", false, "Encode JP2 output losslessly (ignores jp2-compression-ratio)")
+	viper.BindPFlag("JP2Lossless", pflag.CommandLine.Lookup("jp2-lossless"))
+	pflag.Float64("jp2-compression-ratio", defaultJP2CompressionRatio, "Target compression ratio of lossy JP2 output, e.g., 20 for 20:1")
+	viper.BindPFlag("JP2CompressionRatio", pflag.CommandLine.Lookup("jp2-compression-ratio"))
+	pflag.String("rotation-fill", defaultRotationFill, "Hex color for the corners arbitrary rotations expose "+
+		"in formats without transparency, e.g., JPG")
+	viper.BindPFlag("RotationFill", pflag.CommandLine.Lookup("rotation-fill"))
+	pflag.String("scale-filter", defaultScaleFilter, "Resampling filter for resizing decoded images "+
+		"(bilinear, catmullrom, or lanczos3)")
+	viper.BindPFlag("ScaleFilter", pflag.CommandLine.Lookup("scale-filter"))
+	pflag.String("tile-scale-filter", "", "Resampling filter for requests covering part of an image, "+
+		"overriding scale-filter")
+	viper.BindPFlag("TileScaleFilter", pflag.CommandLine.Lookup("tile-scale-filter"))
+	pflag.String("full-scale-filter", "", "Resampling filter for requests covering the whole image "+
+		"(e.g., thumbnails and downloads), overriding scale-filter")
+	viper.BindPFlag("FullScaleFilter", pflag.CommandLine.Lookup("full-scale-filter"))
+	pflag.Int("transform-workers", defaultTransformWorkers, "Maximum helper goroutines shared by all "+
+		"requests for scaling and color conversion of large images (0 disables parallel processing)")
+	viper.BindPFlag("TransformWorkers", pflag.CommandLine.Lookup("transform-workers"))
+	pflag.Int("decode-threads", defaultDecodeThreads, "Threads openjpeg may use for a single JP2 decode")
+	viper.BindPFlag("DecodeThreads", pflag.CommandLine.Lookup("decode-threads"))
+	pflag.Int("max-decode-threads", defaultMaxDecodeThreads, "Maximum openjpeg threads shared by all "+
+		"requests (0 disables multi-threaded decoding)")
+	viper.BindPFlag("MaxDecodeThreads", pflag.CommandLine.Lookup("max-decode-threads"))
+	pflag.Int64("max-source-pixels", goimage.DefaultMaxPixels, "Maximum pixels (w x h) of JPEG, PNG, "+
+		"GIF, and TIFF sources, which are always decoded in full (0 for no limit)")
+	viper.BindPFlag("MaxSourcePixels", pflag.CommandLine.Lookup("max-source-pixels"))
+	pflag.String("bitonal-mode", defaultBitonalMode, "How bitonal output is computed: otsu, fixed, sauvola, or dither")
+	viper.BindPFlag("BitonalMode", pflag.CommandLine.Lookup("bitonal-mode"))
+	pflag.Int("bitonal-threshold", img.DefaultBitonalThreshold, `Gray level (1-255) above which pixels are white in "fixed" bitonal mode`)
+	viper.BindPFlag("BitonalThreshold", pflag.CommandLine.Lookup("bitonal-threshold"))
+	pflag.Int("bitonal-window", img.DefaultBitonalWindow, `Neighborhood size in pixels for "sauvola" bitonal mode`)
+	viper.BindPFlag("BitonalWindow", pflag.CommandLine.Lookup("bitonal-window"))
+	pflag.Float64("bitonal-k", img.DefaultBitonalK, `Sensitivity for "sauvola" bitonal mode (higher is whiter)`)
+	viper.BindPFlag("BitonalK", pflag.CommandLine.Lookup("bitonal-k"))
+	pflag.String("color-management", defaultColorManagement, "What to do with embedded ICC profiles: "+
+		"convert (to sRGB), embed (in JPEG, PNG, and TIFF output), or ignore")
+	viper.BindPFlag("ColorManagement", pflag.CommandLine.Lookup("color-management"))
+	pflag.Bool("canonical-redirect", false, "Redirect (301) image requests to their canonical IIIF URL "+
+		"when they aren't already canonical")
+	viper.BindPFlag("CanonicalRedirect", pflag.CommandLine.Lookup("canonical-redirect"))
 	pflag.String("scheme-map", "", "Whitespace-delimited map of scheme to prefix, e.g., "+
 		`"acme=s3://bucket1 marc=s3://bucket2/some/path"`)
 	viper.BindPFlag("SchemeMap", pflag.CommandLine.Lookup("scheme-map"))
+	pflag.String("rights-attribution", "", "Default attribution text for info responses")
+	viper.BindPFlag("RightsAttribution", pflag.CommandLine.Lookup("rights-attribution"))
+	pflag.String("rights-license", "", "Default license / rights URI for info responses")
+	viper.BindPFlag("RightsLicense", pflag.CommandLine.Lookup("rights-license"))
+	pflag.String("rights-logo", "", "Default logo URL for info responses")
+	viper.BindPFlag("RightsLogo", pflag.CommandLine.Lookup("rights-logo"))
+	pflag.String("auth-web-path", "", `Base path for IIIF Auth 2.0 services, e.g., "/iiif/auth" `+
+		"(auth is disabled if this is empty)")
+	viper.BindPFlag("AuthWebPath", pflag.CommandLine.Lookup("auth-web-path"))
+	pflag.String("auth-local-users", "", `Comma-separated "user:password" list for the local `+
+		"stand-in identity provider")
+	viper.BindPFlag("AuthLocalUsers", pflag.CommandLine.Lookup("auth-local-users"))
+	pflag.Int("auth-token-seconds", defaultAuthTokenSeconds, "Lifetime of IIIF Auth access tokens")
+	viper.BindPFlag("AuthTokenSeconds", pflag.CommandLine.Lookup("auth-token-seconds"))
+	pflag.String("auth-allowed-origins", "", `Comma-separated viewer origins, e.g., "https://viewer.example.com", `+
+		"which may receive IIIF Auth access tokens")
+	viper.BindPFlag("AuthAllowedOrigins", pflag.CommandLine.Lookup("auth-allowed-origins"))
 
 	pflag.Parse()
 
@@ -94,6 +201,98 @@ func parseConf() {
 		os.Exit(1)
 	}
 
+	if viper.GetInt("AuthTokenSeconds") < 1 {
+		fmt.Println("ERROR: Invalid auth token lifetime (must be at least 1 second)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	var webpQuality = viper.GetInt("WebPQuality")
+	if webpQuality < 1 || webpQuality > 100 {
+		fmt.Println("ERROR: Invalid WebP quality (must be between 1 and 100)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	var jp2TileSize = viper.GetInt("JP2TileSize")
+	if jp2TileSize == 0 || jp2TileSize < -1 {
+		fmt.Println("ERROR: Invalid JP2 tile size (must be positive, or -1 for a single tile)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	var jp2Levels = viper.GetInt("JP2Levels")
+	if jp2Levels < 1 || jp2Levels > 32 {
+		fmt.Println("ERROR: Invalid JP2 levels (must be between 1 and 32)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	if viper.GetFloat64("JP2CompressionRatio") < 1 {
+		fmt.Println("ERROR: Invalid JP2 compression ratio (must be 1 or greater)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	var _, err = parseHexColor(viper.GetString("RotationFill"))
+	if err != nil {
+		fmt.Printf("ERROR: invalid rotation fill color: %s\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	_, err = parseScaleFilters(viper.GetString("ScaleFilter"), viper.GetString("TileScaleFilter"), viper.GetString("FullScaleFilter"))
+	if err != nil {
+		fmt.Printf("ERROR: invalid scale filter: %s\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	_, err = parseAllowedOrigins(viper.GetString("AuthAllowedOrigins"))
+	if err != nil {
+		fmt.Printf("ERROR: invalid auth allowed origins: %s\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	_, err = parseBitonal()
+	if err != nil {
+		fmt.Printf("ERROR: invalid bitonal settings: %s\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	_, err = img.ParseColorMode(viper.GetString("ColorManagement"))
+	if err != nil {
+		fmt.Printf("ERROR: invalid color management: %s\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	if viper.GetInt("TransformWorkers") < 0 {
+		fmt.Println("ERROR: Invalid transform workers (must be 0 or greater)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	if viper.GetInt("DecodeThreads") < 1 {
+		fmt.Println("ERROR: Invalid decode threads (must be 1 or greater)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	if viper.GetInt("MaxDecodeThreads") < 0 {
+		fmt.Println("ERROR: Invalid max decode threads (must be 0 or greater)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	if viper.GetInt64("MaxSourcePixels") < 0 {
+		fmt.Println("ERROR: Invalid max source pixels (must be 0 or greater)")
+		pflag.Usage()
+		os.Exit(1)
+	}
+
 	var baseIIIFURL = viper.GetString("IIIFBaseURL")
 	if baseIIIFURL != "" {
 		var u, err = url.Parse(baseIIIFURL)
@@ -113,3 +312,79 @@ func parseConf() {
 		}
 	}
 }
+
+// parseHexColor converts a CSS-style hex color ("#rrggbb" or "rrggbb") to an
+// opaque color
+func parseHexColor(s string) (color.RGBA, error) {
+	var b, err = hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(b) != 3 {
+		return color.RGBA{}, fmt.Errorf("%q is not a valid hex color (e.g., \"#ffffff\")", s)
+	}
+	return color.RGBA{b[0], b[1], b[2], 255}, nil
+}
+
+// parseBitonal returns the bitonal settings from the configuration
+func parseBitonal() (img.Bitonal, error) {
+	var b img.Bitonal
+	var err error
+	b.Mode, err = img.ParseBitonalMode(viper.GetString("BitonalMode"))
+	if err != nil {
+		return b, err
+	}
+
+	var t = viper.GetInt("BitonalThreshold")
+	if t < 1 || t > 255 {
+		return b, fmt.Errorf("threshold %d must be between 1 and 255", t)
+	}
+	b.Threshold = uint8(t)
+
+	b.Window = viper.GetInt("BitonalWindow")
+	if b.Window < 3 {
+		return b, fmt.Errorf("window %d must be at least 3", b.Window)
+	}
+	b.K = viper.GetFloat64("BitonalK")
+	if b.K <= 0 || b.K >= 1 {
+		return b, fmt.Errorf("k %g must be between 0 and 1", b.K)
+	}
+
+	return b, nil
+}
+
+// parseScaleFilters returns the filters for each request size class.  The
+// tile and full filters fall back to the default filter if they're empty.
+func parseScaleFilters(def, tile, full string) (img.ScaleFilters, error) {
+	var filters img.ScaleFilters
+	var f, err = transform.ParseFilter(def)
+	if err != nil {
+		return filters, err
+	}
+	filters.Tile, filters.Full = f, f
+
+	if tile != "" {
+		filters.Tile, err = transform.ParseFilter(tile)
+		if err != nil {
+			return filters, err
+		}
+	}
+	if full != "" {
+		filters.Full, err = transform.ParseFilter(full)
+	}
+	return filters, err
+}
+
+// parseAllowedOrigins splits a comma-separated list of origins, requiring
+// each to be a bare "scheme://host[:port]"
+func parseAllowedOrigins(s string) ([]string, error) {
+	var origins []string
+	for _, o := range strings.Split(s, ",") {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if normalizeOrigin(o) == "" {
+			return nil, fmt.Errorf("%q is not an origin (e.g., \"https://viewer.example.com\")", o)
+		}
+		origins = append(origins, o)
+	}
+	return origins, nil
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"mime"
+	"rais/src/icc"
 	"rais/src/iiif"
+	"rais/src/img"
+	"rais/src/openjpeg"
+	"rais/src/pdf"
+	"rais/src/webp"
 
 	"github.com/spf13/viper"
 	"golang.org/x/image/tiff"
@@ -17,17 +24,68 @@
 // file format RAIS doesn't support
 var ErrInvalidEncodeFormat = errors.New("Unable to encode: unsupported format")
 
-// EncodeImage uses the built-in image libs to write an image to the browser
-func EncodeImage(w io.Writer, img image.Image, format iiif.Format) error {
+// The stdlib's built-in mime table doesn't know every format we encode, and
+// we can't count on the host having a complete /etc/mime.types
+func init() {
+	mime.AddExtensionType(".jp2", "image/jp2")
+	mime.AddExtensionType(".tif", "image/tiff")
+}
+
+// profileEmbedders holds the functions for adding an ICC profile to each
+// format which can carry one
+var profileEmbedders = map[iiif.Format]func(data, profile []byte) ([]byte, error){
+	iiif.FmtJPG: icc.EmbedJPEG,
+	iiif.FmtPNG: icc.EmbedPNG,
+	iiif.FmtTIF: icc.EmbedTIFF,
+}
+
+// EncodeImage uses the built-in image libs to write an image to the browser.
+// res is the source image's resolution, used to size PDF pages.  If profile
+// isn't empty, it's embedded in formats which support ICC profiles.
+func EncodeImage(w io.Writer, m image.Image, format iiif.Format, res img.Resolution, profile []byte) error {
+	var embed = profileEmbedders[format]
+	if len(profile) == 0 || embed == nil {
+		return encodeImage(w, m, format, res)
+	}
+
+	var buf = new(bytes.Buffer)
+	var err = encodeImage(buf, m, format, res)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	data, err = embed(buf.Bytes(), profile)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encodeImage(w io.Writer, m image.Image, format iiif.Format, res img.Resolution) error {
 	switch format {
 	case iiif.FmtJPG:
-		return jpeg.Encode(w, img, &jpeg.Options{Quality: viper.GetInt("JPGQuality")})
+		return jpeg.Encode(w, m, &jpeg.Options{Quality: viper.GetInt("JPGQuality")})
 	case iiif.FmtPNG:
-		return png.Encode(w, img)
+		return png.Encode(w, m)
 	case iiif.FmtGIF:
-		return gif.Encode(w, img, &gif.Options{NumColors: 256})
+		return gif.Encode(w, m, &gif.Options{NumColors: 256})
 	case iiif.FmtTIF:
-		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+		return tiff.Encode(w, m, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	case iiif.FmtWEBP:
+		return webp.Encode(w, m, &webp.Options{
+			Lossless: viper.GetBool("WebPLossless"),
+			Quality:  float32(viper.GetInt("WebPQuality")),
+		})
+	case iiif.FmtJP2:
+		return openjpeg.Encode(w, m, &openjpeg.EncodeOptions{
+			TileSize: viper.GetInt("JP2TileSize"),
+			Levels:   viper.GetInt("JP2Levels"),
+			Lossless: viper.GetBool("JP2Lossless"),
+			Ratio:    float32(viper.GetFloat64("JP2CompressionRatio")),
+		})
+	case iiif.FmtPDF:
+		return pdf.Encode(w, m, &pdf.Options{DPIX: res.X, DPIY: res.Y, Quality: viper.GetInt("JPGQuality")})
 	}
 
 	return ErrInvalidEncodeFormat
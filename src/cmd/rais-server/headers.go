@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"rais/src/iiif"
 	"rais/src/img"
 	"time"
 )
@@ -19,3 +21,21 @@ func sendHeaders(w http.ResponseWriter, req *http.Request, res *img.Resource) er
 
 	return nil
 }
+
+// sendLinkHeaders sets the canonical and profile Link headers, if the
+// image's FeatureSet advertises them.  The canonical URL is built from
+// info.ID, so that must already be the full URL to the image.
+func (ih *ImageHandler) sendLinkHeaders(w http.ResponseWriter, u *iiif.URL, info *iiif.Info, max img.Constraint) {
+	if info == nil {
+		return
+	}
+
+	var fs = ih.features(u.ID)
+	if fs.CanonicalLinkHeader {
+		var canonical = info.ID + "/" + canonicalParams(u, info, max)
+		w.Header().Add("Link", fmt.Sprintf(`<%s>;rel="canonical"`, canonical))
+	}
+	if fs.ProfileLinkHeader {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>;rel="profile"`, fs.ProfileURI(u.Version)))
+	}
+}
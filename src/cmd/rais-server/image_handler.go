@@ -5,40 +5,102 @@
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image/color"
 	"io"
-	"io/ioutil"
 	"math"
 	"mime"
 	"net/http"
 	"net/url"
 	"path"
+	"rais/src/auth"
 	"rais/src/iiif"
 	"rais/src/img"
+	"rais/src/transform"
 	"strconv"
 	"strings"
 )
 
-func acceptsLD(req *http.Request) bool {
+// acceptEntry is a single media range from an Accept header, with its
+// parameters (e.g., a JSON-LD profile) broken out
+type acceptEntry struct {
+	mediaType string
+	params    map[string]string
+}
+
+// accepted parses all Accept headers in the request, skipping anything that
+// isn't a valid media range
+func accepted(req *http.Request) []acceptEntry {
+	var entries []acceptEntry
 	for _, h := range req.Header["Accept"] {
 		for _, accept := range strings.Split(h, ",") {
-			if accept == "application/ld+json" {
-				return true
+			var mt, params, err = mime.ParseMediaType(strings.TrimSpace(accept))
+			if err == nil {
+				entries = append(entries, acceptEntry{mediaType: mt, params: params})
 			}
 		}
 	}
 
+	return entries
+}
+
+func acceptsLD(req *http.Request) bool {
+	for _, a := range accepted(req) {
+		if a.mediaType == "application/ld+json" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acceptsProfile3 returns true if the client explicitly asked for the IIIF
+// Image API 3.0 context via a JSON or JSON-LD profile parameter
+func acceptsProfile3(req *http.Request) bool {
+	for _, a := range accepted(req) {
+		if a.params["profile"] == iiif.Context3 {
+			return true
+		}
+	}
+
 	return false
 }
 
 // ImageHandler responds to a IIIF URL request and parses the requested
 // transformation within the limits of the handler's capabilities
 type ImageHandler struct {
-	BaseURL       *url.URL
-	WebPathPrefix string
-	FeatureSet    *iiif.FeatureSet
-	TilePath      string
-	Maximums      img.Constraint
-	schemeMap     map[string]string
+	BaseURL         *url.URL
+	WebPathPrefix   string
+	V3WebPathPrefix string
+	FeatureSet      *iiif.FeatureSet
+	TilePath        string
+	Maximums        img.Constraint
+	RotationFill    color.Color
+	ScaleFilters    img.ScaleFilters
+	Bitonal         img.Bitonal
+	ColorMode       img.ColorMode
+
+	// Auth restricts access to images when set; see AuthHandler
+	Auth *AuthHandler
+
+	// ManifestPathPrefix is the base path for Presentation 3.0 manifest
+	// requests; see ManifestRoute.  Manifests aren't served when it's empty.
+	ManifestPathPrefix string
+
+	// Rights holds the default rights data for all images, and SchemeRights
+	// holds defaults for images whose IDs use a given scheme
+	Rights       iiif.Rights
+	SchemeRights map[string]iiif.Rights
+
+	// SchemeFeatures and SchemeMaximums replace FeatureSet and Maximums for
+	// images whose IDs use a given scheme
+	SchemeFeatures map[string]*iiif.FeatureSet
+	SchemeMaximums map[string]img.Constraint
+
+	// CanonicalRedirect tells the handler to answer image requests which
+	// aren't in canonical form with a 301 to the canonical URL
+	CanonicalRedirect bool
+
+	schemeMap map[string]string
 }
 
 // NewImageHandler sets up a base ImageHandler with no features
@@ -94,13 +156,66 @@ func (ih *ImageHandler) AddSchemeMap(scheme, prefix string) error {
 	return nil
 }
 
+// idScheme returns the scheme of the given ID, or an empty string if it has
+// none or can't be parsed
+func idScheme(id iiif.ID) string {
+	var u, err = url.Parse(string(id))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// features returns the FeatureSet for the image with the given ID
+func (ih *ImageHandler) features(id iiif.ID) *iiif.FeatureSet {
+	var fs, ok = ih.SchemeFeatures[idScheme(id)]
+	if ok {
+		return fs
+	}
+	return ih.FeatureSet
+}
+
+// limits returns the configured size constraints for the image with the
+// given ID
+func (ih *ImageHandler) limits(id iiif.ID) img.Constraint {
+	var max, ok = ih.SchemeMaximums[idScheme(id)]
+	if ok {
+		return max
+	}
+	return ih.Maximums
+}
+
+// canonicalParams returns the canonical form of u's parameters for the image
+// info describes
+func canonicalParams(u *iiif.URL, info *iiif.Info, max img.Constraint) string {
+	var crop, scale = img.Dimensions(u, info.Width, info.Height, max)
+	return u.Canonical(info.Width, info.Height, crop, scale)
+}
+
 // cacheKey returns a key for caching if a given IIIF URL is cacheable by our
-// current, somewhat restrictive, rules
-func cacheKey(u *iiif.URL) string {
-	if tileCache != nil && u.Format == iiif.FmtJPG && u.Size.W > 0 && u.Size.W <= 1024 && u.Size.H <= 1024 {
-		return u.Path
+// current, somewhat restrictive, rules: only JPGs no larger than 1024x1024
+// are cached.  The key is the request's canonical 2.x form so that equivalent
+// requests, including 3.0 requests for the same pixels, share a cache entry.
+//
+// Requests beyond max get no key: the key doesn't include the maximums, so a
+// user with lower limits (e.g., degraded access) would otherwise be served
+// whatever a less limited user cached for the same URL.
+func cacheKey(u *iiif.URL, info *iiif.Info, max img.Constraint) string {
+	if tileCache == nil || info == nil || u.Format != iiif.FmtJPG {
+		return ""
 	}
-	return ""
+
+	var crop, scale = img.Dimensions(u, info.Width, info.Height, max)
+	if scale.Dx() > 1024 || scale.Dy() > 1024 {
+		return ""
+	}
+	if max.SmallerThanAny(transform.RotatedSize(scale.Dx(), scale.Dy(), u.Rotation.Degrees)) {
+		return ""
+	}
+
+	var u2 = *u
+	u2.Version = iiif.Version2
+	return u.ID.Escaped() + "/" + u2.Canonical(info.Width, info.Height, crop, scale)
 }
 
 // getRequestURL determines the "real" request URL.  Proxies are supported by
@@ -126,8 +241,23 @@ func getRequestURL(req *http.Request) *url.URL {
 }
 
 // IIIFRoute takes an HTTP request and parses it to see what (if any) IIIF
-// translation is requested
+// translation is requested.  Requests are parsed using the IIIF Image API
+// 2.x rules, though info requests can ask for a 3.0 response via the Accept
+// header's profile.
 func (ih *ImageHandler) IIIFRoute(w http.ResponseWriter, req *http.Request) {
+	ih.route(w, req, ih.WebPathPrefix, iiif.Version2)
+}
+
+// IIIF3Route is the IIIFRoute equivalent for requests made under the IIIF
+// Image API 3.0 web path: requests are parsed and answered using only the 3.0
+// rules.
+func (ih *ImageHandler) IIIF3Route(w http.ResponseWriter, req *http.Request) {
+	ih.route(w, req, ih.V3WebPathPrefix, iiif.Version3)
+}
+
+// route does the work for IIIFRoute and IIIF3Route, treating webPath as the
+// base path for IIIF requests of the given version
+func (ih *ImageHandler) route(w http.ResponseWriter, req *http.Request, webPath string, v iiif.Version) {
 	// We need to take a copy of the URL, not the original, since we modify
 	// things a bit
 	var u = *req.URL
@@ -152,10 +282,10 @@ func (ih *ImageHandler) IIIFRoute(w http.ResponseWriter, req *http.Request) {
 	// Strip the IIIF web path off the beginning of the path to determine the
 	// actual request.  This should always work because a request shouldn't be
 	// able to get here if it didn't have our prefix.
-	var prefix = ih.WebPathPrefix + "/"
+	var prefix = webPath + "/"
 	u.Path = strings.Replace(u.Path, prefix, "", 1)
 
-	iiifURL, err := iiif.NewURL(u.Path)
+	iiifURL, err := iiif.NewVersionedURL(u.Path, v)
 	// If the iiifURL is invalid, it's possible this is a base URI request.
 	// Let's see if treating the path as an ID gives us any info.
 	if err != nil {
@@ -184,30 +314,24 @@ func (ih *ImageHandler) IIIFRoute(w http.ResponseWriter, req *http.Request) {
 	infourl := &url.URL{
 		Scheme: u.Scheme,
 		Host:   u.Host,
-		Path:   ih.WebPathPrefix,
+		Path:   webPath,
 	}
 
 	// Because of how Go's URL path magic works, we really do have to just
 	// concatenate these two things with a slash manually
 	info.ID = infourl.String() + "/" + iiifURL.ID.Escaped()
 
-	if iiifURL.Info {
-		ih.Info(w, req, info)
-		return
-	}
+	var access = ih.authorize(req, &u, iiifURL.ID, info)
 
-	// Check the cache before spending the cycles to read in the image.  For now
-	// the cache is very limited to ensure only relatively small requests are
-	// actually cached.
-	if key := cacheKey(iiifURL); key != "" {
-		stats.TileCache.Get()
-		data, ok := tileCache.Get(key)
-		if ok {
-			stats.TileCache.Hit()
-			w.Header().Set("Content-Type", mime.TypeByExtension("."+string(iiifURL.Format)))
-			w.Write(data.([]byte))
-			return
+	if iiifURL.Info {
+		if acceptsProfile3(req) {
+			v = iiif.Version3
 		}
+		// Only info responses carry rights data, so image requests don't pay for
+		// reading the sidecar
+		ih.applyRights(res, info)
+		ih.Info(w, req, info, v)
+		return
 	}
 
 	if !iiifURL.Valid() {
@@ -216,6 +340,11 @@ func (ih *ImageHandler) IIIFRoute(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if access == auth.Denied {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	// Attempt to run the command
 	ih.Command(w, req, iiifURL, res, info)
 }
@@ -289,10 +418,15 @@ func convertStrings(s1, s2, s3 string) (i1, i2, i3 int, err error) {
 }
 
 // Info responds to a IIIF info request with appropriate JSON based on the
-// image's data and the handler's capabilities
-func (ih *ImageHandler) Info(w http.ResponseWriter, req *http.Request, info *iiif.Info) {
+// image's data and the handler's capabilities, using the structure defined by
+// the given IIIF Image API version
+func (ih *ImageHandler) Info(w http.ResponseWriter, req *http.Request, info *iiif.Info, v iiif.Version) {
 	// Convert info to JSON
-	jsonData, err := marshalInfo(info)
+	var data any = info
+	if v == iiif.Version3 {
+		data = info.V3()
+	}
+	jsonData, err := marshalInfo(data)
 	if err != nil {
 		http.Error(w, err.Message, err.Code)
 		return
@@ -302,6 +436,9 @@ func (ih *ImageHandler) Info(w http.ResponseWriter, req *http.Request, info *iii
 	ct := "application/json"
 	if acceptsLD(req) {
 		ct = "application/ld+json"
+		if v == iiif.Version3 {
+			ct += `;profile="` + iiif.Context3 + `"`
+		}
 	}
 	w.Header().Set("Content-Type", ct)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -317,6 +454,9 @@ func newImageResError(err error) *HandlerError {
 	if errors.Is(err, img.ErrDimensionsExceedLimits) {
 		return NewError(err.Error(), 501)
 	}
+	if errors.Is(err, img.ErrUpscaleNotAllowed) || errors.Is(err, img.ErrRegionOutsideImage) {
+		return NewError(err.Error(), 400)
+	}
 	if errors.Is(err, img.ErrDoesNotExist) {
 		return NewError("image resource does not exist", 404)
 	}
@@ -339,6 +479,8 @@ func (ih *ImageHandler) getImageData(id iiif.ID) (*img.Resource, *iiif.Info, *Ha
 	return res, info, nil
 }
 
+// getIIIFInfo returns the info for an image from the cache, an override file,
+// or the image itself, in that order
 func (ih *ImageHandler) getIIIFInfo(res *img.Resource) (*iiif.Info, *HandlerError) {
 	// Check for cached image data first, and use that to create JSON
 	var info = ih.loadInfoFromCache(res.ID)
@@ -372,34 +514,69 @@ func (ih *ImageHandler) loadInfoFromCache(id iiif.ID) *iiif.Info {
 	}
 
 	stats.InfoCache.Hit()
-	return ih.buildInfo(data.(ImageInfo))
+	switch v := data.(type) {
+	case infoOverride:
+		return parseInfoOverride(v, string(id))
+	default:
+		return ih.buildInfo(id, v.(ImageInfo))
+	}
 }
 
-func (ih *ImageHandler) loadInfoOverride(res *img.Resource) *iiif.Info {
-	// If scheme isn't "file", we don't even try to find a file override
-	if res.URL.Scheme != "file" {
-		return nil
+// readSidecar returns the contents of the file stored alongside res with the
+// given suffix, e.g., "s3://bucket/foo.jp2-info.json", and the sidecar's URL.
+// Sidecars are read through the registered stream readers, so they work for
+// any image location RAIS can stream from.  A nil slice is returned if the
+// sidecar doesn't exist or can't be read.
+func (ih *ImageHandler) readSidecar(res *img.Resource, suffix string) ([]byte, *url.URL) {
+	var u = &url.URL{Scheme: res.URL.Scheme, Host: res.URL.Host, Path: res.URL.Path + suffix}
+	var s, err = img.Open(u)
+	if err != nil {
+		if !errors.Is(err, img.ErrDoesNotExist) {
+			Logger.Debugf("Unable to open sidecar %q: %s", u, err)
+		}
+		return nil, u
 	}
+	defer s.Close()
 
-	// If an override file isn't found or has an error, just skip it
-	var infofile = res.URL.Path + "-info.json"
-	var data, err = ioutil.ReadFile(infofile)
+	data, err := io.ReadAll(s)
 	if err != nil {
+		Logger.Errorf("Unable to read sidecar %q: %s", u, err)
+		return nil, u
+	}
+	return data, u
+}
+
+func (ih *ImageHandler) loadInfoOverride(res *img.Resource) *iiif.Info {
+	// If an override file isn't found or has an error, just skip it
+	var data, u = ih.readSidecar(res, "-info.json")
+	if data == nil {
 		return nil
 	}
 
-	Logger.Debugf("Loading image data from override file (%s)", infofile)
+	Logger.Debugf("Loading image data from override file (%s)", u)
+
+	var info = parseInfoOverride(data, u.String())
+	if info != nil {
+		ih.saveInfoToCache(res.ID, infoOverride(data))
+	}
+	return info
+}
 
+// parseInfoOverride unmarshals override JSON, logging errors with the given
+// source to identify the bad override
+func parseInfoOverride(data []byte, source string) *iiif.Info {
 	var info = new(iiif.Info)
-	err = json.Unmarshal(data, info)
+	var err = json.Unmarshal(data, info)
 	if err != nil {
-		Logger.Errorf("Cannot parse JSON override file %q: %s", infofile, err)
+		Logger.Errorf("Cannot parse JSON override file %q: %s", source, err)
 		return nil
 	}
 	return info
 }
 
-func (ih *ImageHandler) saveInfoToCache(id iiif.ID, info ImageInfo) {
+// saveInfoToCache stores an image's info data, which must be an ImageInfo or
+// infoOverride
+func (ih *ImageHandler) saveInfoToCache(id iiif.ID, info any) {
 	if infoCache == nil {
 		return
 	}
@@ -426,20 +603,25 @@ func (ih *ImageHandler) loadInfoFromImageResource(res *img.Resource) (*iiif.Info
 	// We save the minimal data to the cache so our cache remains incredibly
 	// small for what it gives us
 	ih.saveInfoToCache(res.ID, imageInfo)
-	return ih.buildInfo(imageInfo), nil
+	return ih.buildInfo(res.ID, imageInfo), nil
 }
 
-func (ih *ImageHandler) buildInfo(i ImageInfo) *iiif.Info {
-	info := ih.FeatureSet.Info()
+// buildInfo returns the info for the image with the given ID, using the
+// features and size limits configured for the ID's scheme
+func (ih *ImageHandler) buildInfo(id iiif.ID, i ImageInfo) *iiif.Info {
+	info := ih.features(id).Info()
 	info.Width = i.Width
 	info.Height = i.Height
 
-	if ih.Maximums.SmallerThanAny(i.Width, i.Height) {
-		info.Profile.MaxArea = ih.Maximums.Area
-		info.Profile.MaxWidth = ih.Maximums.Width
-		info.Profile.MaxHeight = ih.Maximums.Height
+	var max = ih.limits(id)
+	if max.SmallerThanAny(i.Width, i.Height) {
+		info.Profile.MaxArea = max.Area
+		info.Profile.MaxWidth = max.Width
+		info.Profile.MaxHeight = max.Height
 	}
 
+	info.Sizes = listedSizes(i, max)
+
 	// Compute scaling and tiling
 	if i.TileWidth > 0 && i.TileWidth < i.Width && i.TileHeight < i.Height {
 		var sf []int
@@ -470,7 +652,26 @@ func (ih *ImageHandler) buildInfo(i ImageInfo) *iiif.Info {
 	return info
 }
 
-func marshalInfo(info *iiif.Info) ([]byte, *HandlerError) {
+// listedSizes returns the full-image sizes the decoder can produce cheaply,
+// one per resolution level, smallest first.  Sizes beyond the handler's
+// maximums are left out, as are the absurdly small ones we also leave out of
+// the tile scale factors.
+func listedSizes(i ImageInfo, max img.Constraint) []iiif.ListedSize {
+	var sizes []iiif.ListedSize
+	for x := i.Levels; x >= 0; x-- {
+		var scale = 1 << x
+		var w = (i.Width + scale - 1) / scale
+		var h = (i.Height + scale - 1) / scale
+		if w < 16 || h < 16 || max.SmallerThanAny(w, h) {
+			continue
+		}
+		sizes = append(sizes, iiif.ListedSize{Width: w, Height: h})
+	}
+
+	return sizes
+}
+
+func marshalInfo(info any) ([]byte, *HandlerError) {
 	jsonData, err := json.Marshal(info)
 	if err != nil {
 		Logger.Errorf("Unable to marshal IIIFInfo response: %s", err)
@@ -480,6 +681,37 @@ func marshalInfo(info *iiif.Info) ([]byte, *HandlerError) {
 	return jsonData, nil
 }
 
+// maximums returns the size constraints for a request of the given API
+// version.  If we have an info, we can make use of it for the constraints
+// rather than using the global constraints; this is useful for overridden
+// info.json files.
+func (ih *ImageHandler) maximums(info *iiif.Info, v iiif.Version) img.Constraint {
+	if info == nil {
+		return ih.Maximums
+	}
+
+	var max = img.Constraint{
+		Width:  info.Profile.MaxWidth,
+		Height: info.Profile.MaxHeight,
+		Area:   info.Profile.MaxArea,
+	}
+	// Per the 3.0 spec, a missing maxHeight means it's the same as maxWidth.
+	// 2.x requests keep RAIS's older behavior of leaving the height unlimited.
+	if v == iiif.Version3 && max.Height == 0 {
+		max.Height = max.Width
+	}
+	if max.Width == 0 {
+		max.Width = math.MaxInt32
+	}
+	if max.Height == 0 {
+		max.Height = math.MaxInt32
+	}
+	if max.Area == 0 {
+		max.Area = math.MaxInt64
+	}
+	return max
+}
+
 // Command handles image processing operations
 func (ih *ImageHandler) Command(w http.ResponseWriter, req *http.Request, u *iiif.URL, res *img.Resource, info *iiif.Info) {
 	// Send last modified time
@@ -487,32 +719,84 @@ func (ih *ImageHandler) Command(w http.ResponseWriter, req *http.Request, u *iii
 		return
 	}
 
+	// IIIF 2.x has no "^" syntax: advertising sizeAboveFull means an explicit
+	// size is allowed to scale above the region.  "full" and "max" never scale
+	// above the region in 2.x.
+	var fs = ih.features(u.ID)
+	if u.Version == iiif.Version2 && fs.SizeAboveFull && u.Size.Type != iiif.STFull && u.Size.Type != iiif.STMax {
+		u.Size.Upscale = true
+	}
+
 	// Do we support this request?  If not, return a 501
-	if !ih.FeatureSet.Supported(u) {
+	var sizes []iiif.ListedSize
+	if info != nil {
+		sizes = info.Sizes
+	}
+	if !fs.SupportedWithSizes(u, sizes) {
 		http.Error(w, "Feature not supported", 501)
 		return
 	}
 
-	var max = ih.Maximums
+	// The info profile can't be the only source of maximums: it only lists them
+	// when the image is larger than them, and an info.json sidecar can list its
+	// own.  Requests are therefore always held to the configured limits as well.
+	var max = ih.maximums(info, u.Version).Min(ih.limits(u.ID))
 
-	// If we have an info, we can make use of it for the constraints rather than
-	// using the global constraints; this is useful for overridden info.json files
-	if info != nil {
-		max = img.Constraint{
-			Width:  info.Profile.MaxWidth,
-			Height: info.Profile.MaxHeight,
-			Area:   info.Profile.MaxArea,
-		}
-		if max.Width == 0 {
-			max.Width = math.MaxInt32
+	// A region entirely outside the image has no canonical form and nothing to
+	// cache, so it has to be rejected before anything else happens
+	if info != nil && u.Region.GetCrop(info.Width, info.Height).Empty() {
+		http.Error(w, img.ErrRegionOutsideImage.Error(), 400)
+		return
+	}
+
+	// An upscale without "^" is an error in 3.0.  Its canonical form and cache
+	// key would be those of the valid "^" request, so it has to be rejected
+	// before either is used.
+	if info != nil && !u.Size.Upscale {
+		var crop, scale = img.Dimensions(u, info.Width, info.Height, max)
+		if iiif.Upscales(crop, scale) {
+			http.Error(w, img.ErrUpscaleNotAllowed.Error(), 400)
+			return
 		}
-		if max.Height == 0 {
-			max.Height = math.MaxInt32
+	}
+
+	// Send clients to the canonical form of their request if we've been told
+	// to, so caches upstream of RAIS only ever see one URL per image.  Images
+	// limited to listed sizes may not support the canonical form, in which
+	// case the request is served as-is.
+	if ih.CanonicalRedirect && info != nil {
+		var canonical = canonicalParams(u, info, max)
+		var cu, err = iiif.NewVersionedURL(u.ID.Escaped()+"/"+canonical, u.Version)
+		if canonical != u.Params() && err == nil && fs.SupportedWithSizes(cu, sizes) {
+			var target = info.ID + "/" + canonical
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
+			}
+			http.Redirect(w, req, target, http.StatusMovedPermanently)
+			return
 		}
-		if max.Area == 0 {
-			max.Area = math.MaxInt64
+	}
+
+	// Check the cache before spending the cycles to read in the image.  For now
+	// the cache is very limited to ensure only relatively small requests are
+	// actually cached.
+	var key = cacheKey(u, info, max)
+	if key != "" {
+		stats.TileCache.Get()
+		data, ok := tileCache.Get(key)
+		if ok {
+			stats.TileCache.Hit()
+			ih.sendLinkHeaders(w, u, info, max)
+			w.Header().Set("Content-Type", mime.TypeByExtension("."+string(u.Format)))
+			w.Write(data.([]byte))
+			return
 		}
 	}
+
+	res.RotationFill = ih.RotationFill
+	res.ScaleFilters = ih.ScaleFilters
+	res.Bitonal = ih.Bitonal
+	res.ColorMode = ih.ColorMode
 	imgData, err := res.Apply(u, max)
 	if err != nil {
 		e := newImageResError(err)
@@ -521,16 +805,17 @@ func (ih *ImageHandler) Command(w http.ResponseWriter, req *http.Request, u *iii
 		return
 	}
 
+	ih.sendLinkHeaders(w, u, info, max)
 	w.Header().Set("Content-Type", mime.TypeByExtension("."+string(u.Format)))
 
 	cacheBuf := bytes.NewBuffer(nil)
-	if err := EncodeImage(cacheBuf, imgData, u.Format); err != nil {
+	if err := EncodeImage(cacheBuf, imgData, u.Format, res.OutputResolution(), res.EmbeddedProfile()); err != nil {
 		http.Error(w, "Unable to encode", 500)
 		Logger.Errorf("Unable to encode to %s: %s", u.Format, err)
 		return
 	}
 
-	if key := cacheKey(u); key != "" {
+	if key != "" {
 		stats.TileCache.Set()
 		tileCache.Add(key, cacheBuf.Bytes())
 	}
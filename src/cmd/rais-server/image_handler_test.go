@@ -12,10 +12,12 @@
 	"rais/src/fakehttp"
 	"rais/src/iiif"
 	"rais/src/img"
+	"rais/src/plugins"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/uoregon-libraries/gopkg/assert"
 	"github.com/uoregon-libraries/gopkg/logger"
 )
@@ -28,8 +30,18 @@ func nc(w, h int, a int64) img.Constraint {
 
 func init() {
 	Logger = logger.New(logger.Warn)
-	img.RegisterDecodeHandler(decodeJP2)
+	img.RegisterDecodeHandler(decodeImage)
 	img.RegisterStreamReader(fileStreamReader)
+	img.RegisterStreamReader(fakeCloudStreamReader)
+}
+
+// fakeCloudStreamReader serves "fakecloud://" URLs from local files, standing
+// in for a cloud bucket
+func fakeCloudStreamReader(u *url.URL) (img.OpenStreamFunc, error) {
+	if u.Scheme != "fakecloud" {
+		return nil, plugins.ErrSkipped
+	}
+	return func() (img.Streamer, error) { return img.NewFileStream(u.Path) }, nil
 }
 
 func rootDir() string {
@@ -115,11 +127,103 @@ func TestInfoHandlerBuiltJSON(t *testing.T) {
 	assert.Equal(800, data.Width, "JSON-decoded width", t)
 	assert.Equal(400, data.Height, "JSON-decoded height", t)
 	assert.Equal(0, len(data.Tiles), "Tiles aren't reported when full image is a single tile", t)
+	if diff := cmp.Diff([]iiif.ListedSize{{Width: 400, Height: 200}, {Width: 800, Height: 400}}, data.Sizes); diff != "" {
+		t.Errorf("sizes come from resolution levels: %s", diff)
+	}
 	assert.Equal("http://example.com/foo/bar/docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2", data.ID, "JSON-decoded ID", t)
 	assert.Equal(1, len(w.Headers["Content-Type"]), "Proper content type length", t)
 	assert.Equal("application/json", w.Headers["Content-Type"][0], "Proper content type", t)
 }
 
+func TestInfoOverrideStreamed(t *testing.T) {
+	var fname = filepath.Join(t.TempDir(), "foo.jp2")
+	var override = `{"@id":"%ID%","width":800,"height":400,"profile":["http://iiif.io/api/image/2/level2.json",{"maxWidth":512}]}`
+	assert.NilError(os.WriteFile(fname+"-info.json", []byte(override), 0644), "writing the override", t)
+
+	infoCache, _ = lru.New(10)
+	defer func() { infoCache = nil }()
+
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	var res = &img.Resource{ID: "foo.jp2", URL: &url.URL{Scheme: "fakecloud", Path: fname}}
+	var info = h.loadInfoOverride(res)
+	assert.True(info != nil, "override is read through the stream readers", t)
+	assert.Equal(512, info.Profile.MaxWidth, "override max width", t)
+
+	// With the sidecar gone, we should still get the override from the cache
+	assert.NilError(os.Remove(fname+"-info.json"), "removing the override", t)
+	info, e := h.getIIIFInfo(res)
+	assert.True(e == nil, "cached info has no error", t)
+	assert.Equal(512, info.Profile.MaxWidth, "cached override max width", t)
+
+	info.Profile.MaxWidth = 1
+	info = h.loadInfoFromCache("foo.jp2")
+	assert.Equal(512, info.Profile.MaxWidth, "changes to info don't alter the cache", t)
+}
+
+func TestApplyRights(t *testing.T) {
+	var fname = filepath.Join(t.TempDir(), "foo.jp2")
+	var sidecar = `{"license":"http://example.com/image-license","partOf":[{"id":"http://example.com/manifest","type":"Manifest"}]}`
+	assert.NilError(os.WriteFile(fname+"-rights.json", []byte(sidecar), 0644), "writing the sidecar", t)
+
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	h.Rights = iiif.Rights{Attribution: "Global", License: "http://example.com/license", Logo: "http://example.com/logo.png"}
+	h.SchemeRights = map[string]iiif.Rights{"acme": {Attribution: "Acme"}}
+
+	var info = iiif.NewInfo()
+	info.Logo = "http://example.com/override-logo.png"
+	h.applyRights(&img.Resource{ID: "acme://foo.jp2", URL: &url.URL{Scheme: "fakecloud", Path: fname}}, info)
+
+	var want = iiif.Rights{
+		Attribution: "Acme",
+		License:     "http://example.com/image-license",
+		Logo:        "http://example.com/override-logo.png",
+		PartOf:      []iiif.PartOf{{ID: "http://example.com/manifest", Type: "Manifest"}},
+	}
+	if diff := cmp.Diff(want, info.Rights()); diff != "" {
+		t.Errorf("layered rights: %s", diff)
+	}
+
+	info = iiif.NewInfo()
+	h.applyRights(&img.Resource{ID: "other.jp2", URL: &url.URL{Scheme: "fakecloud", Path: fname + ".none"}}, info)
+	if diff := cmp.Diff(h.Rights, info.Rights()); diff != "" {
+		t.Errorf("global rights: %s", diff)
+	}
+}
+
+func TestRightsInfoOnly(t *testing.T) {
+	infoCache, _ = lru.New(10)
+	rightsCache, _ = lru.New(10)
+	defer func() { infoCache, rightsCache = nil, nil }()
+
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2"
+	request(imgid+"/full/full/0/default.jpg", t)
+	assert.Equal(0, rightsCache.Len(), "image requests don't read rights data", t)
+
+	request(imgid+"/info.json", t)
+	assert.Equal(1, rightsCache.Len(), "info requests cache rights data", t)
+	assert.Equal(1, infoCache.Len(), "rights data isn't in the info cache", t)
+}
+
+func TestSchemeFeaturesAndMaximums(t *testing.T) {
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	h.FeatureSet = iiif.FeatureSet2()
+	h.SchemeFeatures = map[string]*iiif.FeatureSet{"restricted": iiif.FeatureSet0()}
+	h.SchemeMaximums = map[string]img.Constraint{"restricted": nc(300, 300, 90000)}
+	var i = ImageInfo{Width: 800, Height: 400, TileWidth: 256, TileHeight: 256, Levels: 2}
+
+	var info = h.buildInfo("restricted://foo.jp2", i)
+	assert.Equal(iiif.ProfileLevel0URI, info.Profile.ConformanceURL, "restricted images are level 0", t)
+	assert.Equal(300, info.Profile.MaxWidth, "restricted max width", t)
+	if diff := cmp.Diff([]iiif.ListedSize{{Width: 200, Height: 100}}, info.Sizes); diff != "" {
+		t.Errorf("restricted sizes are capped: %s", diff)
+	}
+
+	info = h.buildInfo("public://foo.jp2", i)
+	assert.Equal(iiif.ProfileLevel2URI, info.Profile.ConformanceURL, "other images use the global features", t)
+	assert.Equal(0, info.Profile.MaxWidth, "other images use the global maximums", t)
+	assert.Equal(3, len(info.Sizes), "other images list every size", t)
+}
+
 func TestInfoHandlerLD(t *testing.T) {
 	w := requestLD("docker%2Fimages%2Ftestfile%2Ftest-world.jp2/info.json", t)
 	assert.Equal(-1, w.StatusCode, "Valid info request doesn't explicitly set status code", t)
@@ -144,6 +248,7 @@ func TestInfoMaxSize(t *testing.T) {
 	assert.Equal(60, data.Profile.MaxWidth, "JSON-decoded max width", t)
 	assert.Equal(80, data.Profile.MaxHeight, "JSON-decoded max height", t)
 	assert.Equal(int64(480), data.Profile.MaxArea, "JSON-decoded max area", t)
+	assert.Equal(0, len(data.Sizes), "No sizes fit within the maximums", t)
 
 	// Make sure those profile variables are in the output data
 	assert.True(bytes.Contains(w.Output, []byte("maxWidth")), "maxWidth", t)
@@ -151,6 +256,16 @@ func TestInfoMaxSize(t *testing.T) {
 	assert.True(bytes.Contains(w.Output, []byte("maxArea")), "maxArea", t)
 }
 
+// TestInfoSizesMaximums verifies sizes beyond the handler's maximums aren't listed
+func TestInfoSizesMaximums(t *testing.T) {
+	w := dorequest("docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/info.json", false, nc(500, 500, 250000), t)
+	var data iiif.Info
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	if diff := cmp.Diff([]iiif.ListedSize{{Width: 400, Height: 200}}, data.Sizes); diff != "" {
+		t.Errorf("sizes are capped by maximums: %s", diff)
+	}
+}
+
 // TestInfoNoMaxSize verifies that when the image is smaller than the handler's
 // maximums, values are not present in the info profile
 func TestInfoNoMaxSize(t *testing.T) {
@@ -167,6 +282,261 @@ func TestInfoNoMaxSize(t *testing.T) {
 	assert.False(bytes.Contains(w.Output, []byte("maxArea")), "no maxArea", t)
 }
 
+// dorequest3 sets up a IIIF 3.0 request, optionally with an Accept header
+func dorequest3(path, accept string, t *testing.T) *fakehttp.ResponseWriter {
+	u, _ := url.Parse("http://example.com")
+	w := fakehttp.NewResponseWriter()
+	reqPath := fmt.Sprintf("/foo/v3/%s", path)
+	req, err := http.NewRequest("get", reqPath, strings.NewReader(""))
+	if err != nil {
+		t.Errorf("Unable to create fake request: %s", err)
+	}
+	req.RequestURI = reqPath
+	if accept != "" {
+		req.Header.Add("Accept", accept)
+	}
+
+	h := NewImageHandler(rootDir(), "/foo/bar")
+	h.V3WebPathPrefix = "/foo/v3"
+	h.BaseURL = u
+	h.FeatureSet = iiif.AllFeatures()
+	h.IIIF3Route(w, req)
+
+	return w
+}
+
+func TestInfoHandler3(t *testing.T) {
+	w := dorequest3("docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/info.json", "", t)
+	assert.Equal(-1, w.StatusCode, "Valid info request doesn't explicitly set status code", t)
+	var data iiif.Info3
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	assert.Equal(iiif.Context3, data.Context, "3.0 context", t)
+	assert.Equal("ImageService3", data.Type, "3.0 type", t)
+	assert.Equal("level2", data.Profile, "3.0 profile", t)
+	assert.Equal(800, data.Width, "JSON-decoded width", t)
+	assert.Equal("http://example.com/foo/v3/docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2", data.ID, "id uses the 3.0 path", t)
+	assert.Equal("application/json", w.Headers["Content-Type"][0], "Proper content type", t)
+}
+
+func TestInfoHandler3LD(t *testing.T) {
+	w := dorequest3("docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/info.json", "application/ld+json", t)
+	assert.Equal(`application/ld+json;profile="http://iiif.io/api/image/3/context.json"`, w.Headers["Content-Type"][0], "Proper content type", t)
+}
+
+func TestInfoHandlerAcceptProfile3(t *testing.T) {
+	u, _ := url.Parse("http://example.com")
+	w := fakehttp.NewResponseWriter()
+	reqPath := "/foo/bar/docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/info.json"
+	req, _ := http.NewRequest("get", reqPath, strings.NewReader(""))
+	req.Header.Add("Accept", `application/ld+json; profile="http://iiif.io/api/image/3/context.json"`)
+	h := NewImageHandler(rootDir(), "/foo/bar")
+	h.BaseURL = u
+	h.IIIFRoute(w, req)
+
+	var data iiif.Info3
+	assert.NilError(json.Unmarshal(w.Output, &data), "unmarshal doesn't throw an error", t)
+	assert.Equal(iiif.Context3, data.Context, "3.0 context via content negotiation", t)
+	assert.Equal("http://example.com/foo/bar/docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2", data.ID, "id uses the main path", t)
+	assert.Equal(`application/ld+json;profile="http://iiif.io/api/image/3/context.json"`, w.Headers["Content-Type"][0], "Proper content type", t)
+}
+
+func TestCommandHandler3FullSize(t *testing.T) {
+	w := dorequest3("docker%2Fimages%2Ftestfile%2Ftest-world.jp2/full/full/0/default.jpg", "", t)
+	assert.Equal(400, w.StatusCode, "3.0 requests can't use the full size", t)
+}
+
+func TestCommandHandlerUpscale(t *testing.T) {
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world.jp2/0,0,40,40/"
+
+	// Level 2 doesn't include sizeAboveFull, so upscaling is a 400 when implied
+	// and a 501 when explicitly requested
+	w := dorequestl2(imgid+"80,/0/default.jpg", false, unlimited, t)
+	assert.Equal(400, w.StatusCode, "Upscaling without sizeAboveFull", t)
+	w = dorequestl2(imgid+"^80,/0/default.jpg", false, unlimited, t)
+	assert.Equal(501, w.StatusCode, "Explicit upscaling without sizeAboveFull", t)
+
+	// IIIF 3.0 always requires the caret to upscale
+	w = dorequest3(imgid+"80,/0/default.jpg", "", t)
+	assert.Equal(400, w.StatusCode, "3.0 upscaling without a caret", t)
+}
+
+func TestCommandHandlerUpscaleLimits(t *testing.T) {
+	// The image is smaller than the maximums, so its info lists none, but an
+	// upscale still can't go beyond them
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/full/"
+	w := dorequestGeneric(imgid+"60000,/0/default.jpg", false, nc(1000, 1000, 1000000), iiif.AllFeatures(), t)
+	assert.Equal(501, w.StatusCode, "2.x upscale beyond the limits", t)
+	w = dorequestGeneric(imgid+"pct:500/0/default.jpg", false, nc(1000, 1000, 1000000), iiif.AllFeatures(), t)
+	assert.Equal(501, w.StatusCode, "percent upscale beyond the limits", t)
+}
+
+func TestSidecarMaxHeight(t *testing.T) {
+	// The sidecar lists a maxWidth of 512 and no maxHeight, which 3.0 reads as
+	// a maxHeight of 512, but 2.x leaves unlimited
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world.jp2/0,0,100,400/"
+	var w = dorequestGeneric(imgid+",600/0/default.jpg", false, unlimited, iiif.AllFeatures(), t)
+	assert.True(w.StatusCode != 501, "2.x doesn't infer a maxHeight", t)
+	w = dorequest3(imgid+"^,600/0/default.jpg", "", t)
+	assert.Equal(501, w.StatusCode, "3.0 infers maxHeight from maxWidth", t)
+}
+
+func TestCommandHandlerSchemeLimits(t *testing.T) {
+	var u, _ = url.Parse("http://example.com")
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	h.V3WebPathPrefix = "/foo/v3"
+	h.BaseURL = u
+	h.FeatureSet = iiif.AllFeatures()
+	h.SchemeMaximums = map[string]img.Constraint{
+		"restricted": nc(1000, 1000, 1000000),
+		"tiny":       nc(300, 300, 90000),
+	}
+	for scheme := range h.SchemeMaximums {
+		var err = h.AddSchemeMap(scheme, "file://"+rootDir()+"/docker/images/testfile")
+		assert.NilError(err, "adding the scheme map", t)
+	}
+
+	var get = func(id, path string) *fakehttp.ResponseWriter {
+		var w = fakehttp.NewResponseWriter()
+		var reqPath = "/foo/v3/" + url.PathEscape(id) + "/" + path
+		var req, _ = http.NewRequest("GET", reqPath, nil)
+		req.RequestURI = reqPath
+		h.IIIF3Route(w, req)
+		return w
+	}
+
+	// The image is smaller than the scheme's maximums, so its info lists none
+	var w = get("restricted://test-world-link.jp2", "full/^1200,/0/default.jpg")
+	assert.Equal(501, w.StatusCode, "upscaling beyond the scheme's limits", t)
+
+	// This image's info.json sidecar lists larger maximums than the scheme's,
+	// and a 3.0 request without a caret isn't an upscale
+	w = get("tiny://test-world.jp2", "full/400,/0/default.jpg")
+	assert.Equal(501, w.StatusCode, "the scheme's limits apply despite the sidecar's maximums", t)
+}
+
+func TestLinkHeaders(t *testing.T) {
+	var info = &iiif.Info{ID: "http://example.com/iiif/foo.jp2", Width: 800, Height: 400}
+	var u, _ = iiif.NewURL("foo.jp2/pct:0,0,100,100/,200/360/native.jpg")
+	var h = NewImageHandler(rootDir(), "/iiif")
+	h.FeatureSet = iiif.AllFeatures()
+
+	var w = fakehttp.NewResponseWriter()
+	h.sendLinkHeaders(w, u, info, unlimited)
+	var expected = []string{
+		`<http://example.com/iiif/foo.jp2/full/400,/0/default.jpg>;rel="canonical"`,
+		`<http://iiif.io/api/image/2/level2.json>;rel="profile"`,
+	}
+	if diff := cmp.Diff(expected, w.Headers["Link"]); diff != "" {
+		t.Errorf("link headers: %s", diff)
+	}
+
+	h.FeatureSet.CanonicalLinkHeader = false
+	h.FeatureSet.ProfileLinkHeader = false
+	w = fakehttp.NewResponseWriter()
+	h.sendLinkHeaders(w, u, info, unlimited)
+	assert.Equal(0, len(w.Headers["Link"]), "no link headers unless the features are enabled", t)
+}
+
+func TestMaxSizeWidthLimit(t *testing.T) {
+	// A 2.x "max" is never an upscale, even with sizeAboveFull, so a width limit
+	// larger than the image doesn't change its size.  The canonical redirect
+	// reveals the computed size without a decode.
+	var w = fakehttp.NewResponseWriter()
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/"
+	var req, _ = http.NewRequest("GET", "/foo/bar/"+imgid+"full/max/0/default.jpg", nil)
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	h.BaseURL, _ = url.Parse("http://example.com")
+	h.FeatureSet = iiif.AllFeatures()
+	h.Maximums.Width = 6000
+	h.CanonicalRedirect = true
+	h.IIIFRoute(w, req)
+	assert.Equal(301, w.StatusCode, "max is redirected to its canonical form", t)
+	assert.Equal("http://example.com/foo/bar/"+imgid+"full/full/0/default.jpg",
+		w.Headers.Get("Location"), "max is the image's native size", t)
+}
+
+func TestCanonicalRedirect(t *testing.T) {
+	var request = func(path string, redirect bool) *fakehttp.ResponseWriter {
+		var w = fakehttp.NewResponseWriter()
+		var req, _ = http.NewRequest("GET", "/foo/bar/"+path, nil)
+		var h = NewImageHandler(rootDir(), "/foo/bar")
+		h.BaseURL, _ = url.Parse("http://example.com")
+		h.CanonicalRedirect = redirect
+		h.IIIFRoute(w, req)
+		return w
+	}
+
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/"
+	var w = request(imgid+"pct:0,0,50,50/!200,200/0/default.jpg?download", true)
+	assert.Equal(301, w.StatusCode, "non-canonical request is redirected", t)
+	assert.Equal("http://example.com/foo/bar/"+imgid+"0,0,400,200/200,/0/default.jpg?download",
+		w.Headers.Get("Location"), "redirect goes to the canonical URL", t)
+
+	w = request(imgid+"pct:0,0,50,50/!200,200/0/default.jpg", false)
+	assert.True(w.StatusCode != 301, "no redirect unless it's enabled", t)
+}
+
+func TestCanonicalRedirectInvalid(t *testing.T) {
+	var h = NewImageHandler(rootDir(), "/foo/bar")
+	h.V3WebPathPrefix = "/foo/v3"
+	h.BaseURL, _ = url.Parse("http://example.com")
+	h.FeatureSet = iiif.AllFeatures()
+	h.CanonicalRedirect = true
+	var listed = iiif.FeatureSet0()
+	listed.SizeByWhListed = true
+	h.SchemeFeatures = map[string]*iiif.FeatureSet{"listed": listed}
+	var err = h.AddSchemeMap("listed", "file://"+rootDir()+"/docker/images/testfile")
+	assert.NilError(err, "adding the scheme map", t)
+
+	var request = func(path string, route func(http.ResponseWriter, *http.Request)) *fakehttp.ResponseWriter {
+		var w = fakehttp.NewResponseWriter()
+		var req, _ = http.NewRequest("GET", path, nil)
+		route(w, req)
+		return w
+	}
+
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/"
+	var w = request("/foo/v3/"+imgid+"0,0,40,40/80,/0/default.jpg", h.IIIF3Route)
+	assert.Equal(400, w.StatusCode, "3.0 upscales without a caret aren't redirected", t)
+
+	// The canonical form, "full/400,", isn't a listed size
+	w = request("/foo/bar/"+url.PathEscape("listed://test-world-link.jp2")+"/full/400,200/0/default.jpg", h.IIIFRoute)
+	assert.True(w.StatusCode != 301, "no redirect to an unsupported canonical form", t)
+	assert.True(w.StatusCode != 501, "the listed size is still served", t)
+}
+
+func TestCacheUpscaleNotAllowed(t *testing.T) {
+	tileCache, _ = lru.New2Q(10)
+	defer func() { tileCache = nil }()
+
+	// Stand in for a cached 2.x upscale, which has the same key as the 3.0
+	// request without a caret
+	var imgid = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2"
+	tileCache.Add(imgid+"/0,0,40,40/80,/0/default.jpg", []byte("upscaled tile"))
+
+	var w = dorequest3(imgid+"/0,0,40,40/^80,/0/default.jpg", "", t)
+	assert.Equal("upscaled tile", string(w.Output), "3.0 upscales with a caret are served from the cache", t)
+	w = dorequest3(imgid+"/0,0,40,40/80,/0/default.jpg", "", t)
+	assert.Equal(400, w.StatusCode, "3.0 upscales without a caret are an error despite the cache", t)
+}
+
+func TestCacheKey(t *testing.T) {
+	tileCache, _ = lru.New2Q(10)
+	defer func() { tileCache = nil }()
+
+	var info = &iiif.Info{Width: 800, Height: 400}
+	var key = func(path string, v iiif.Version) string {
+		var u, _ = iiif.NewVersionedURL(path, v)
+		return cacheKey(u, info, unlimited)
+	}
+	var expected = "foo.jp2/400,200,200,200/100,/0/default.jpg"
+	assert.Equal(expected, key("foo.jp2/400,200,200,200/100,/0/default.jpg", iiif.Version2), "canonical request", t)
+	assert.Equal(expected, key("foo.jp2/pct:50,50,25,50/!100,100/0/native.jpg", iiif.Version2), "equivalent 2.x request", t)
+	assert.Equal(expected, key("foo.jp2/400,200,200,200/100,100/0/default.jpg", iiif.Version3), "equivalent 3.0 request", t)
+	assert.Equal("", key("foo.jp2/full/full/0/default.png", iiif.Version2), "only JPGs are cached", t)
+	assert.Equal("", key("foo.jp2/full/^2000,/0/default.jpg", iiif.Version3), "large images aren't cached", t)
+}
+
 func TestCommandHandler404(t *testing.T) {
 	w := request("identifier/full/full/0/default.jpg", t)
 	assert.Equal(404, w.StatusCode, "Valid command on nonexistent file returns 404", t)
@@ -192,6 +562,11 @@ func TestCommandHandler(t *testing.T) {
 	assert.Equal(-1, w.StatusCode, "Valid command request doesn't explicitly set status code", t)
 }
 
+func TestCommandHandlerRegionOutsideImage(t *testing.T) {
+	w := request("docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/800,0,10,10/full/0/default.jpg", t)
+	assert.Equal(400, w.StatusCode, "Region entirely outside the image is a bad request", t)
+}
+
 func TestCommandHandlerInvalidSize(t *testing.T) {
 	imgid := "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2/pct:10,10,80,80/full/0/default.jpg"
 	areaConstraint := nc(math.MaxInt32, math.MaxInt32, 480)
@@ -294,3 +669,60 @@ func TestIDToURL(t *testing.T) {
 		})
 	}
 }
+
+func domanifest(path, v3Path string, t *testing.T) *fakehttp.ResponseWriter {
+	u, _ := url.Parse("http://example.com")
+	w := fakehttp.NewResponseWriter()
+	reqPath := "/foo/manifest/" + path
+	req, err := http.NewRequest("get", reqPath, strings.NewReader(""))
+	if err != nil {
+		t.Errorf("Unable to create fake request: %s", err)
+	}
+	req.RequestURI = reqPath
+
+	h := NewImageHandler(rootDir(), "/foo/bar")
+	h.V3WebPathPrefix = v3Path
+	h.ManifestPathPrefix = "/foo/manifest"
+	h.BaseURL = u
+	h.ManifestRoute(w, req)
+
+	return w
+}
+
+func TestManifestRoute(t *testing.T) {
+	var id = "docker%2Fimages%2Ftestfile%2Ftest-world-link.jp2"
+	w := domanifest(id, "", t)
+	assert.Equal(-1, w.StatusCode, "Valid manifest request doesn't explicitly set status code", t)
+	assert.Equal("application/json", w.Headers.Get("Content-Type"), "content type", t)
+
+	var m iiif.Manifest
+	assert.NilError(json.Unmarshal(w.Output, &m), "unmarshal doesn't throw an error", t)
+	assert.Equal("http://example.com/foo/manifest/"+id, m.ID, "manifest id", t)
+	if diff := cmp.Diff(iiif.LanguageMap{"none": {"test-world-link.jp2"}}, m.Label); diff != "" {
+		t.Errorf("label: %s", diff)
+	}
+	var c = m.Items[0]
+	assert.Equal(800, c.Width, "canvas width", t)
+	assert.Equal(400, c.Height, "canvas height", t)
+	var svc = c.Items[0].Items[0].Body.Service[0]
+	assert.Equal("http://example.com/foo/bar/"+id, svc.LDID, "2.x service id", t)
+
+	w = domanifest(id, "/foo/v3", t)
+	assert.NilError(json.Unmarshal(w.Output, &m), "unmarshal doesn't throw an error", t)
+	svc = m.Items[0].Items[0].Items[0].Body.Service[0]
+	assert.Equal("http://example.com/foo/v3/"+id, svc.ID, "3.0 service id", t)
+	assert.Equal("ImageService3", svc.Type, "3.0 service type", t)
+
+	w = domanifest("docker%2Fimages%2Ftestfile%2Fnope.jp2", "", t)
+	assert.Equal(404, w.StatusCode, "missing images are a 404", t)
+}
+
+func TestManifestRouteSidecar(t *testing.T) {
+	w := domanifest("docker%2Fimages%2Ftestfile%2Ftest-world.jp2", "", t)
+	var m iiif.Manifest
+	assert.NilError(json.Unmarshal(w.Output, &m), "unmarshal doesn't throw an error", t)
+	if diff := cmp.Diff(iiif.LanguageMap{"en": {"The World"}}, m.Label); diff != "" {
+		t.Errorf("label: %s", diff)
+	}
+	assert.Equal(1, len(m.Metadata), "sidecar metadata", t)
+}
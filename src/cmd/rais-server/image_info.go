@@ -7,3 +7,8 @@ type ImageInfo struct {
 	TileWidth, TileHeight int
 	Levels                int
 }
+
+// infoOverride holds the raw JSON of an image's info.json override so it can
+// be cached alongside ImageInfo data.  It's kept as JSON rather than a parsed
+// iiif.Info since handlers alter the info they're given.
+type infoOverride []byte
@@ -6,17 +6,20 @@
 	"net/http"
 	"net/url"
 	"path"
+	"rais/src/auth"
 	"rais/src/cmd/rais-server/internal/servers"
+	"rais/src/goimage"
 	"rais/src/iiif"
 	"rais/src/img"
 	"rais/src/openjpeg"
 	"rais/src/plugins"
+	"rais/src/transform"
 	"rais/src/version"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/spf13/viper"
 	"github.com/uoregon-libraries/gopkg/interrupts"
 	"github.com/uoregon-libraries/gopkg/logger"
@@ -51,10 +54,10 @@ func main() {
 		LoadPlugins(Logger, strings.Split(pluginList, ","))
 	}
 
-	// Register our JP2 decoder after plugins have been loaded to allow plugins
-	// to handle images - for instance, we might want a pyramidal tiff plugin or
-	// something one day
-	img.RegisterDecodeHandler(decodeJP2)
+	// Register our decoder after plugins have been loaded to allow plugins to
+	// handle images - for instance, we might want a pyramidal tiff plugin or
+	// something one day.  Ours doesn't skip any images, so it has to be last.
+	img.RegisterDecodeHandler(decodeImage)
 
 	// File streamer for handling images on the local filesystem
 	img.RegisterStreamReader(fileStreamReader)
@@ -74,14 +77,74 @@ func main() {
 		Logger.Warnf("WebPath %q cleaned; using %q instead", webPath, p2)
 		webPath = p2
 	}
+	v3WebPath := viper.GetString("IIIF3WebPath")
+	if v3WebPath != "" {
+		p3 := path.Clean(v3WebPath)
+		if v3WebPath != p3 {
+			Logger.Warnf("IIIF 3.0 WebPath %q cleaned; using %q instead", v3WebPath, p3)
+			v3WebPath = p3
+		}
+		if v3WebPath == webPath {
+			Logger.Fatalf("IIIF 3.0 WebPath cannot be the same as the 2.x WebPath (%q)", webPath)
+		}
+	}
+	manifestWebPath := viper.GetString("ManifestWebPath")
+	if manifestWebPath != "" {
+		pm := path.Clean(manifestWebPath)
+		if manifestWebPath != pm {
+			Logger.Warnf("Manifest WebPath %q cleaned; using %q instead", manifestWebPath, pm)
+			manifestWebPath = pm
+		}
+		if manifestWebPath == webPath || manifestWebPath == v3WebPath {
+			Logger.Fatalf("Manifest WebPath cannot be the same as an IIIF WebPath (%q)", manifestWebPath)
+		}
+	}
+	authWebPath := viper.GetString("AuthWebPath")
+	if authWebPath != "" {
+		pa := path.Clean(authWebPath)
+		if authWebPath != pa {
+			Logger.Warnf("Auth WebPath %q cleaned; using %q instead", authWebPath, pa)
+			authWebPath = pa
+		}
+		if authWebPath == webPath || authWebPath == v3WebPath || authWebPath == manifestWebPath {
+			Logger.Fatalf("Auth WebPath cannot be the same as another WebPath (%q)", authWebPath)
+		}
+	}
 	address := viper.GetString("Address")
 	adminAddress := viper.GetString("AdminAddress")
 
 	Logger.Debugf("Serving images from %q", tilePath)
 	ih := NewImageHandler(tilePath, webPath)
+	ih.V3WebPathPrefix = v3WebPath
+	ih.ManifestPathPrefix = manifestWebPath
 	ih.Maximums.Area = viper.GetInt64("ImageMaxArea")
 	ih.Maximums.Width = viper.GetInt("ImageMaxWidth")
 	ih.Maximums.Height = viper.GetInt("ImageMaxHeight")
+	ih.RotationFill, _ = parseHexColor(viper.GetString("RotationFill"))
+	transform.SetMaxWorkers(viper.GetInt("TransformWorkers"))
+	openjpeg.SetDecodeThreads(viper.GetInt("DecodeThreads"))
+	openjpeg.SetMaxThreads(viper.GetInt("MaxDecodeThreads"))
+	goimage.SetMaxPixels(viper.GetInt64("MaxSourcePixels"))
+	ih.Bitonal, _ = parseBitonal()
+	ih.ColorMode, _ = img.ParseColorMode(viper.GetString("ColorManagement"))
+	ih.ScaleFilters, _ = parseScaleFilters(viper.GetString("ScaleFilter"), viper.GetString("TileScaleFilter"), viper.GetString("FullScaleFilter"))
+	ih.CanonicalRedirect = viper.GetBool("CanonicalRedirect")
+
+	if authWebPath != "" {
+		provider, err := auth.ParseLocalUsers(viper.GetString("AuthLocalUsers"))
+		if err != nil {
+			Logger.Fatalf("Error parsing AuthLocalUsers: %s", err)
+		}
+		if len(authPolicyPlugins) == 0 {
+			Logger.Warnf("IIIF Auth is enabled, but no AuthPolicy plugins are loaded: all images are unrestricted")
+		}
+		var ttl = time.Duration(viper.GetInt("AuthTokenSeconds")) * time.Second
+		ih.Auth = NewAuthHandler(authWebPath, pluginAuthPolicy, provider, ttl)
+		ih.Auth.AllowedOrigins, _ = parseAllowedOrigins(viper.GetString("AuthAllowedOrigins"))
+		if len(ih.Auth.AllowedOrigins) == 0 {
+			Logger.Warnf("IIIF Auth is enabled, but AuthAllowedOrigins is empty: no viewer can receive access tokens")
+		}
+	}
 
 	// Check for scheme remapping configuration - if it exists, it's the final id-to-URL handler
 	schemeMapConfig := viper.GetString("SchemeMap")
@@ -92,6 +155,21 @@ func main() {
 		}
 	}
 
+	ih.Rights = iiif.Rights{
+		Attribution: viper.GetString("RightsAttribution"),
+		License:     viper.GetString("RightsLicense"),
+		Logo:        viper.GetString("RightsLogo"),
+	}
+	err := viper.UnmarshalKey("SchemeRights", &ih.SchemeRights)
+	if err != nil {
+		Logger.Fatalf("Error parsing SchemeRights: %s", err)
+	}
+	for scheme := range ih.SchemeRights {
+		if _, ok := ih.schemeMap[scheme]; !ok {
+			Logger.Warnf("SchemeRights has defaults for %q, which isn't in the SchemeMap", scheme)
+		}
+	}
+
 	iiifBaseURL := viper.GetString("IIIFBaseURL")
 	if iiifBaseURL != "" {
 		baseURL, _ := url.Parse(iiifBaseURL)
@@ -99,29 +177,70 @@ func main() {
 		ih.BaseURL = baseURL
 	}
 
+	var featureWarnings []string
+	var server = serverFeatures()
 	capfile := viper.GetString("CapabilitiesFile")
 	if capfile != "" {
-		ih.FeatureSet = &iiif.FeatureSet{}
-		_, err := toml.DecodeFile(capfile, &ih.FeatureSet)
-		if err != nil {
-			Logger.Fatalf("Invalid file or formatting in capabilities file '%s'", capfile)
-		}
+		ih.FeatureSet, featureWarnings = mustLoadCapabilities(capfile, server)
 		Logger.Debugf("Setting IIIF capabilities from file '%s'", capfile)
+	} else {
+		// Without a capabilities file, we advertise everything the server can do
+		// except GIF output, which is generally too slow for production use
+		var fs = *server
+		fs.Gif = false
+		ih.FeatureSet = &fs
+	}
+
+	var limits map[string]schemeLimits
+	err = viper.UnmarshalKey("SchemeLimits", &limits)
+	if err != nil {
+		Logger.Fatalf("Error parsing SchemeLimits: %s", err)
+	}
+	var schemes []string
+	for scheme := range limits {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	for _, scheme := range schemes {
+		if _, ok := ih.schemeMap[scheme]; !ok {
+			Logger.Warnf("SchemeLimits has settings for %q, which isn't in the SchemeMap", scheme)
+		}
+		warnings := limits[scheme].apply(ih, scheme, server)
+		for _, w := range warnings {
+			featureWarnings = append(featureWarnings, fmt.Sprintf("%s: %s", scheme, w))
+		}
 	}
 
 	// Setup server info in our stats structure
 	stats.ServerStart = time.Now()
 	stats.RAISVersion = version.Version
+	stats.Decoding.ThreadsPerDecode = openjpeg.DecodeThreads()
+	stats.Decoding.MaxThreads = openjpeg.MaxThreads()
 
 	// Set up handlers / listeners
 	var pubSrv = servers.New("RAIS", address)
 	pubSrv.AddMiddleware(logMiddleware)
+	// The manifest and 3.0 routes have to be registered first, since they're
+	// likely to be subpaths of the 2.x route (e.g., "/iiif/3" vs. "/iiif")
+	if ih.ManifestPathPrefix != "" {
+		Logger.Infof("Serving IIIF Presentation 3.0 manifests under %q", ih.ManifestPathPrefix)
+		handle(pubSrv, ih.ManifestPathPrefix+"/", http.HandlerFunc(ih.ManifestRoute))
+	}
+	if ih.Auth != nil {
+		Logger.Infof("Serving IIIF Auth 2.0 services under %q", ih.Auth.PathPrefix)
+		handle(pubSrv, ih.Auth.PathPrefix+"/", ih.Auth)
+	}
+	if ih.V3WebPathPrefix != "" {
+		Logger.Infof("Serving IIIF Image API 3.0 requests under %q", ih.V3WebPathPrefix)
+		handle(pubSrv, ih.V3WebPathPrefix+"/", http.HandlerFunc(ih.IIIF3Route))
+	}
 	handle(pubSrv, ih.WebPathPrefix+"/", http.HandlerFunc(ih.IIIFRoute))
 	handle(pubSrv, "/", http.NotFoundHandler())
 
 	var admSrv = servers.New("RAIS Admin", adminAddress)
 	admSrv.AddMiddleware(logMiddleware)
 	admSrv.HandleExact("/admin/stats.json", stats)
+	admSrv.HandleExact("/admin/features.json", adminFeatures(ih, featureWarnings))
 	admSrv.HandlePrefix("/admin/cache/purge", http.HandlerFunc(adminPurgeCache))
 
 	interrupts.TrapIntTerm(shutdown)
@@ -168,6 +287,75 @@ func shutdown() {
 	wait.Done()
 }
 
+// mustLoadCapabilities reads and validates a capabilities file, returning
+// its FeatureSet and any warnings.  Any errors are fatal.
+func mustLoadCapabilities(capfile string, server *iiif.FeatureSet) (*iiif.FeatureSet, []string) {
+	fs, unknown, err := loadCapabilities(capfile)
+	if err != nil {
+		Logger.Fatalf("Invalid file or formatting in capabilities file '%s': %s", capfile, err)
+	}
+
+	var warnings []string
+	for _, key := range unknown {
+		warnings = append(warnings, fmt.Sprintf("unknown capability %q", key))
+	}
+	errs, w := validateFeatures(fs, server)
+	warnings = append(warnings, w...)
+	for _, w := range warnings {
+		Logger.Warnf("Capabilities file '%s': %s", capfile, w)
+	}
+	for _, e := range errs {
+		Logger.Errorf("Capabilities file '%s': %s", capfile, e)
+	}
+	if len(errs) > 0 {
+		Logger.Fatalf("Capabilities file '%s' claims features this server can't support", capfile)
+	}
+
+	return fs, warnings
+}
+
+// schemeLimits holds the settings which replace the global capabilities and
+// size limits for images whose IDs use a particular scheme
+type schemeLimits struct {
+	CapabilitiesFile string
+	ImageMaxWidth    int
+	ImageMaxHeight   int
+	ImageMaxArea     int64
+}
+
+// apply sets up ih's per-scheme features and maximums for the given scheme,
+// returning any capabilities file warnings.  Settings which aren't specified
+// are inherited from the global configuration.
+func (l schemeLimits) apply(ih *ImageHandler, scheme string, server *iiif.FeatureSet) []string {
+	scheme = strings.ToLower(scheme)
+	var warnings []string
+	if l.CapabilitiesFile != "" {
+		if ih.SchemeFeatures == nil {
+			ih.SchemeFeatures = make(map[string]*iiif.FeatureSet)
+		}
+		ih.SchemeFeatures[scheme], warnings = mustLoadCapabilities(l.CapabilitiesFile, server)
+	}
+
+	var max = ih.Maximums
+	if l.ImageMaxWidth > 0 {
+		max.Width = l.ImageMaxWidth
+	}
+	if l.ImageMaxHeight > 0 {
+		max.Height = l.ImageMaxHeight
+	}
+	if l.ImageMaxArea > 0 {
+		max.Area = l.ImageMaxArea
+	}
+	if max != ih.Maximums {
+		if ih.SchemeMaximums == nil {
+			ih.SchemeMaximums = make(map[string]img.Constraint)
+		}
+		ih.SchemeMaximums[scheme] = max
+	}
+
+	return warnings
+}
+
 func parseSchemeMap(ih *ImageHandler, schemeMapConfig string) error {
 	var confs = strings.Fields(schemeMapConfig)
 	for _, conf := range confs {
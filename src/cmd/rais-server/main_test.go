@@ -1,6 +1,12 @@
 package main
 
 import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"rais/src/iiif"
+	"rais/src/img"
+	"rais/src/transform"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -48,3 +54,89 @@ func TestParseSchemeMap(t *testing.T) {
 		})
 	}
 }
+
+func TestParseHexColor(t *testing.T) {
+	var tests = map[string]struct {
+		input    string
+		hasError bool
+		expected color.RGBA
+	}{
+		"white":      {input: "#ffffff", expected: color.RGBA{255, 255, 255, 255}},
+		"no hash":    {input: "1a2B3c", expected: color.RGBA{0x1a, 0x2b, 0x3c, 255}},
+		"short":      {input: "#fff", hasError: true},
+		"not hex":    {input: "#gggggg", hasError: true},
+		"with alpha": {input: "#ffffff00", hasError: true},
+		"empty":      {input: "", hasError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var c, err = parseHexColor(tc.input)
+			if err == nil && tc.hasError {
+				t.Errorf("expected error, got nil")
+			}
+			if err != nil && !tc.hasError {
+				t.Errorf("expected no error, got %s", err)
+			}
+			if c != tc.expected {
+				t.Errorf("expected %#v, got %#v", tc.expected, c)
+			}
+		})
+	}
+}
+
+func TestSchemeLimitsApply(t *testing.T) {
+	var capfile = filepath.Join(t.TempDir(), "caps.toml")
+	var err = os.WriteFile(capfile, []byte("Default = true\nJpg = true\nSizeByWhListed = true\n"), 0644)
+	if err != nil {
+		t.Fatalf("writing capabilities: %s", err)
+	}
+
+	var ih = NewImageHandler("/tilepath", "/iiif")
+	ih.Maximums = img.Constraint{Width: 5000, Height: 6000, Area: 30000000}
+	schemeLimits{ImageMaxWidth: 1000}.apply(ih, "Restricted", iiif.AllFeatures())
+	schemeLimits{CapabilitiesFile: capfile}.apply(ih, "level0", iiif.AllFeatures())
+
+	var diff = cmp.Diff(map[string]img.Constraint{"restricted": {Width: 1000, Height: 6000, Area: 30000000}}, ih.SchemeMaximums)
+	if diff != "" {
+		t.Errorf("unset maximums are inherited: %s", diff)
+	}
+	if ih.SchemeFeatures["level0"] == nil || ih.SchemeFeatures["level0"].SizeByW {
+		t.Errorf("level0 scheme features should come from the capabilities file, got %#v", ih.SchemeFeatures["level0"])
+	}
+	if _, ok := ih.SchemeFeatures["restricted"]; ok {
+		t.Errorf("restricted scheme shouldn't have its own features")
+	}
+}
+
+func TestParseScaleFilters(t *testing.T) {
+	var tests = map[string]struct {
+		def, tile, full string
+		hasError        bool
+		expected        img.ScaleFilters
+	}{
+		"default only": {def: "lanczos3", expected: img.ScaleFilters{Tile: transform.Lanczos3, Full: transform.Lanczos3}},
+		"per class":    {def: "bilinear", full: "Lanczos3", expected: img.ScaleFilters{Tile: transform.Bilinear, Full: transform.Lanczos3}},
+		"tile":         {def: "lanczos3", tile: "catmullrom", expected: img.ScaleFilters{Tile: transform.CatmullRom, Full: transform.Lanczos3}},
+		"bad default":  {def: "nearest", hasError: true},
+		"bad full":     {def: "bilinear", full: "box", hasError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var actual, err = parseScaleFilters(tc.def, tc.tile, tc.full)
+			if tc.hasError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
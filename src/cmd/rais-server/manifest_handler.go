@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"rais/src/iiif"
+	"rais/src/img"
+	"strings"
+)
+
+// ManifestRoute answers requests for a minimal IIIF Presentation 3.0
+// manifest describing a single image.  The image's ID is everything after
+// ManifestPathPrefix, and the manifest's image service points at the 3.0 path
+// if one is configured, otherwise at the 2.x path.
+func (ih *ImageHandler) ManifestRoute(w http.ResponseWriter, req *http.Request) {
+	var id = iiif.URLToID(strings.TrimPrefix(req.URL.Path, ih.ManifestPathPrefix+"/"))
+	if id == "" {
+		http.NotFound(w, req)
+		return
+	}
+
+	res, info, e := ih.getImageData(id)
+	if e != nil {
+		if e.Code != 404 {
+			Logger.Errorf("Error getting image and/or IIIF Info for %q: %s", id, e.Message)
+		}
+		http.Error(w, e.Message, e.Code)
+		return
+	}
+	defer res.Destroy()
+
+	var base = ih.BaseURL
+	if base == nil {
+		base = getRequestURL(req)
+	}
+
+	var webPath, v = ih.WebPathPrefix, iiif.Version2
+	if ih.V3WebPathPrefix != "" {
+		webPath, v = ih.V3WebPathPrefix, iiif.Version3
+	}
+	var serviceURL = &url.URL{Scheme: base.Scheme, Host: base.Host, Path: webPath}
+	info.ID = serviceURL.String() + "/" + id.Escaped()
+	var manifestURL = &url.URL{Scheme: base.Scheme, Host: base.Host, Path: ih.ManifestPathPrefix}
+	var manifestID = manifestURL.String() + "/" + id.Escaped()
+
+	var m = iiif.NewManifest(manifestID, info, v, ih.loadManifestDescription(res), path.Base(string(id)))
+	jsonData, err := marshalInfo(m)
+	if err != nil {
+		http.Error(w, err.Message, err.Code)
+		return
+	}
+
+	ct := "application/json"
+	if acceptsLD(req) {
+		ct = `application/ld+json;profile="` + iiif.ContextPresentation3 + `"`
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(jsonData)
+}
+
+// loadManifestDescription reads the optional "-manifest.json" sidecar stored
+// alongside an image.  Like info overrides, a missing or invalid sidecar just
+// means there's no description.
+func (ih *ImageHandler) loadManifestDescription(res *img.Resource) *iiif.ManifestDescription {
+	var data, u = ih.readSidecar(res, "-manifest.json")
+	if data == nil {
+		return nil
+	}
+
+	Logger.Debugf("Loading manifest description from sidecar file (%s)", u)
+
+	var desc = new(iiif.ManifestDescription)
+	var err = json.Unmarshal(data, desc)
+	if err != nil {
+		Logger.Errorf("Cannot parse JSON manifest sidecar %q: %s", u, err)
+		return nil
+	}
+
+	return desc
+}
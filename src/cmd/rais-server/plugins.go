@@ -7,7 +7,9 @@
 	"os"
 	"path/filepath"
 	"plugin"
+	"rais/src/auth"
 	"rais/src/iiif"
+	"rais/src/plugins"
 	"reflect"
 	"sort"
 	"strings"
@@ -19,6 +21,7 @@
 var teardownPlugins []func()
 var purgeCachePlugins []func()
 var expireCachedImagePlugins []func(iiif.ID)
+var authPolicyPlugins []func(iiif.ID, string) (auth.Decision, error)
 
 // pluginsFor returns a list of all plugin files which matched the given
 // pattern.  Files are sorted by name.
@@ -131,6 +134,7 @@ func loadPlugin(fullpath string, l *logger.Logger) error {
 	var wrapHandler func(string, http.Handler) (http.Handler, error)
 	var prgCache func()
 	var expCachedImg func(iiif.ID)
+	var authPolicy func(iiif.ID, string) (auth.Decision, error)
 
 	pw.loadPluginFn("SetLogger", &log)
 	pw.loadPluginFn("Initialize", &initialize)
@@ -138,6 +142,7 @@ func loadPlugin(fullpath string, l *logger.Logger) error {
 	pw.loadPluginFn("WrapHandler", &wrapHandler)
 	pw.loadPluginFn("PurgeCaches", &prgCache)
 	pw.loadPluginFn("ExpireCachedImage", &expCachedImg)
+	pw.loadPluginFn("AuthPolicy", &authPolicy)
 
 	if len(pw.errors) != 0 {
 		return errors.New(strings.Join(pw.errors, ", "))
@@ -179,6 +184,9 @@ func loadPlugin(fullpath string, l *logger.Logger) error {
 	if expCachedImg != nil {
 		expireCachedImagePlugins = append(expireCachedImagePlugins, expCachedImg)
 	}
+	if authPolicy != nil {
+		authPolicyPlugins = append(authPolicyPlugins, authPolicy)
+	}
 
 	// Add info to stats
 	stats.Plugins = append(stats.Plugins, plugStats{
@@ -188,3 +196,22 @@ func loadPlugin(fullpath string, l *logger.Logger) error {
 
 	return nil
 }
+
+// pluginAuthPolicy asks each AuthPolicy plugin in turn for an access
+// decision, returning the first one that doesn't skip the request.  If no
+// plugin makes a decision, access is unrestricted.  A plugin error denies
+// access, since we'd rather hide an image than expose a restricted one.
+func pluginAuthPolicy(id iiif.ID, user string) auth.Decision {
+	for _, plug := range authPolicyPlugins {
+		var d, err = plug(id, user)
+		if err == nil {
+			return d
+		}
+		if err != plugins.ErrSkipped {
+			Logger.Errorf("Error getting auth policy for %q: %s", id, err)
+			return auth.Decision{Access: auth.Denied}
+		}
+	}
+
+	return auth.Decision{Access: auth.Full}
+}
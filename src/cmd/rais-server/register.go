@@ -2,16 +2,31 @@
 
 import (
 	"net/url"
+	"rais/src/goimage"
 	"rais/src/img"
 	"rais/src/openjpeg"
 	"rais/src/plugins"
 )
 
-// decodeJP2 is the last decoder function we try, after any plugins have been
-// tried, so we don't actually care about the URL - we just try it and see what
-// happens.
-func decodeJP2(s img.Streamer) (img.DecodeFunc, error) {
-	return func() (img.Decoder, error) { return openjpeg.NewJP2Image(s) }, nil
+// decodeImage is the last decoder function we try, after any plugins have
+// been tried, so it never skips an image.  JPEG, PNG, GIF, and TIFF sources
+// are identified by their leading bytes rather than extension, so cloud
+// objects without extensions work; anything else is handed to openjpeg.
+//
+// The format check waits until the image is actually decoded: resources are
+// created even for requests served entirely from the caches, and reading from
+// a cloud stream costs an extra request.
+func decodeImage(s img.Streamer) (img.DecodeFunc, error) {
+	return func() (img.Decoder, error) {
+		var ok, err = goimage.Detect(s)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return goimage.NewImage(s)
+		}
+		return openjpeg.NewJP2Image(s)
+	}, nil
 }
 
 // fileStreamReader is the last, and default, streamer for RAIS to try... it's
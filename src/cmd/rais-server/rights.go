@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"rais/src/iiif"
+	"rais/src/img"
+)
+
+// applyRights layers an image's rights data into its info.  From least to
+// most specific, the layers are the global defaults, the defaults for the
+// image ID's scheme, anything the info already has (e.g., from an override
+// file), and the image's "-rights.json" sidecar.
+func (ih *ImageHandler) applyRights(res *img.Resource, info *iiif.Info) {
+	var r = ih.Rights
+	var u, err = url.Parse(string(res.ID))
+	if err == nil {
+		r = r.Merge(ih.SchemeRights[u.Scheme])
+	}
+	info.SetRights(r.Merge(info.Rights()).Merge(ih.loadRightsSidecar(res)))
+}
+
+// loadRightsSidecar returns the rights data from an image's sidecar file.
+// The result is cached even if there's no sidecar, so images in remote
+// storage don't cost an extra request every time their info is needed.  The
+// rights cache is separate from the info cache so it can't push info data out.
+func (ih *ImageHandler) loadRightsSidecar(res *img.Resource) iiif.Rights {
+	if rightsCache != nil {
+		var data, ok = rightsCache.Get(res.ID)
+		if ok {
+			return data.(iiif.Rights)
+		}
+	}
+
+	var r iiif.Rights
+	var data, u = ih.readSidecar(res, "-rights.json")
+	if data != nil {
+		Logger.Debugf("Loading rights data from sidecar file (%s)", u)
+		var err = json.Unmarshal(data, &r)
+		if err != nil {
+			Logger.Errorf("Cannot parse JSON rights sidecar %q: %s", u, err)
+			r = iiif.Rights{}
+		}
+	}
+
+	if rightsCache != nil {
+		rightsCache.Add(res.ID, r)
+	}
+	return r
+}
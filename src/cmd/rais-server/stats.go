@@ -2,6 +2,7 @@
 
 import (
 	"encoding/json"
+	"rais/src/openjpeg"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -47,6 +48,14 @@ func (cs *cacheStats) Set() {
 	atomic.AddUint64(&cs.SetCount, 1)
 }
 
+// decodeStats reports the openjpeg threading limits and how many threads
+// are reserved by in-progress decodes
+type decodeStats struct {
+	ThreadsPerDecode int
+	MaxThreads       int
+	ThreadsInUse     int
+}
+
 // serverStats holds a bunch of global data.  This is only threadsafe when
 // calling functions, so don't directly manipulate anything except when you
 // know only one thread can possibly exist!  (e.g., when first setting up the
@@ -55,6 +64,7 @@ type serverStats struct {
 	m           sync.Mutex
 	InfoCache   cacheStats
 	TileCache   cacheStats
+	Decoding    decodeStats
 	Plugins     []plugStats
 	RAISVersion string
 	ServerStart time.Time
@@ -81,6 +91,7 @@ func (s *serverStats) calculateDerivedStats() {
 		s.TileCache.setHitPercent()
 		s.TileCache.Length = tileCache.Len()
 	}
+	s.Decoding.ThreadsInUse = openjpeg.ThreadsInUse()
 
 	s.m.Unlock()
 }
@@ -0,0 +1,287 @@
+// Package goimage decodes JPEG, PNG, GIF, and TIFF sources with Go's own
+// image packages, so simple collections don't need ImageMagick.  Images are
+// read from any img.Streamer, so they can live in the cloud as easily as on
+// disk.  Embedded color profiles and resolution data aren't read.
+package goimage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"rais/src/img"
+	"rais/src/transform"
+
+	// Register the formats we decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+)
+
+// signatures holds the leading bytes of each format we handle.  TIFF has one
+// per byte order; BigTIFF isn't supported by the Go decoder.
+var signatures = [][]byte{
+	{0xff, 0xd8, 0xff},          // JPEG
+	[]byte("\x89PNG\r\n\x1a\n"), // PNG
+	[]byte("GIF87a"),
+	[]byte("GIF89a"),
+	{'I', 'I', 0x2a, 0x00}, // Little-endian TIFF
+	{'M', 'M', 0x00, 0x2a}, // Big-endian TIFF
+}
+
+// DefaultMaxPixels is the default limit on a source image's pixel count
+const DefaultMaxPixels = 100_000_000
+
+// ErrTooLarge is returned by NewImage when the source image has more pixels
+// than the configured limit
+var ErrTooLarge = errors.New("source image exceeds the pixel limit")
+
+// maxPixels is the largest source image NewImage accepts.  These formats are
+// always decoded in full, so without a limit a small file claiming enormous
+// dimensions could force a huge allocation.
+var maxPixels int64 = DefaultMaxPixels
+
+// SetMaxPixels sets the largest source image, in pixels, NewImage accepts.
+// Zero removes the limit.
+func SetMaxPixels(n int64) {
+	maxPixels = max(n, 0)
+}
+
+// MaxPixels returns the source image pixel limit
+func MaxPixels() int64 {
+	return maxPixels
+}
+
+// Detect reports whether s starts with the signature of a format we can
+// decode, leaving the stream at its start
+func Detect(s img.Streamer) (bool, error) {
+	var _, err = s.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+
+	var header = make([]byte, 8)
+	var n int
+	n, err = io.ReadFull(s, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	_, err = s.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+
+	for _, sig := range signatures {
+		if bytes.HasPrefix(header[:n], sig) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Image implements img.Decoder for any format registered with Go's image
+// package.  None of these formats have tiles or resolution levels, so the
+// whole image is decoded before it's cropped and scaled.
+type Image struct {
+	streamer     img.Streamer
+	format       string
+	width        int
+	height       int
+	decodeWidth  int
+	decodeHeight int
+	decodeArea   image.Rectangle
+	filter       transform.Filter
+}
+
+// NewImage reads the image's header and returns a decode-ready Image, or
+// ErrTooLarge if the image has more pixels than the limit
+func NewImage(s img.Streamer) (*Image, error) {
+	var _, err = s.Seek(0, io.SeekStart)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	var conf image.Config
+	var format string
+	conf, format, err = image.DecodeConfig(bufio.NewReader(s))
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("reading image header: %w", err)
+	}
+	if maxPixels > 0 && int64(conf.Width)*int64(conf.Height) > maxPixels {
+		s.Close()
+		return nil, fmt.Errorf("%dx%d %s: %w", conf.Width, conf.Height, format, ErrTooLarge)
+	}
+
+	return &Image{streamer: s, format: format, width: conf.Width, height: conf.Height}, nil
+}
+
+// SetResizeWH sets the image to scale to the given width and height.  If one
+// dimension is 0, the decoded image will preserve the aspect ratio while
+// scaling to the non-zero dimension.
+func (i *Image) SetResizeWH(width, height int) {
+	i.decodeWidth = width
+	i.decodeHeight = height
+}
+
+// SetCrop sets the image crop area for decoding an image
+func (i *Image) SetCrop(r image.Rectangle) {
+	i.decodeArea = r
+}
+
+// SetScaleFilter sets the filter used when the cropped image has to be
+// resized to the requested dimensions
+func (i *Image) SetScaleFilter(f transform.Filter) {
+	i.filter = f
+}
+
+// Format returns the name of the source image's format, e.g., "jpeg"
+func (i *Image) Format() string {
+	return i.format
+}
+
+// GetWidth returns the image width
+func (i *Image) GetWidth() int {
+	return i.width
+}
+
+// GetHeight returns the image height
+func (i *Image) GetHeight() int {
+	return i.height
+}
+
+// GetTileWidth returns 0 since these formats have no tiles
+func (i *Image) GetTileWidth() int {
+	return 0
+}
+
+// GetTileHeight returns 0 since these formats have no tiles
+func (i *Image) GetTileHeight() int {
+	return 0
+}
+
+// GetLevels returns 1 since these formats only have a single resolution
+func (i *Image) GetLevels() int {
+	return 1
+}
+
+// DecodeImage decodes the full image, then crops and resizes it as requested
+func (i *Image) DecodeImage() (image.Image, error) {
+	i.computeDecodeParameters()
+
+	var _, err = i.streamer.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	var decoded image.Image
+	decoded, _, err = image.Decode(bufio.NewReader(i.streamer))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", i.format, err)
+	}
+
+	var area = i.decodeArea.Add(decoded.Bounds().Min).Intersect(decoded.Bounds())
+	if area.Empty() {
+		return nil, fmt.Errorf("crop %s is outside the image", i.decodeArea)
+	}
+	var m = crop(decoded, area)
+
+	if i.decodeWidth != area.Dx() || i.decodeHeight != area.Dy() {
+		var resized = transform.ScaleFilter(m, i.decodeWidth, i.decodeHeight, i.filter)
+		if resized == nil {
+			return nil, fmt.Errorf("unsupported image type %T", m)
+		}
+		m = resized
+	}
+
+	return m, nil
+}
+
+// computeDecodeParameters sets up decode area, decode width, and decode
+// height based on the image's dimensions
+func (i *Image) computeDecodeParameters() {
+	if i.decodeArea == image.ZR {
+		i.decodeArea = image.Rect(0, 0, i.width, i.height)
+	}
+
+	var w, h = i.decodeArea.Dx(), i.decodeArea.Dy()
+	switch {
+	case i.decodeWidth == 0 && i.decodeHeight == 0:
+		i.decodeWidth, i.decodeHeight = w, h
+	case i.decodeWidth == 0:
+		i.decodeWidth = max(1, i.decodeHeight*w/h)
+	case i.decodeHeight == 0:
+		i.decodeHeight = max(1, i.decodeWidth*h/w)
+	}
+}
+
+// crop copies the area r of m into a new image with its origin at 0,0.  The
+// image types the rest of RAIS understands (Gray, Gray16, RGBA, RGBA64, NRGBA,
+// and NRGBA64) are kept as-is; anything else, e.g., JPEG's YCbCr or GIF's
+// paletted images, is converted to RGBA, or NRGBA for paletted images with
+// transparency.
+func crop(m image.Image, r image.Rectangle) image.Image {
+	var b = image.Rect(0, 0, r.Dx(), r.Dy())
+	switch s := m.(type) {
+	case *image.Gray:
+		var d = image.NewGray(b)
+		copyRows(d.Pix, d.Stride, s.Pix[s.PixOffset(r.Min.X, r.Min.Y):], s.Stride, r.Dx(), r.Dy())
+		return d
+	case *image.Gray16:
+		var d = image.NewGray16(b)
+		copyRows(d.Pix, d.Stride, s.Pix[s.PixOffset(r.Min.X, r.Min.Y):], s.Stride, r.Dx()*2, r.Dy())
+		return d
+	case *image.RGBA:
+		var d = image.NewRGBA(b)
+		copyRows(d.Pix, d.Stride, s.Pix[s.PixOffset(r.Min.X, r.Min.Y):], s.Stride, r.Dx()*4, r.Dy())
+		return d
+	case *image.RGBA64:
+		var d = image.NewRGBA64(b)
+		copyRows(d.Pix, d.Stride, s.Pix[s.PixOffset(r.Min.X, r.Min.Y):], s.Stride, r.Dx()*8, r.Dy())
+		return d
+	case *image.NRGBA:
+		var d = image.NewNRGBA(b)
+		copyRows(d.Pix, d.Stride, s.Pix[s.PixOffset(r.Min.X, r.Min.Y):], s.Stride, r.Dx()*4, r.Dy())
+		return d
+	case *image.NRGBA64:
+		var d = image.NewNRGBA64(b)
+		copyRows(d.Pix, d.Stride, s.Pix[s.PixOffset(r.Min.X, r.Min.Y):], s.Stride, r.Dx()*8, r.Dy())
+		return d
+	case *image.Paletted:
+		if !opaque(s) {
+			var d = image.NewNRGBA(b)
+			for y := 0; y < r.Dy(); y++ {
+				for x := 0; x < r.Dx(); x++ {
+					d.Set(x, y, s.At(r.Min.X+x, r.Min.Y+y))
+				}
+			}
+			return d
+		}
+	}
+
+	var d = image.NewRGBA(b)
+	draw.Draw(d, b, m, r.Min, draw.Src)
+	return d
+}
+
+// copyRows copies rows of n bytes from src to dst
+func copyRows(dst []uint8, dstStride int, src []uint8, srcStride, n, rows int) {
+	for y := 0; y < rows; y++ {
+		copy(dst[y*dstStride:y*dstStride+n], src[y*srcStride:])
+	}
+}
+
+// opaque returns true if none of the colors in p's palette are transparent
+func opaque(p *image.Paletted) bool {
+	for _, c := range p.Palette {
+		if _, _, _, a := c.RGBA(); a != 0xffff {
+			return false
+		}
+	}
+	return true
+}
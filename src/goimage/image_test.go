@@ -0,0 +1,124 @@
+package goimage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"rais/src/img"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+	"golang.org/x/image/tiff"
+)
+
+// gradient returns an opaque test image whose red channel increases with x
+func gradient(w, h int) *image.RGBA {
+	var m = image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetRGBA(x, y, color.RGBA{uint8(x * 255 / (w - 1)), 0, uint8(y), 255})
+		}
+	}
+	return m
+}
+
+// stream writes data to a temp file and opens it
+func stream(t *testing.T, name string, data []byte) img.Streamer {
+	var path = filepath.Join(t.TempDir(), name)
+	var err = os.WriteFile(path, data, 0644)
+	assert.NilError(err, "writing "+name, t)
+	var s img.Streamer
+	s, err = img.NewFileStream(path)
+	assert.NilError(err, "opening "+name, t)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestFormats(t *testing.T) {
+	var src = gradient(64, 32)
+	var encoders = map[string]func(*bytes.Buffer) error{
+		"jpeg": func(b *bytes.Buffer) error { return jpeg.Encode(b, src, nil) },
+		"png":  func(b *bytes.Buffer) error { return png.Encode(b, src) },
+		"gif":  func(b *bytes.Buffer) error { return gif.Encode(b, src, nil) },
+		"tiff": func(b *bytes.Buffer) error { return tiff.Encode(b, src, nil) },
+	}
+
+	for format, encode := range encoders {
+		var buf = new(bytes.Buffer)
+		assert.NilError(encode(buf), format+": encoding", t)
+
+		// No extension, as with many cloud objects
+		var s = stream(t, "image", buf.Bytes())
+		var ok, err = Detect(s)
+		assert.NilError(err, format+": detect", t)
+		assert.True(ok, format+": detected", t)
+
+		var i *Image
+		i, err = NewImage(s)
+		assert.NilError(err, format+": NewImage", t)
+		assert.Equal(format, i.Format(), format+": format", t)
+		assert.Equal(64, i.GetWidth(), format+": width", t)
+		assert.Equal(32, i.GetHeight(), format+": height", t)
+
+		i.SetCrop(image.Rect(32, 0, 64, 32))
+		i.SetResizeWH(16, 0)
+		var m image.Image
+		m, err = i.DecodeImage()
+		assert.NilError(err, format+": DecodeImage", t)
+		assert.Equal(image.Rect(0, 0, 16, 16), m.Bounds(), format+": cropped and scaled", t)
+		var _, isRGBA = m.(*image.RGBA)
+		assert.True(isRGBA, format+": opaque images decode to RGBA", t)
+		var r, _, _, _ = m.At(0, 8).RGBA()
+		assert.True(r > 0x7000, format+": crop starts mid-gradient", t)
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	var ok, err = Detect(stream(t, "image.jp2", []byte{0, 0, 0, 0x0c, 'j', 'P', ' ', ' '}))
+	assert.NilError(err, "detect", t)
+	assert.False(ok, "JP2 isn't ours", t)
+
+	ok, err = Detect(stream(t, "tiny", []byte("GIF")))
+	assert.NilError(err, "short files aren't an error", t)
+	assert.False(ok, "a partial signature isn't a match", t)
+}
+
+func TestMaxPixels(t *testing.T) {
+	defer SetMaxPixels(MaxPixels())
+
+	var buf = new(bytes.Buffer)
+	assert.NilError(png.Encode(buf, gradient(64, 32)), "encoding", t)
+
+	SetMaxPixels(64*32 - 1)
+	var _, err = NewImage(stream(t, "image.png", buf.Bytes()))
+	assert.True(errors.Is(err, ErrTooLarge), "images over the limit are rejected", t)
+
+	SetMaxPixels(64 * 32)
+	_, err = NewImage(stream(t, "image.png", buf.Bytes()))
+	assert.NilError(err, "images at the limit are allowed", t)
+
+	SetMaxPixels(0)
+	_, err = NewImage(stream(t, "image.png", buf.Bytes()))
+	assert.NilError(err, "zero removes the limit", t)
+}
+
+func TestCropTransparentPalette(t *testing.T) {
+	var p = image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Transparent, color.White})
+	p.SetColorIndex(3, 3, 1)
+	var m = crop(p, image.Rect(2, 2, 4, 4))
+	var n, ok = m.(*image.NRGBA)
+	assert.True(ok, "transparent palettes become NRGBA", t)
+	assert.Equal(color.NRGBA{}, n.NRGBAAt(0, 0), "transparent pixel", t)
+	assert.Equal(color.NRGBA{255, 255, 255, 255}, n.NRGBAAt(1, 1), "white pixel", t)
+
+	var g = image.NewGray16(image.Rect(0, 0, 4, 4))
+	g.SetGray16(2, 1, color.Gray16{0x1234})
+	var c = crop(g, image.Rect(2, 1, 3, 2)).(*image.Gray16)
+	assert.Equal(color.Gray16{0x1234}, c.Gray16At(0, 0), "native types are copied as-is", t)
+}
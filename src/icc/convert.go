@@ -0,0 +1,227 @@
+package icc
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"rais/src/transform"
+	"sync"
+)
+
+// srgbMatrix holds the sRGB colorants, adapted to D50 as in the standard sRGB
+// profile, for converting linear sRGB to the PCS
+var srgbMatrix = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// srgbEncode converts a linear value in [0, 1] to the sRGB curve
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbDecode is the inverse of srgbEncode
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// encode8 maps linear values, quantized to 16 bits, to 8-bit sRGB
+var encode8 = sync.OnceValue(func() []uint8 {
+	var lut = make([]uint8, 65536)
+	for i := range lut {
+		lut[i] = uint8(math.Round(srgbEncode(float64(i)/65535) * 255))
+	}
+	return lut
+})
+
+// invert returns the inverse of m
+func invert(m [3][3]float64) [3][3]float64 {
+	var det = m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			var a, b = (j + 1) % 3, (j + 2) % 3
+			var c, d = (i + 1) % 3, (i + 2) % 3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv
+}
+
+// multiply returns a x b
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+// IsSRGB returns true if converting with the profile would make no visible
+// difference: its colorants and curves match sRGB's to within a fraction of
+// an 8-bit step
+func (p *Profile) IsSRGB() bool {
+	if p.ColorSpace == ColorSpaceRGB {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				if math.Abs(p.matrix[i][j]-srgbMatrix[i][j]) > 0.002 {
+					return false
+				}
+			}
+		}
+	}
+
+	var channels = 3
+	if p.ColorSpace == ColorSpaceGray {
+		channels = 1
+	}
+	for c := 0; c < channels; c++ {
+		for v := 0.0; v <= 1; v += 1.0 / 32 {
+			if math.Abs(p.trc[c](v)-srgbDecode(v)) > 0.001 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ConvertToSRGB converts m's pixels, in place, from the profile's color space
+// to sRGB.  RGB profiles require an *image.RGBA, *image.RGBA64,
+// *image.NRGBA, or *image.NRGBA64, and grayscale profiles an *image.Gray or
+// *image.Gray16.  Colors outside the sRGB gamut are clipped.
+func (p *Profile) ConvertToSRGB(m image.Image) error {
+	switch p.ColorSpace {
+	case ColorSpaceRGB:
+		var conv = multiply(invert(srgbMatrix), p.matrix)
+		switch i := m.(type) {
+		case *image.RGBA:
+			p.convertRGBA(i.Pix, i.Stride, i.Rect, 1, true, conv)
+			return nil
+		case *image.RGBA64:
+			p.convertRGBA(i.Pix, i.Stride, i.Rect, 2, true, conv)
+			return nil
+		case *image.NRGBA:
+			p.convertRGBA(i.Pix, i.Stride, i.Rect, 1, false, conv)
+			return nil
+		case *image.NRGBA64:
+			p.convertRGBA(i.Pix, i.Stride, i.Rect, 2, false, conv)
+			return nil
+		}
+	case ColorSpaceGray:
+		switch i := m.(type) {
+		case *image.Gray:
+			p.convertGray(i.Pix, i.Stride, i.Rect, 1)
+			return nil
+		case *image.Gray16:
+			p.convertGray(i.Pix, i.Stride, i.Rect, 2)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot convert %T with a %q profile", m, p.ColorSpace)
+}
+
+// linearTable returns the profile's curve c sampled at every value of the
+// given bit depth
+func (p *Profile) linearTable(c int, size int) []float64 {
+	var lut = make([]float64, size)
+	for i := range lut {
+		lut[i] = p.trc[c](float64(i) / float64(size-1))
+	}
+	return lut
+}
+
+// sample reads the 8- or 16-bit value at offset o
+func sample(pix []uint8, o, bps int) int {
+	if bps == 1 {
+		return int(pix[o])
+	}
+	return int(pix[o])<<8 | int(pix[o+1])
+}
+
+// store writes the linear value v, clipped to [0, 1], as an sRGB sample at
+// offset o
+func store(pix []uint8, o, bps int, v float64) {
+	v = min(max(v, 0), 1)
+	if bps == 1 {
+		pix[o] = encode8()[int(v*65535+0.5)]
+		return
+	}
+	var s = uint16(math.Round(srgbEncode(v) * 65535))
+	pix[o], pix[o+1] = uint8(s>>8), uint8(s)
+}
+
+// convertRGBA converts RGBA pixels with bps bytes per sample.  Premultiplied
+// color is unpremultiplied for conversion, since the tone curves aren't
+// linear.
+func (p *Profile) convertRGBA(pix []uint8, stride int, b image.Rectangle, bps int, premul bool, conv [3][3]float64) {
+	var maxval = 1<<(8*bps) - 1
+	var luts [3][]float64
+	for c := range luts {
+		luts[c] = p.linearTable(c, maxval+1)
+	}
+
+	transform.Parallel(b.Dy(), b.Dx(), func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row = pix[y*stride:]
+			for x := 0; x < b.Dx(); x++ {
+				var o = x * 4 * bps
+				var a = maxval
+				if premul {
+					a = sample(row, o+3*bps, bps)
+				}
+				if a == 0 {
+					continue
+				}
+
+				var in [3]float64
+				for c := range in {
+					var v = sample(row, o+c*bps, bps)
+					if a != maxval {
+						v = min(v*maxval/a, maxval)
+					}
+					in[c] = luts[c][v]
+				}
+
+				for c := 0; c < 3; c++ {
+					var v = conv[c][0]*in[0] + conv[c][1]*in[1] + conv[c][2]*in[2]
+					store(row, o+c*bps, bps, v)
+					if a != maxval {
+						var s = sample(row, o+c*bps, bps) * a / maxval
+						if bps == 1 {
+							row[o+c] = uint8(s)
+						} else {
+							row[o+c*2], row[o+c*2+1] = uint8(s>>8), uint8(s)
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+// convertGray converts grayscale pixels with bps bytes per sample: gray is
+// achromatic in every profile, so only the tone curve changes
+func (p *Profile) convertGray(pix []uint8, stride int, b image.Rectangle, bps int) {
+	var lut = p.linearTable(0, 1<<(8*bps))
+	transform.Parallel(b.Dy(), b.Dx(), func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row = pix[y*stride:]
+			for x := 0; x < b.Dx(); x++ {
+				store(row, x*bps, bps, lut[sample(row, x*bps, bps)])
+			}
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package icc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// jpegChunk is the most profile data one APP2 segment can hold: the segment
+// length field's limit minus the length itself, the "ICC_PROFILE\0"
+// identifier, and the chunk sequence bytes
+const jpegChunk = 65535 - 2 - 12 - 2
+
+// EmbedJPEG returns a copy of the encoded JPEG with the profile inserted as a
+// series of APP2 segments directly after the SOI marker
+func EmbedJPEG(jpg, profile []byte) ([]byte, error) {
+	if len(jpg) < 2 || jpg[0] != 0xFF || jpg[1] != 0xD8 {
+		return nil, errors.New("not a JPEG image")
+	}
+	var count = (len(profile) + jpegChunk - 1) / jpegChunk
+	if count > 255 {
+		return nil, errors.New("ICC profile is too large to embed in a JPEG")
+	}
+
+	var out = bytes.NewBuffer(make([]byte, 0, len(jpg)+len(profile)+count*18))
+	out.Write(jpg[:2])
+	for i := 0; i < count; i++ {
+		var chunk = profile[i*jpegChunk : min((i+1)*jpegChunk, len(profile))]
+		out.Write([]byte{0xFF, 0xE2})
+		binary.Write(out, binary.BigEndian, uint16(len(chunk)+16))
+		out.WriteString("ICC_PROFILE\x00")
+		out.Write([]byte{byte(i + 1), byte(count)})
+		out.Write(chunk)
+	}
+	out.Write(jpg[2:])
+	return out.Bytes(), nil
+}
+
+// pngSignature is the eight bytes every PNG starts with
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// EmbedPNG returns a copy of the encoded PNG with the profile in an iCCP
+// chunk, which has to come after IHDR and before any image data.  Go's PNG
+// encoder always writes IHDR first, so the chunk goes right after it.
+func EmbedPNG(png, profile []byte) ([]byte, error) {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if len(png) < ihdrEnd || !bytes.Equal(png[:8], pngSignature) || string(png[12:16]) != "IHDR" {
+		return nil, errors.New("not a PNG image")
+	}
+
+	var data = new(bytes.Buffer)
+	data.WriteString("ICC\x00\x00")
+	var zw = zlib.NewWriter(data)
+	zw.Write(profile)
+	zw.Close()
+
+	var chunk = new(bytes.Buffer)
+	binary.Write(chunk, binary.BigEndian, uint32(data.Len()))
+	chunk.WriteString("iCCP")
+	chunk.Write(data.Bytes())
+	binary.Write(chunk, binary.BigEndian, crc32.ChecksumIEEE(chunk.Bytes()[4:]))
+
+	var out = make([]byte, 0, len(png)+chunk.Len())
+	out = append(out, png[:ihdrEnd]...)
+	out = append(out, chunk.Bytes()...)
+	return append(out, png[ihdrEnd:]...), nil
+}
+
+// tiffICCTag is the TIFF tag holding an embedded ICC profile
+const tiffICCTag = 34675
+
+// EmbedTIFF returns a copy of the encoded TIFF with the profile added to its
+// first IFD.  The IFD is rewritten at the end of the file with the new tag,
+// followed by the profile; the original IFD is left in place, unreferenced,
+// so none of the other offsets in the file change.
+func EmbedTIFF(tif, profile []byte) ([]byte, error) {
+	if len(tif) < 8 {
+		return nil, errors.New("not a TIFF image")
+	}
+	var order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	switch string(tif[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF image")
+	}
+
+	var ifd = int(order.Uint32(tif[4:]))
+	if ifd+2 > len(tif) {
+		return nil, errors.New("invalid TIFF: IFD is out of bounds")
+	}
+	var n = int(order.Uint16(tif[ifd:]))
+	var entries = tif[ifd+2:]
+	if len(entries) < n*12+4 {
+		return nil, errors.New("invalid TIFF: IFD is truncated")
+	}
+
+	// Word-align the new IFD, then write it: entries are sorted by tag, and
+	// the ICC tag is higher than any tag Go's encoder writes, but we check
+	// anyway so a file which already has a profile doesn't get two
+	var out = append([]byte(nil), tif...)
+	if len(out)%2 == 1 {
+		out = append(out, 0)
+	}
+	var newIFD = len(out)
+	var profileOffset = newIFD + 2 + (n+1)*12 + 4
+
+	out = order.AppendUint16(out, uint16(n+1))
+	var added bool
+	for i := 0; i < n; i++ {
+		var entry = entries[i*12 : (i+1)*12]
+		var tag = order.Uint16(entry)
+		if tag == tiffICCTag {
+			return nil, errors.New("TIFF already has an ICC profile")
+		}
+		if tag > tiffICCTag && !added {
+			out = appendICCEntry(out, order, len(profile), profileOffset)
+			added = true
+		}
+		out = append(out, entry...)
+	}
+	if !added {
+		out = appendICCEntry(out, order, len(profile), profileOffset)
+	}
+	out = append(out, entries[n*12:n*12+4]...)
+	out = append(out, profile...)
+
+	order.PutUint32(out[4:], uint32(newIFD))
+	return out, nil
+}
+
+// appendICCEntry appends an IFD entry for an "undefined"-typed profile of
+// the given size at the given offset
+func appendICCEntry(b []byte, order binary.AppendByteOrder, size, offset int) []byte {
+	b = order.AppendUint16(b, tiffICCTag)
+	b = order.AppendUint16(b, 7)
+	b = order.AppendUint32(b, uint32(size))
+	return order.AppendUint32(b, uint32(offset))
+}
@@ -0,0 +1,231 @@
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+	"golang.org/x/image/tiff"
+)
+
+// buildProfile assembles a profile with the given color space and tags
+func buildProfile(space string, tags map[string][]byte) []byte {
+	var sigs []string
+	for sig := range tags {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+
+	var header = make([]byte, 128)
+	copy(header[16:], space)
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+
+	var table, data = new(bytes.Buffer), new(bytes.Buffer)
+	binary.Write(table, binary.BigEndian, uint32(len(tags)))
+	var offset = 128 + 4 + 12*len(tags)
+	for _, sig := range sigs {
+		table.WriteString(sig)
+		binary.Write(table, binary.BigEndian, []uint32{uint32(offset + data.Len()), uint32(len(tags[sig]))})
+		data.Write(tags[sig])
+	}
+
+	var p = append(append(header, table.Bytes()...), data.Bytes()...)
+	binary.BigEndian.PutUint32(p, uint32(len(p)))
+	return p
+}
+
+func fixed(v float64) uint32 {
+	return uint32(int32(math.Round(v * 65536)))
+}
+
+func xyzTag(x, y, z float64) []byte {
+	var b = new(bytes.Buffer)
+	b.WriteString("XYZ \x00\x00\x00\x00")
+	binary.Write(b, binary.BigEndian, []uint32{fixed(x), fixed(y), fixed(z)})
+	return b.Bytes()
+}
+
+// gammaTag returns a single-entry "curv" tag
+func gammaTag(g float64) []byte {
+	var b = new(bytes.Buffer)
+	b.WriteString("curv\x00\x00\x00\x00")
+	binary.Write(b, binary.BigEndian, uint32(1))
+	binary.Write(b, binary.BigEndian, uint16(math.Round(g*256)))
+	return b.Bytes()
+}
+
+// srgbTRC returns the sRGB curve as a type 3 "para" tag
+func srgbTRC() []byte {
+	var b = new(bytes.Buffer)
+	b.WriteString("para\x00\x00\x00\x00")
+	binary.Write(b, binary.BigEndian, []uint16{3, 0})
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		binary.Write(b, binary.BigEndian, fixed(v))
+	}
+	return b.Bytes()
+}
+
+func srgbProfile() []byte {
+	return buildProfile(ColorSpaceRGB, map[string][]byte{
+		"rXYZ": xyzTag(0.4360747, 0.2225045, 0.0139322),
+		"gXYZ": xyzTag(0.3850649, 0.7168786, 0.0971045),
+		"bXYZ": xyzTag(0.1430804, 0.0606169, 0.7141733),
+		"rTRC": srgbTRC(), "gTRC": srgbTRC(), "bTRC": srgbTRC(),
+	})
+}
+
+// adobeRGBProfile returns a profile with Adobe RGB (1998) colorants and tone
+// curves
+func adobeRGBProfile() []byte {
+	return buildProfile(ColorSpaceRGB, map[string][]byte{
+		"rXYZ": xyzTag(0.6097559, 0.3111242, 0.0194811),
+		"gXYZ": xyzTag(0.2052401, 0.6256560, 0.0608902),
+		"bXYZ": xyzTag(0.1492240, 0.0632197, 0.7448387),
+		"rTRC": gammaTag(2.2), "gTRC": gammaTag(2.2), "bTRC": gammaTag(2.2),
+	})
+}
+
+func TestParse(t *testing.T) {
+	var p, err = Parse(adobeRGBProfile())
+	assert.NilError(err, "parsing Adobe RGB", t)
+	assert.Equal(ColorSpaceRGB, p.ColorSpace, "color space", t)
+	assert.False(p.IsSRGB(), "Adobe RGB isn't sRGB", t)
+
+	p, err = Parse(srgbProfile())
+	assert.NilError(err, "parsing sRGB", t)
+	assert.True(p.IsSRGB(), "sRGB is detected", t)
+
+	_, err = Parse(buildProfile("CMYK", nil))
+	assert.True(err != nil, "CMYK profiles are rejected", t)
+
+	_, err = Parse(buildProfile(ColorSpaceRGB, map[string][]byte{"rXYZ": xyzTag(1, 1, 1)}))
+	assert.True(err != nil, "profiles without colorants and curves are rejected", t)
+
+	_, err = Parse(make([]byte, 200))
+	assert.True(err != nil, "garbage is rejected", t)
+}
+
+func TestConvertRGB(t *testing.T) {
+	var p, _ = Parse(adobeRGBProfile())
+	var m = image.NewRGBA(image.Rect(0, 0, 4, 1))
+	m.Set(0, 0, color.RGBA{128, 128, 128, 255})
+	m.Set(1, 0, color.RGBA{0, 255, 0, 255})
+	m.Set(2, 0, color.RGBA{0, 64, 0, 128})
+	m.Set(3, 0, color.RGBA{255, 255, 255, 255})
+	assert.NilError(p.ConvertToSRGB(m), "converting", t)
+
+	// Neutral gray stays neutral, but moves from gamma 2.2 to the sRGB curve
+	var c = m.RGBAAt(0, 0)
+	assert.True(c.R == c.G && c.G == c.B, "gray stays neutral", t)
+	var want = uint8(math.Round(srgbEncode(math.Pow(128.0/255, 2.2)) * 255))
+	assert.Equal(want, c.R, "gray moves from gamma 2.2 to the sRGB curve", t)
+
+	// Adobe RGB's green is far outside sRGB, so it clips
+	c = m.RGBAAt(1, 0)
+	assert.Equal(color.RGBA{0, 255, 0, 255}, c, "out of gamut green is clipped", t)
+
+	// Semitransparent pixels keep their alpha and stay premultiplied
+	c = m.RGBAAt(2, 0)
+	assert.Equal(uint8(128), c.A, "alpha is kept", t)
+	assert.True(c.G <= c.A, "color stays premultiplied", t)
+
+	c = m.RGBAAt(3, 0)
+	assert.Equal(color.RGBA{255, 255, 255, 255}, c, "white stays white", t)
+}
+
+func TestConvertRGB64MatchesRGB(t *testing.T) {
+	var p, _ = Parse(adobeRGBProfile())
+	var m8 = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	var m16 = image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	m8.Set(0, 0, color.RGBA{200, 100, 50, 255})
+	m16.Set(0, 0, color.RGBA{200, 100, 50, 255})
+	p.ConvertToSRGB(m8)
+	p.ConvertToSRGB(m16)
+
+	var c8, c16 = m8.RGBAAt(0, 0), m16.RGBA64At(0, 0)
+	for i, pair := range [][2]int{{int(c8.R), int(c16.R)}, {int(c8.G), int(c16.G)}, {int(c8.B), int(c16.B)}} {
+		var diff = math.Abs(float64(pair[0]) - float64(pair[1])/257)
+		assert.True(diff <= 0.5, "channel "+string("rgb"[i])+" matches at both depths", t)
+	}
+}
+
+func TestConvertNRGBA(t *testing.T) {
+	var p, _ = Parse(adobeRGBProfile())
+	var rgba = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	var nrgba = image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	rgba.Set(0, 0, color.RGBA{200, 100, 50, 255})
+	nrgba.Set(0, 0, color.NRGBA{200, 100, 50, 0})
+	p.ConvertToSRGB(rgba)
+	assert.NilError(p.ConvertToSRGB(nrgba), "converting NRGBA", t)
+
+	var c = nrgba.NRGBAAt(0, 0)
+	var want = rgba.RGBAAt(0, 0)
+	assert.Equal(color.NRGBA{want.R, want.G, want.B, 0}, c, "color is converted even when fully transparent", t)
+}
+
+func TestConvertGray(t *testing.T) {
+	var p, err = Parse(buildProfile(ColorSpaceGray, map[string][]byte{"kTRC": gammaTag(1.8)}))
+	assert.NilError(err, "parsing gray profile", t)
+
+	var m = image.NewGray(image.Rect(0, 0, 3, 1))
+	m.Pix = []uint8{0, 128, 255}
+	assert.NilError(p.ConvertToSRGB(m), "converting", t)
+	var want = uint8(math.Round(srgbEncode(math.Pow(128.0/255, 1.8)) * 255))
+	assert.Equal(uint8(0), m.Pix[0], "black", t)
+	assert.Equal(want, m.Pix[1], "gamma 1.8 mid gray is lightened", t)
+	assert.Equal(uint8(255), m.Pix[2], "white", t)
+
+	assert.True(p.ConvertToSRGB(image.NewRGBA(m.Rect)) != nil, "gray profiles can't convert RGB", t)
+}
+
+func TestEmbedJPEG(t *testing.T) {
+	var buf = new(bytes.Buffer)
+	jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	var profile = bytes.Repeat([]byte{7}, jpegChunk+10)
+
+	var out, err = EmbedJPEG(buf.Bytes(), profile)
+	assert.NilError(err, "embedding", t)
+	assert.Equal(2, bytes.Count(out, []byte("ICC_PROFILE\x00")), "large profiles are split", t)
+	assert.True(bytes.Contains(out, []byte("ICC_PROFILE\x00\x02\x02")), "chunks are numbered", t)
+	_, err = jpeg.Decode(bytes.NewReader(out))
+	assert.NilError(err, "the result still decodes", t)
+}
+
+func TestEmbedPNG(t *testing.T) {
+	var buf = new(bytes.Buffer)
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+
+	var out, err = EmbedPNG(buf.Bytes(), srgbProfile())
+	assert.NilError(err, "embedding", t)
+	assert.Equal(33+4, bytes.Index(out, []byte("iCCP")), "iCCP follows IHDR", t)
+	_, err = png.Decode(bytes.NewReader(out))
+	assert.NilError(err, "the result still decodes, so the CRC is valid", t)
+}
+
+func TestEmbedTIFF(t *testing.T) {
+	var buf = new(bytes.Buffer)
+	var src = image.NewGray(image.Rect(0, 0, 3, 3))
+	src.Pix[4] = 200
+	tiff.Encode(buf, src, nil)
+	var profile = srgbProfile()
+
+	var out, err = EmbedTIFF(buf.Bytes(), profile)
+	assert.NilError(err, "embedding", t)
+	assert.True(bytes.HasSuffix(out, profile), "profile is appended", t)
+
+	var m image.Image
+	m, err = tiff.Decode(bytes.NewReader(out))
+	assert.NilError(err, "the result still decodes", t)
+	assert.Equal(uint8(200), m.(*image.Gray).Pix[4], "pixels are unchanged", t)
+
+	_, err = EmbedTIFF(out, profile)
+	assert.True(err != nil, "profiles aren't embedded twice", t)
+}
@@ -0,0 +1,210 @@
+// Package icc reads the parts of ICC color profiles needed to convert images
+// to sRGB, and embeds profiles in encoded JPEG, PNG, and TIFF images.  Only
+// matrix/TRC profiles are supported: RGB profiles built from three colorants
+// and tone curves (e.g., Adobe RGB and ProPhoto) and grayscale profiles built
+// from a single tone curve.  These cover nearly every profile used for
+// archival masters; LUT-based profiles are reported as unsupported.
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnsupported is returned when a profile is valid, but isn't a kind this
+// package can convert from
+var ErrUnsupported = errors.New("unsupported ICC profile")
+
+// Color spaces of the profiles we can convert
+const (
+	ColorSpaceRGB  = "RGB "
+	ColorSpaceGray = "GRAY"
+)
+
+// Profile is a parsed matrix/TRC profile
+type Profile struct {
+	// Data is the raw profile, for embedding in output images
+	Data []byte
+
+	// ColorSpace is the profile's data color space signature, either
+	// ColorSpaceRGB or ColorSpaceGray
+	ColorSpace string
+
+	// matrix converts linear RGB to D50 XYZ: each column is a colorant
+	matrix [3][3]float64
+
+	// trc holds the red, green, and blue tone curves for RGB profiles, or the
+	// gray curve (in trc[0]) for grayscale profiles
+	trc [3]curve
+}
+
+// curve converts an encoded value in [0, 1] to a linear one
+type curve func(float64) float64
+
+// Parse reads a profile's header and the tags needed for conversion
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < 132 || !bytes.Equal(data[36:40], []byte("acsp")) {
+		return nil, errors.New("invalid ICC profile: missing header")
+	}
+	if int(binary.BigEndian.Uint32(data)) > len(data) {
+		return nil, errors.New("invalid ICC profile: truncated")
+	}
+
+	var p = &Profile{Data: data, ColorSpace: string(data[16:20])}
+	if string(data[20:24]) != "XYZ " {
+		return nil, fmt.Errorf("%w: PCS is %q", ErrUnsupported, data[20:24])
+	}
+
+	var tags, err = readTagTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.ColorSpace {
+	case ColorSpaceRGB:
+		for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+			var xyz, err = readXYZ(tags[sig])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrUnsupported, sig, err)
+			}
+			p.matrix[0][i], p.matrix[1][i], p.matrix[2][i] = xyz[0], xyz[1], xyz[2]
+		}
+		for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+			p.trc[i], err = readCurve(tags[sig])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrUnsupported, sig, err)
+			}
+		}
+	case ColorSpaceGray:
+		p.trc[0], err = readCurve(tags["kTRC"])
+		if err != nil {
+			return nil, fmt.Errorf("%w: kTRC: %s", ErrUnsupported, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: color space is %q", ErrUnsupported, p.ColorSpace)
+	}
+
+	return p, nil
+}
+
+// readTagTable returns each tag's data, keyed by signature
+func readTagTable(data []byte) (map[string][]byte, error) {
+	var count = int(binary.BigEndian.Uint32(data[128:]))
+	if 132+count*12 > len(data) {
+		return nil, errors.New("invalid ICC profile: truncated tag table")
+	}
+
+	var tags = make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		var entry = data[132+i*12:]
+		var offset = int(binary.BigEndian.Uint32(entry[4:]))
+		var size = int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("invalid ICC profile: tag %q is out of bounds", entry[:4])
+		}
+		tags[string(entry[:4])] = data[offset : offset+size]
+	}
+	return tags, nil
+}
+
+// s15f16 converts an ICC s15Fixed16Number
+func s15f16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func readXYZ(tag []byte) ([3]float64, error) {
+	var xyz [3]float64
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return xyz, errors.New("missing or invalid XYZ tag")
+	}
+	for i := range xyz {
+		xyz[i] = s15f16(tag[8+i*4:])
+	}
+	return xyz, nil
+}
+
+// readCurve reads a "curv" or "para" tag
+func readCurve(tag []byte) (curve, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("missing or invalid curve tag")
+	}
+
+	switch string(tag[:4]) {
+	case "curv":
+		var n = int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+n*2 {
+			return nil, errors.New("truncated curve")
+		}
+		switch n {
+		case 0:
+			return func(v float64) float64 { return v }, nil
+		case 1:
+			var g = float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, g) }, nil
+		}
+		var table = make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return func(v float64) float64 {
+			var pos = v * float64(n-1)
+			var i = min(int(pos), n-2)
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+
+	case "para":
+		var fn = binary.BigEndian.Uint16(tag[8:])
+		var counts = []int{1, 3, 4, 5, 7}
+		if int(fn) >= len(counts) || len(tag) < 12+counts[fn]*4 {
+			return nil, fmt.Errorf("invalid parametric curve type %d", fn)
+		}
+		var p [7]float64
+		for i := 0; i < counts[fn]; i++ {
+			p[i] = s15f16(tag[12+i*4:])
+		}
+		return paraCurve(fn, p), nil
+	}
+
+	return nil, fmt.Errorf("unknown curve type %q", tag[:4])
+}
+
+// paraCurve returns one of the ICC parametric curve functions, where p holds
+// g, a, b, c, d, e, f in that order
+func paraCurve(fn uint16, p [7]float64) curve {
+	var g, a, b, c, d, e, f = p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	var pow = func(v float64) float64 { return math.Pow(max(a*v+b, 0), g) }
+	switch fn {
+	case 1:
+		return func(v float64) float64 {
+			if v >= -b/a {
+				return pow(v)
+			}
+			return 0
+		}
+	case 2:
+		return func(v float64) float64 {
+			if v >= -b/a {
+				return pow(v) + c
+			}
+			return c
+		}
+	case 3:
+		return func(v float64) float64 {
+			if v >= d {
+				return pow(v)
+			}
+			return c * v
+		}
+	case 4:
+		return func(v float64) float64 {
+			if v >= d {
+				return pow(v) + e
+			}
+			return c*v + f
+		}
+	}
+	return func(v float64) float64 { return math.Pow(v, g) }
+}
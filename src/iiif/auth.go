@@ -0,0 +1,94 @@
+package iiif
+
+// ContextAuth2 is the JSON-LD context for IIIF Authorization Flow API 2.0
+// responses
+const ContextAuth2 = "http://iiif.io/api/auth/2/context.json"
+
+// Auth 2.0 service types
+const (
+	AuthProbeService2       = "AuthProbeService2"
+	AuthAccessService2      = "AuthAccessService2"
+	AuthAccessTokenService2 = "AuthAccessTokenService2"
+	AuthLogoutService2      = "AuthLogoutService2"
+)
+
+// AuthService describes one of the Auth 2.0 services.  They nest: a probe
+// service holds access services, and each access service holds its token
+// and logout services.
+type AuthService struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	Profile string        `json:"profile,omitempty"`
+	Label   LanguageMap   `json:"label,omitempty"`
+	Heading LanguageMap   `json:"heading,omitempty"`
+	Note    LanguageMap   `json:"note,omitempty"`
+	Service []AuthService `json:"service,omitempty"`
+}
+
+// AuthProbeResult is the probe service's response, telling the client
+// whether the user can see the resource the probe is for
+type AuthProbeResult struct {
+	Context string      `json:"@context"`
+	Type    string      `json:"type"`
+	Status  int         `json:"status"`
+	Heading LanguageMap `json:"heading,omitempty"`
+	Note    LanguageMap `json:"note,omitempty"`
+}
+
+// NewAuthProbeResult returns a probe result with the given HTTP-like status
+func NewAuthProbeResult(status int) *AuthProbeResult {
+	return &AuthProbeResult{Context: ContextAuth2, Type: "AuthProbeResult2", Status: status}
+}
+
+// AuthAccessToken is the message a token service sends to the client when it
+// can issue a token
+type AuthAccessToken struct {
+	Context     string `json:"@context"`
+	Type        string `json:"type"`
+	AccessToken string `json:"accessToken"`
+	ExpiresIn   int    `json:"expiresIn"`
+	MessageID   string `json:"messageId"`
+}
+
+// NewAuthAccessToken returns a token message answering the client's messageID
+func NewAuthAccessToken(token string, expiresIn int, messageID string) *AuthAccessToken {
+	return &AuthAccessToken{
+		Context:     ContextAuth2,
+		Type:        "AuthAccessToken2",
+		AccessToken: token,
+		ExpiresIn:   expiresIn,
+		MessageID:   messageID,
+	}
+}
+
+// Auth 2.0 token error profiles
+const (
+	TokenErrInvalidRequest = "invalidRequest"
+	TokenErrInvalidOrigin  = "invalidOrigin"
+	TokenErrMissingAspect  = "missingAspect"
+	TokenErrExpiredAspect  = "expiredAspect"
+	TokenErrInvalidAspect  = "invalidAspect"
+	TokenErrUnavailable    = "unavailable"
+)
+
+// AuthAccessTokenError is the message a token service sends to the client
+// when it can't issue a token
+type AuthAccessTokenError struct {
+	Context   string      `json:"@context"`
+	Type      string      `json:"type"`
+	Profile   string      `json:"profile"`
+	MessageID string      `json:"messageId"`
+	Heading   LanguageMap `json:"heading,omitempty"`
+	Note      LanguageMap `json:"note,omitempty"`
+}
+
+// NewAuthAccessTokenError returns an error message of the given profile
+// answering the client's messageID
+func NewAuthAccessTokenError(profile, messageID string) *AuthAccessTokenError {
+	return &AuthAccessTokenError{
+		Context:   ContextAuth2,
+		Type:      "AuthAccessTokenError2",
+		Profile:   profile,
+		MessageID: messageID,
+	}
+}
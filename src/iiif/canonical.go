@@ -0,0 +1,59 @@
+package iiif
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+)
+
+// Canonical returns the canonical form of the URL's parameters, everything
+// after the identifier, using the rules of the URL's API version.  w and h
+// are the source image's dimensions, while crop and scale are the region and
+// output size the request resolves to for that image.  Equivalent requests,
+// such as "full/full" and "0,0,w,h/w,", produce the same canonical string.
+func (u *URL) Canonical(w, h int, crop, scale image.Rectangle) string {
+	var region = "full"
+	if crop != image.Rect(0, 0, w, h) {
+		region = fmt.Sprintf("%d,%d,%d,%d", crop.Min.X, crop.Min.Y, crop.Dx(), crop.Dy())
+	}
+
+	var rotation = strconv.FormatFloat(u.Rotation.Degrees, 'f', -1, 64)
+	if u.Rotation.Mirror {
+		rotation = "!" + rotation
+	}
+
+	var quality = u.Quality
+	if quality == QNative {
+		quality = QDefault
+	}
+
+	return fmt.Sprintf("%s/%s/%s/%s.%s", region, u.canonicalSize(crop, scale), rotation, quality, u.Format)
+}
+
+// canonicalSize returns the size parameter for Canonical.  2.x uses "full"
+// for unscaled images and "w," when the aspect ratio is preserved, while 3.0
+// uses "max" or "w,h", with a "^" prefix for sizes larger than the region.
+func (u *URL) canonicalSize(crop, scale image.Rectangle) string {
+	var sw, sh = scale.Dx(), scale.Dy()
+	var unscaled = sw == crop.Dx() && sh == crop.Dy()
+
+	if u.Version == Version3 {
+		if unscaled {
+			return "max"
+		}
+		var size = fmt.Sprintf("%d,%d", sw, sh)
+		if Upscales(crop, scale) {
+			size = "^" + size
+		}
+		return size
+	}
+
+	if unscaled {
+		return "full"
+	}
+	var byWidth = Size{Type: STScaleToWidth, W: sw}
+	if byWidth.GetResize(crop).Dy() == sh {
+		return fmt.Sprintf("%d,", sw)
+	}
+	return fmt.Sprintf("%d,%d", sw, sh)
+}
@@ -0,0 +1,54 @@
+package iiif
+
+import (
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func canonical(t *testing.T, path string, v Version) string {
+	var u, err = NewVersionedURL("id/"+path, v)
+	assert.NilError(err, "parsing "+path, t)
+	var crop = u.Region.GetCrop(800, 400)
+	return u.Canonical(800, 400, crop, u.Size.GetResize(crop))
+}
+
+func TestCanonical2(t *testing.T) {
+	var tests = map[string]string{
+		"full/full/0/default.jpg":            "full/full/0/default.jpg",
+		"0,0,800,400/full/0/native.jpg":      "full/full/0/default.jpg",
+		"pct:0,0,100,100/800,/360/gray.png":  "full/full/0/gray.png",
+		"full/400,/0/default.jpg":            "full/400,/0/default.jpg",
+		"full/,200/0/default.jpg":            "full/400,/0/default.jpg",
+		"full/pct:50/0/default.jpg":          "full/400,/0/default.jpg",
+		"full/!400,400/0/default.jpg":        "full/400,/0/default.jpg",
+		"full/400,400/0/default.jpg":         "full/400,400/0/default.jpg",
+		"pct:50,50,50,50/full/!90/color.jpg": "400,200,400,200/full/!90/color.jpg",
+		"square/200,/22.50/bitonal.tif":      "200,0,400,400/200,/22.5/bitonal.tif",
+	}
+	for path, expected := range tests {
+		assert.Equal(expected, canonical(t, path, Version2), "2.x canonical for "+path, t)
+		assert.Equal(expected, canonical(t, expected, Version2), "2.x canonical is stable for "+path, t)
+	}
+}
+
+func TestCanonical3(t *testing.T) {
+	var tests = map[string]string{
+		"full/max/0/default.jpg":       "full/max/0/default.jpg",
+		"0,0,800,400/800,/0/color.jpg": "full/max/0/color.jpg",
+		"full/400,/0/default.jpg":      "full/400,200/0/default.jpg",
+		"full/^1600,/0/default.jpg":    "full/^1600,800/0/default.jpg",
+		"full/!400,400/!180/gray.png":  "full/400,200/!180/gray.png",
+	}
+	for path, expected := range tests {
+		assert.Equal(expected, canonical(t, path, Version3), "3.0 canonical for "+path, t)
+		assert.Equal(expected, canonical(t, expected, Version3), "3.0 canonical is stable for "+path, t)
+	}
+}
+
+func TestParams(t *testing.T) {
+	var u, _ = NewURL("a/b%2Fc.jp2/full/pct:50/!90/default.jpg")
+	assert.Equal("full/pct:50/!90/default.jpg", u.Params(), "params", t)
+	u, _ = NewURL("a/b%2Fc.jp2/info.json")
+	assert.Equal("", u.Params(), "info requests have no params", t)
+}
@@ -52,6 +52,58 @@ func FeatureSet2() *FeatureSet {
 	}
 }
 
+// FeatureSet3Level0 returns a copy of the feature set required for a
+// level-0-compliant IIIF 3.0 server.  3.0 doesn't require any named features
+// at level 0, but the "default" quality and jpg format are still mandatory.
+func FeatureSet3Level0() *FeatureSet {
+	return &FeatureSet{
+		Default: true,
+		Jpg:     true,
+	}
+}
+
+// FeatureSet3Level1 returns a copy of the feature set required for a
+// level-1-compliant IIIF 3.0 server.  Note that 3.0's "sizeByWh" is what RAIS
+// calls SizeByForcedWh.
+func FeatureSet3Level1() *FeatureSet {
+	return &FeatureSet{
+		RegionByPx:      true,
+		RegionSquare:    true,
+		SizeByW:         true,
+		SizeByH:         true,
+		SizeByForcedWh:  true,
+		Default:         true,
+		Jpg:             true,
+		BaseURIRedirect: true,
+		Cors:            true,
+		JsonldMediaType: true,
+	}
+}
+
+// FeatureSet3Level2 returns a copy of the feature set required for a
+// level-2-compliant IIIF 3.0 server.  Note that 3.0's "sizeByConfinedWh" is
+// what RAIS calls SizeByWh.
+func FeatureSet3Level2() *FeatureSet {
+	return &FeatureSet{
+		RegionByPx:      true,
+		RegionByPct:     true,
+		RegionSquare:    true,
+		SizeByW:         true,
+		SizeByH:         true,
+		SizeByPct:       true,
+		SizeByForcedWh:  true,
+		SizeByWh:        true,
+		RotationBy90s:   true,
+		Default:         true,
+		Color:           true,
+		Jpg:             true,
+		Png:             true,
+		BaseURIRedirect: true,
+		Cors:            true,
+		JsonldMediaType: true,
+	}
+}
+
 // AllFeatures returns the complete list of everything supported by RAIS at
 // this time
 func AllFeatures() *FeatureSet {
@@ -70,21 +122,27 @@ func AllFeatures() *FeatureSet {
 		SizeByConfinedWh:  true,
 		SizeByDistortedWh: true,
 
-		RotationBy90s: true,
-		Mirroring:     true,
+		RotationBy90s:     true,
+		RotationArbitrary: true,
+		Mirroring:         true,
 
 		Default: true,
 		Color:   true,
 		Gray:    true,
 		Bitonal: true,
 
-		Jpg: true,
-		Png: true,
-		Gif: false,
-		Tif: true,
+		Jpg:  true,
+		Png:  true,
+		Gif:  false,
+		Tif:  true,
+		Jp2:  true,
+		Pdf:  true,
+		Webp: true,
 
-		BaseURIRedirect: true,
-		Cors:            true,
-		JsonldMediaType: true,
+		BaseURIRedirect:     true,
+		Cors:                true,
+		JsonldMediaType:     true,
+		ProfileLinkHeader:   true,
+		CanonicalLinkHeader: true,
 	}
 }
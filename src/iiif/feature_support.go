@@ -21,6 +21,33 @@ func (fs *FeatureSet) Supported(u *URL) bool {
 		fs.SupportsFormat(u.Format)
 }
 
+// SupportedWithSizes is like Supported, but also accepts requests which are
+// only unsupported due to their size, as long as sizeByWhListed is enabled and
+// the request is for the full image at one of the listed sizes.  This is how
+// a server which can't resize arbitrarily still serves the sizes its info
+// response advertises.
+func (fs *FeatureSet) SupportedWithSizes(u *URL, sizes []ListedSize) bool {
+	if fs.Supported(u) {
+		return true
+	}
+	if !fs.SizeByWhListed || u.Region.Type != RTFull || u.Size.Type != STExact {
+		return false
+	}
+
+	var listed bool
+	for _, s := range sizes {
+		if s.Width == u.Size.W && s.Height == u.Size.H {
+			listed = true
+			break
+		}
+	}
+
+	return listed &&
+		fs.SupportsRotation(u.Rotation) &&
+		fs.SupportsQuality(u.Quality) &&
+		fs.SupportsFormat(u.Format)
+}
+
 // SupportsRegion just verifies a given region type is supported
 func (fs *FeatureSet) SupportsRegion(r Region) bool {
 	switch r.Type {
@@ -35,8 +62,13 @@ func (fs *FeatureSet) SupportsRegion(r Region) bool {
 	}
 }
 
-// SupportsSize just verifies a given size type is supported
+// SupportsSize just verifies a given size type is supported.  Sizes which
+// explicitly request upscaling also require SizeAboveFull.
 func (fs *FeatureSet) SupportsSize(s Size) bool {
+	if s.Upscale && !fs.SizeAboveFull {
+		return false
+	}
+
 	switch s.Type {
 	case STScaleToWidth:
 		return fs.SizeByW
@@ -12,9 +12,18 @@ type TileSize struct {
 	ScaleFactors []int `json:"scaleFactors"`
 }
 
+// ListedSize is one entry of an info response's "sizes" array: a full-image
+// size the server is known to support.  This data is serialized in an info
+// request and therefore must have JSON tags.
+type ListedSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
 // FeatureSet represents possible IIIF 2.1 features.  The boolean fields are
 // the same as the string to report features, except that the first character
-// should be lowercased.
+// should be lowercased.  IIIF 3.0 features are derived from the same fields;
+// see toMap3 for the handful of names which differ.
 //
 // Note that using this in a different server only gets you so far.  As noted
 // in the Supported() documentation below, verifying complete support is
@@ -68,24 +77,70 @@ type FeatureSet struct {
 	TileSizes []TileSize
 }
 
+// fields maps each boolean feature's IIIF 2.x name to the FeatureSet field
+// holding its value.  The strings used are lowercased so they can be used
+// as-is within "formats", "qualities", and/or "supports" arrays.
+func (fs *FeatureSet) fields() map[string]*bool {
+	return map[string]*bool{
+		"regionByPx":          &fs.RegionByPx,
+		"regionByPct":         &fs.RegionByPct,
+		"regionSquare":        &fs.RegionSquare,
+		"sizeByWhListed":      &fs.SizeByWhListed,
+		"sizeByW":             &fs.SizeByW,
+		"sizeByH":             &fs.SizeByH,
+		"sizeByPct":           &fs.SizeByPct,
+		"sizeByForcedWh":      &fs.SizeByForcedWh,
+		"sizeByWh":            &fs.SizeByWh,
+		"sizeByConfinedWh":    &fs.SizeByConfinedWh,
+		"sizeByDistortedWh":   &fs.SizeByDistortedWh,
+		"sizeAboveFull":       &fs.SizeAboveFull,
+		"rotationBy90s":       &fs.RotationBy90s,
+		"rotationArbitrary":   &fs.RotationArbitrary,
+		"mirroring":           &fs.Mirroring,
+		"default":             &fs.Default,
+		"color":               &fs.Color,
+		"gray":                &fs.Gray,
+		"bitonal":             &fs.Bitonal,
+		"jpg":                 &fs.Jpg,
+		"png":                 &fs.Png,
+		"tif":                 &fs.Tif,
+		"gif":                 &fs.Gif,
+		"jp2":                 &fs.Jp2,
+		"pdf":                 &fs.Pdf,
+		"webp":                &fs.Webp,
+		"baseUriRedirect":     &fs.BaseURIRedirect,
+		"cors":                &fs.Cors,
+		"jsonldMediaType":     &fs.JsonldMediaType,
+		"profileLinkHeader":   &fs.ProfileLinkHeader,
+		"canonicalLinkHeader": &fs.CanonicalLinkHeader,
+	}
+}
+
 // toMap converts a FeatureSet's boolean support values into a map suitable for
-// use in comparison to other feature sets.  The strings used are lowercased so
-// they can be used as-is within "formats", "qualities", and/or "supports"
-// arrays.
+// use in comparison to other feature sets, keyed by the IIIF 2.x names.
 func (fs *FeatureSet) toMap() FeaturesMap {
+	var m = make(FeaturesMap)
+	for name, val := range fs.fields() {
+		m[name] = *val
+	}
+	return m
+}
+
+// toMap3 is the IIIF Image API 3.0 equivalent of toMap.  3.0 renamed or
+// dropped a handful of features, and RAIS's SizeByForcedWh and SizeByWh
+// fields are what actually govern "w,h" and "!w,h" requests, so those map to
+// 3.0's sizeByWh and sizeByConfinedWh respectively.
+func (fs *FeatureSet) toMap3() FeaturesMap {
 	return FeaturesMap{
 		"regionByPx":          fs.RegionByPx,
 		"regionByPct":         fs.RegionByPct,
 		"regionSquare":        fs.RegionSquare,
-		"sizeByWhListed":      fs.SizeByWhListed,
 		"sizeByW":             fs.SizeByW,
 		"sizeByH":             fs.SizeByH,
 		"sizeByPct":           fs.SizeByPct,
-		"sizeByForcedWh":      fs.SizeByForcedWh,
-		"sizeByWh":            fs.SizeByWh,
-		"sizeByConfinedWh":    fs.SizeByConfinedWh,
-		"sizeByDistortedWh":   fs.SizeByDistortedWh,
-		"sizeAboveFull":       fs.SizeAboveFull,
+		"sizeByWh":            fs.SizeByForcedWh,
+		"sizeByConfinedWh":    fs.SizeByWh,
+		"sizeUpscaling":       fs.SizeAboveFull,
 		"rotationBy90s":       fs.RotationBy90s,
 		"rotationArbitrary":   fs.RotationArbitrary,
 		"mirroring":           fs.Mirroring,
@@ -114,13 +169,16 @@ func (fs *FeatureSet) toMap() FeaturesMap {
 // features and true/false.  This helps to quickly determine equality, subset
 // status, and superset status.
 func FeatureCompare(a, b *FeatureSet) (union, onlyA, onlyB FeaturesMap) {
+	return compareMaps(a.toMap(), b.toMap())
+}
+
+// compareMaps does the work for FeatureCompare, allowing the comparison of
+// 3.0 feature maps as well as 2.x
+func compareMaps(mapA, mapB FeaturesMap) (union, onlyA, onlyB FeaturesMap) {
 	union = make(FeaturesMap)
 	onlyA = make(FeaturesMap)
 	onlyB = make(FeaturesMap)
 
-	mapA := a.toMap()
-	mapB := b.toMap()
-
 	for feature, supportedA := range mapA {
 		supportedB := mapB[feature]
 		if supportedA && supportedB {
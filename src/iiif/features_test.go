@@ -62,6 +62,31 @@ func TestSizeSupport(t *testing.T) {
 	assert.False(FeaturesLevel0.SupportsSize(s), "STBestFit NOT supported by FL0", t)
 	assert.False(FeaturesLevel1.SupportsSize(s), "STBestFit NOT supported by FL1", t)
 	assert.True(FeaturesLevel2.SupportsSize(s), "STBestFit supported by FL2", t)
+
+	s.Upscale = true
+	assert.False(FeaturesLevel2.SupportsSize(s), "upscaling NOT supported by FL2", t)
+	assert.True(AllFeatures().SupportsSize(s), "upscaling supported with sizeAboveFull", t)
+}
+
+func TestSupportedWithSizes(t *testing.T) {
+	var sizes = []ListedSize{{Width: 200, Height: 100}, {Width: 400, Height: 200}}
+	var u, _ = NewURL("id/full/200,100/0/default.jpg")
+	assert.False(FeaturesLevel0.Supported(u), "w,h isn't supported by FL0", t)
+	assert.True(FeaturesLevel0.SupportedWithSizes(u, sizes), "listed w,h is supported by FL0", t)
+	assert.False(FeaturesLevel0.SupportedWithSizes(u, nil), "w,h needs to be listed", t)
+
+	var fs = FeatureSet0()
+	fs.SizeByWhListed = false
+	assert.False(fs.SupportedWithSizes(u, sizes), "listed sizes need sizeByWhListed", t)
+
+	u, _ = NewURL("id/full/300,150/0/default.jpg")
+	assert.False(FeaturesLevel0.SupportedWithSizes(u, sizes), "unlisted w,h isn't supported by FL0", t)
+	u, _ = NewURL("id/0,0,10,10/200,100/0/default.jpg")
+	assert.False(FeaturesLevel0.SupportedWithSizes(u, sizes), "listed sizes only apply to the full image", t)
+	u, _ = NewURL("id/full/200,100/0/default.png")
+	assert.False(FeaturesLevel0.SupportedWithSizes(u, sizes), "other features must still be supported", t)
+	u, _ = NewURL("id/full/300,150/0/default.jpg")
+	assert.True(FeaturesLevel2.SupportedWithSizes(u, sizes), "supported requests needn't be listed", t)
 }
 
 func TestRotationSupport(t *testing.T) {
@@ -3,7 +3,16 @@
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"sort"
+	"strings"
+)
+
+// Profile URIs for the IIIF 2.x compliance levels
+const (
+	ProfileLevel0URI = "http://iiif.io/api/image/2/level0.json"
+	ProfileLevel1URI = "http://iiif.io/api/image/2/level1.json"
+	ProfileLevel2URI = "http://iiif.io/api/image/2/level2.json"
 )
 
 // ProfileWrapper is a structure which has to custom-marshal itself to provide
@@ -65,22 +74,59 @@ func (p *ProfileWrapper) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// FeatureSet returns the features the profile describes: everything required
+// by its conformance level plus any extra formats, qualities, and supports.
+// An unknown conformance URI is treated as level 0.
+func (p ProfileWrapper) FeatureSet() *FeatureSet {
+	var fs *FeatureSet
+	switch strings.TrimSuffix(p.ConformanceURL, ".json") + ".json" {
+	case ProfileLevel2URI:
+		fs = FeatureSet2()
+	case ProfileLevel1URI:
+		fs = FeatureSet1()
+	default:
+		fs = FeatureSet0()
+	}
+
+	var fields = fs.fields()
+	for _, list := range [][]string{p.Formats, p.Qualities, p.Supports} {
+		for _, name := range list {
+			var field, ok = fields[name]
+			if ok {
+				*field = true
+			}
+		}
+	}
+
+	return fs
+}
+
 // Info represents the simplest possible data to provide a valid IIIF
-// information JSON response
+// information JSON response.  This is always the IIIF 2.x structure; 3.0
+// responses are generated from it via V3().
 type Info struct {
 	Context  string         `json:"@context"`
 	ID       string         `json:"@id"`
 	Protocol string         `json:"protocol"`
 	Width    int            `json:"width"`
 	Height   int            `json:"height"`
+	Sizes    []ListedSize   `json:"sizes,omitempty"`
 	Tiles    []TileSize     `json:"tiles,omitempty"`
 	Profile  ProfileWrapper `json:"profile"`
+	Service  []AuthService  `json:"service,omitempty"`
+
+	Attribution string `json:"attribution,omitempty"`
+	License     string `json:"license,omitempty"`
+	Logo        string `json:"logo,omitempty"`
+
+	// PartOf is only used in 3.0 responses; 2.x has no equivalent
+	PartOf []PartOf `json:"-"`
 }
 
 // NewInfo returns the static *Info data that's the same for any info response
 func NewInfo() *Info {
 	return &Info{
-		Context:  "http://iiif.io/api/image/2/context.json",
+		Context:  Context2,
 		Protocol: "http://iiif.io/api/image",
 	}
 }
@@ -100,15 +146,34 @@ func (fs *FeatureSet) Info() *Info {
 func (fs *FeatureSet) baseFeatureSet() (*FeatureSet, string) {
 	featuresLevel2 := FeatureSet2()
 	if fs.includes(featuresLevel2) {
-		return featuresLevel2, "http://iiif.io/api/image/2/level2.json"
+		return featuresLevel2, ProfileLevel2URI
 	}
 
 	featuresLevel1 := FeatureSet1()
 	if fs.includes(featuresLevel1) {
-		return featuresLevel1, "http://iiif.io/api/image/2/level1.json"
+		return featuresLevel1, ProfileLevel1URI
+	}
+
+	return FeatureSet0(), ProfileLevel0URI
+}
+
+// baseFeatureSet3 is the IIIF 3.0 version of baseFeatureSet, returning the
+// level's FeatureSet and its name, such as "level2"
+func (fs *FeatureSet) baseFeatureSet3() (*FeatureSet, string) {
+	for _, level := range []struct {
+		fs   *FeatureSet
+		name string
+	}{
+		{FeatureSet3Level2(), "level2"},
+		{FeatureSet3Level1(), "level1"},
+	} {
+		var _, _, missing = compareMaps(fs.toMap3(), level.fs.toMap3())
+		if len(missing) == 0 {
+			return level.fs, level.name
+		}
 	}
 
-	return FeatureSet0(), "http://iiif.io/api/image/2/level0.json"
+	return FeatureSet3Level0(), "level0"
 }
 
 // Profile examines the features in the FeatureSet to determine first which
@@ -125,6 +190,18 @@ func (fs *FeatureSet) Profile() ProfileWrapper {
 	return p
 }
 
+// ProfileURI returns the URI of the compliance level the FeatureSet meets
+// under the given API version, for use in a profile Link header
+func (fs *FeatureSet) ProfileURI(v Version) string {
+	if v == Version3 {
+		var _, level = fs.baseFeatureSet3()
+		return "http://iiif.io/api/image/3/" + level + ".json"
+	}
+
+	var _, u = fs.baseFeatureSet()
+	return u
+}
+
 func extraProfileFromFeaturesMap(fm FeaturesMap) profileElement2 {
 	p := profileElement2{
 		Formats:   make([]string, 0),
@@ -153,3 +230,65 @@ func extraProfileFromFeaturesMap(fm FeaturesMap) profileElement2 {
 
 	return p
 }
+
+// Info3 is the IIIF Image API 3.0 representation of an info response
+type Info3 struct {
+	Context        string        `json:"@context"`
+	ID             string        `json:"id"`
+	Type           string        `json:"type"`
+	Protocol       string        `json:"protocol"`
+	Profile        string        `json:"profile"`
+	Width          int           `json:"width"`
+	Height         int           `json:"height"`
+	MaxWidth       int           `json:"maxWidth,omitempty"`
+	MaxHeight      int           `json:"maxHeight,omitempty"`
+	MaxArea        int64         `json:"maxArea,omitempty"`
+	Sizes          []ListedSize  `json:"sizes,omitempty"`
+	Tiles          []TileSize    `json:"tiles,omitempty"`
+	ExtraFormats   []string      `json:"extraFormats,omitempty"`
+	ExtraQualities []string      `json:"extraQualities,omitempty"`
+	ExtraFeatures  []string      `json:"extraFeatures,omitempty"`
+	Service        []AuthService `json:"service,omitempty"`
+	Rights         string        `json:"rights,omitempty"`
+	PartOf         []PartOf      `json:"partOf,omitempty"`
+}
+
+// V3 converts the info into its IIIF 3.0 form.  The 2.x profile is turned
+// back into a FeatureSet so the 3.0 compliance level and extra features are
+// computed from 3.0's rules rather than guessed at by renaming the 2.x lists.
+func (i *Info) V3() *Info3 {
+	var fs = i.Profile.FeatureSet()
+	var base, level = fs.baseFeatureSet3()
+	var _, extraFeatures, _ = compareMaps(fs.toMap3(), base.toMap3())
+	var extra = extraProfileFromFeaturesMap(extraFeatures)
+
+	var i3 = &Info3{
+		Context:        Context3,
+		ID:             i.ID,
+		Type:           "ImageService3",
+		Protocol:       i.Protocol,
+		Profile:        level,
+		Width:          i.Width,
+		Height:         i.Height,
+		MaxWidth:       i.Profile.MaxWidth,
+		MaxHeight:      i.Profile.MaxHeight,
+		MaxArea:        i.Profile.MaxArea,
+		Sizes:          i.Sizes,
+		Tiles:          i.Tiles,
+		ExtraFormats:   extra.Formats,
+		ExtraQualities: extra.Qualities,
+		ExtraFeatures:  extra.Supports,
+		Service:        i.Service,
+		Rights:         i.License,
+		PartOf:         i.PartOf,
+	}
+
+	// 3.0 requires maxWidth whenever maxHeight is present, since a missing
+	// maxHeight is inferred to be the same as maxWidth.  A height-only limit
+	// therefore needs an explicit "unlimited" width.
+	if i3.MaxHeight != 0 && i3.MaxWidth == 0 {
+		i3.MaxWidth = math.MaxInt32
+	}
+
+	return i3
+}
@@ -1,6 +1,8 @@
 package iiif
 
 import (
+	"encoding/json"
+	"math"
 	"testing"
 
 	"github.com/uoregon-libraries/gopkg/assert"
@@ -61,11 +63,85 @@ func TestAllFeaturesEnabled(t *testing.T) {
 	assert.Equal("http://iiif.io/api/image/2/level2.json", i.Profile.ConformanceURL, "Profile conformance level", t)
 
 	extra := i.Profile.profileElement2
-	assert.Equal(5, len(extra.Supports), "THERE... ARE... FOUR... (plus one) EXTRA... FEATURES!", t)
+	assert.Equal(8, len(extra.Supports), "THERE... ARE... FOUR... (plus four) EXTRA... FEATURES!", t)
 	assert.Equal(0, len(extra.Qualities), "There are 0 extra qualities", t)
-	assert.Equal(1, len(extra.Formats), "There is 1 extra format", t)
+	assert.Equal(4, len(extra.Formats), "There are 4 extra formats", t)
 	assert.IncludesString("regionSquare", extra.Supports, "Custom FS support", t)
 	assert.IncludesString("sizeAboveFull", extra.Supports, "Custom FS support", t)
 	assert.IncludesString("mirroring", extra.Supports, "Custom FS support", t)
+	assert.IncludesString("rotationArbitrary", extra.Supports, "Custom FS support", t)
+	assert.IncludesString("profileLinkHeader", extra.Supports, "Custom FS support", t)
+	assert.IncludesString("canonicalLinkHeader", extra.Supports, "Custom FS support", t)
 	assert.IncludesString("tif", extra.Formats, "Custom FS support", t)
+	assert.IncludesString("jp2", extra.Formats, "Custom FS support", t)
+	assert.IncludesString("pdf", extra.Formats, "Custom FS support", t)
+	assert.IncludesString("webp", extra.Formats, "Custom FS support", t)
+}
+
+func TestInfo3Level2(t *testing.T) {
+	fs := FeatureSet2()
+	i := fs.Info()
+	i.ID = "http://example.com/iiif/foo"
+	i.Width, i.Height = 800, 400
+	i3 := i.V3()
+
+	assert.Equal(Context3, i3.Context, "3.0 context", t)
+	assert.Equal("ImageService3", i3.Type, "3.0 type", t)
+	assert.Equal("http://example.com/iiif/foo", i3.ID, "id is copied", t)
+	assert.Equal(800, i3.Width, "width is copied", t)
+
+	// 3.0 levels 1 and 2 require regionSquare, which isn't part of the 2.x
+	// level 2 features, so a 2.x level 2 server is 3.0 level 0 plus extras
+	assert.Equal("level0", i3.Profile, "3.0 profile", t)
+	assert.IncludesString("regionByPct", i3.ExtraFeatures, "extra feature", t)
+	assert.IncludesString("rotationBy90s", i3.ExtraFeatures, "extra feature", t)
+	assert.IncludesString("sizeByConfinedWh", i3.ExtraFeatures, "extra feature", t)
+	assert.IncludesString("gray", i3.ExtraQualities, "extra quality", t)
+	assert.IncludesString("png", i3.ExtraFormats, "extra format", t)
+}
+
+func TestInfo3AllFeatures(t *testing.T) {
+	i3 := AllFeatures().Info().V3()
+	assert.Equal("level2", i3.Profile, "3.0 profile", t)
+	assert.Equal(5, len(i3.ExtraFeatures), "extra features", t)
+	assert.IncludesString("sizeUpscaling", i3.ExtraFeatures, "sizeAboveFull is renamed in 3.0", t)
+	assert.IncludesString("mirroring", i3.ExtraFeatures, "extra feature", t)
+	assert.IncludesString("rotationArbitrary", i3.ExtraFeatures, "extra feature", t)
+	assert.IncludesString("profileLinkHeader", i3.ExtraFeatures, "extra feature", t)
+	assert.IncludesString("canonicalLinkHeader", i3.ExtraFeatures, "extra feature", t)
+	assert.Equal(2, len(i3.ExtraQualities), "extra qualities", t)
+	assert.Equal(4, len(i3.ExtraFormats), "extra formats", t)
+	assert.IncludesString("jp2", i3.ExtraFormats, "extra format", t)
+	assert.IncludesString("tif", i3.ExtraFormats, "extra format", t)
+	assert.IncludesString("pdf", i3.ExtraFormats, "extra format", t)
+	assert.IncludesString("webp", i3.ExtraFormats, "extra format", t)
+}
+
+func TestProfileURI(t *testing.T) {
+	assert.Equal(ProfileLevel1URI, FeatureSet1().ProfileURI(Version2), "2.x level 1", t)
+	assert.Equal("http://iiif.io/api/image/3/level2.json", AllFeatures().ProfileURI(Version3), "3.0 level 2", t)
+	assert.Equal("http://iiif.io/api/image/3/level0.json", FeatureSet2().ProfileURI(Version3), "2.x level 2 is 3.0 level 0", t)
+}
+
+func TestInfo3JSON(t *testing.T) {
+	i := FeatureSet0().Info()
+	i.Profile.MaxHeight = 500
+	var data, err = json.Marshal(i.V3())
+	assert.NilError(err, "marshaling 3.0 info", t)
+
+	var raw map[string]any
+	assert.NilError(json.Unmarshal(data, &raw), "unmarshaling 3.0 info", t)
+	assert.Equal("level0", raw["profile"], "profile is a plain string", t)
+	assert.Equal(float64(500), raw["maxHeight"], "maxHeight", t)
+	assert.Equal(float64(math.MaxInt32), raw["maxWidth"], "maxWidth must be present when maxHeight is", t)
+	assert.True(raw["@id"] == nil, "no 2.x @id", t)
+	assert.True(raw["extraFeatures"] == nil, "empty extras are omitted", t)
+}
+
+func TestProfileFeatureSetRoundTrip(t *testing.T) {
+	fs := AllFeatures()
+	fs.Webp = true
+	var _, onlyA, onlyB = FeatureCompare(fs, fs.Profile().FeatureSet())
+	assert.Equal(0, len(onlyA), "nothing lost converting a profile back to a FeatureSet", t)
+	assert.Equal(0, len(onlyB), "nothing gained converting a profile back to a FeatureSet", t)
 }
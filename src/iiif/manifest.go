@@ -0,0 +1,155 @@
+package iiif
+
+// ContextPresentation3 is the JSON-LD context for IIIF Presentation API 3.0
+// documents
+const ContextPresentation3 = "http://iiif.io/api/presentation/3/context.json"
+
+// LanguageMap is a Presentation 3.0 language map, e.g., {"en": ["Title"]}.
+// The key "none" is used for values with no particular language.
+type LanguageMap map[string][]string
+
+// MetadataEntry is a single label/value pair in a manifest's metadata
+type MetadataEntry struct {
+	Label LanguageMap `json:"label"`
+	Value LanguageMap `json:"value"`
+}
+
+// ManifestDescription holds the descriptive data for a manifest: everything
+// that can't be derived from the image itself.  It's typically read from a
+// JSON sidecar file, so it uses plain strings rather than language maps, and
+// Language applies to all of them ("none" if it's empty).
+type ManifestDescription struct {
+	Language string             `json:"language"`
+	Label    string             `json:"label"`
+	Summary  string             `json:"summary"`
+	Metadata []DescriptionEntry `json:"metadata"`
+}
+
+// DescriptionEntry is a single label/value pair in a ManifestDescription
+type DescriptionEntry struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Manifest is a minimal IIIF Presentation 3.0 manifest: a single canvas
+// painted with a single image, backed by an image service
+type Manifest struct {
+	Context  string          `json:"@context"`
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Label    LanguageMap     `json:"label"`
+	Summary  LanguageMap     `json:"summary,omitempty"`
+	Metadata []MetadataEntry `json:"metadata,omitempty"`
+	Items    []Canvas        `json:"items"`
+}
+
+// Canvas is a Presentation 3.0 canvas
+type Canvas struct {
+	ID     string           `json:"id"`
+	Type   string           `json:"type"`
+	Width  int              `json:"width"`
+	Height int              `json:"height"`
+	Items  []AnnotationPage `json:"items"`
+}
+
+// AnnotationPage is a Presentation 3.0 annotation page
+type AnnotationPage struct {
+	ID    string       `json:"id"`
+	Type  string       `json:"type"`
+	Items []Annotation `json:"items"`
+}
+
+// Annotation is a Presentation 3.0 painting annotation
+type Annotation struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Motivation string          `json:"motivation"`
+	Body       AnnotationImage `json:"body"`
+	Target     string          `json:"target"`
+}
+
+// AnnotationImage is the image resource an annotation paints onto a canvas
+type AnnotationImage struct {
+	ID      string         `json:"id"`
+	Type    string         `json:"type"`
+	Format  string         `json:"format"`
+	Width   int            `json:"width"`
+	Height  int            `json:"height"`
+	Service []ImageService `json:"service"`
+}
+
+// ImageService references a IIIF image service.  Presentation 3.0 describes
+// 3.0 services with "id" and "type", but 2.x services keep their JSON-LD
+// "@id" and "@type" keys.
+type ImageService struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type,omitempty"`
+	LDID    string `json:"@id,omitempty"`
+	LDType  string `json:"@type,omitempty"`
+	Profile string `json:"profile"`
+}
+
+// NewManifest builds a single-canvas manifest with the given id.  The canvas
+// is sized to the image info describes, and the image's service is info.ID,
+// which must be the full URL to the image under the given API version.  desc
+// may be nil, in which case the manifest's label is simply fallbackLabel.
+func NewManifest(id string, info *Info, v Version, desc *ManifestDescription, fallbackLabel string) *Manifest {
+	var m = &Manifest{
+		Context: ContextPresentation3,
+		ID:      id,
+		Type:    "Manifest",
+		Label:   LanguageMap{"none": {fallbackLabel}},
+	}
+
+	if desc != nil {
+		var lang = desc.Language
+		if lang == "" {
+			lang = "none"
+		}
+		if desc.Label != "" {
+			m.Label = LanguageMap{lang: {desc.Label}}
+		}
+		if desc.Summary != "" {
+			m.Summary = LanguageMap{lang: {desc.Summary}}
+		}
+		for _, md := range desc.Metadata {
+			m.Metadata = append(m.Metadata, MetadataEntry{
+				Label: LanguageMap{lang: {md.Label}},
+				Value: LanguageMap{lang: {md.Value}},
+			})
+		}
+	}
+
+	var service = ImageService{ID: info.ID, Type: "ImageService3", Profile: info.V3().Profile}
+	if v != Version3 {
+		service = ImageService{LDID: info.ID, LDType: "ImageService2", Profile: info.Profile.ConformanceURL}
+	}
+
+	var canvasID = id + "/canvas/1"
+	m.Items = []Canvas{{
+		ID:     canvasID,
+		Type:   "Canvas",
+		Width:  info.Width,
+		Height: info.Height,
+		Items: []AnnotationPage{{
+			ID:   id + "/page/1",
+			Type: "AnnotationPage",
+			Items: []Annotation{{
+				ID:         id + "/annotation/1",
+				Type:       "Annotation",
+				Motivation: "painting",
+				Target:     canvasID,
+				Body: AnnotationImage{
+					ID:      info.ID + "/full/max/0/default.jpg",
+					Type:    "Image",
+					Format:  "image/jpeg",
+					Width:   info.Width,
+					Height:  info.Height,
+					Service: []ImageService{service},
+				},
+			}},
+		}},
+	}}
+
+	return m
+}
@@ -0,0 +1,87 @@
+package iiif
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func testManifestInfo() *Info {
+	var i = FeatureSet2().Info()
+	i.ID = "http://example.com/iiif/foo.jp2"
+	i.Width = 800
+	i.Height = 400
+	return i
+}
+
+func TestNewManifest(t *testing.T) {
+	var m = NewManifest("http://example.com/manifest/foo.jp2", testManifestInfo(), Version2, nil, "foo.jp2")
+	assert.Equal(ContextPresentation3, m.Context, "context", t)
+	assert.Equal("Manifest", m.Type, "type", t)
+	if diff := cmp.Diff(LanguageMap{"none": {"foo.jp2"}}, m.Label); diff != "" {
+		t.Errorf("fallback label: %s", diff)
+	}
+	assert.Equal(0, len(m.Metadata), "no metadata without a description", t)
+
+	assert.Equal(1, len(m.Items), "one canvas", t)
+	var c = m.Items[0]
+	assert.Equal("http://example.com/manifest/foo.jp2/canvas/1", c.ID, "canvas id", t)
+	assert.Equal(800, c.Width, "canvas width", t)
+	assert.Equal(400, c.Height, "canvas height", t)
+
+	var a = c.Items[0].Items[0]
+	assert.Equal(c.ID, a.Target, "annotation targets the canvas", t)
+	assert.Equal("http://example.com/iiif/foo.jp2/full/max/0/default.jpg", a.Body.ID, "image id", t)
+	var want = []ImageService{{
+		LDID:    "http://example.com/iiif/foo.jp2",
+		LDType:  "ImageService2",
+		Profile: ProfileLevel2URI,
+	}}
+	if diff := cmp.Diff(want, a.Body.Service); diff != "" {
+		t.Errorf("2.x service: %s", diff)
+	}
+}
+
+func TestNewManifest3(t *testing.T) {
+	var i = testManifestInfo()
+	i.Profile = AllFeatures().Profile()
+	var m = NewManifest("http://example.com/manifest/foo.jp2", i, Version3, nil, "foo.jp2")
+	var want = []ImageService{{
+		ID:      "http://example.com/iiif/foo.jp2",
+		Type:    "ImageService3",
+		Profile: "level2",
+	}}
+	if diff := cmp.Diff(want, m.Items[0].Items[0].Items[0].Body.Service); diff != "" {
+		t.Errorf("3.0 service: %s", diff)
+	}
+}
+
+func TestNewManifestDescription(t *testing.T) {
+	var desc = &ManifestDescription{
+		Language: "en",
+		Label:    "World",
+		Summary:  "A map",
+		Metadata: []DescriptionEntry{{Label: "Date", Value: "1911"}},
+	}
+	var m = NewManifest("http://example.com/manifest/foo.jp2", testManifestInfo(), Version3, desc, "foo.jp2")
+	if diff := cmp.Diff(LanguageMap{"en": {"World"}}, m.Label); diff != "" {
+		t.Errorf("label: %s", diff)
+	}
+	if diff := cmp.Diff(LanguageMap{"en": {"A map"}}, m.Summary); diff != "" {
+		t.Errorf("summary: %s", diff)
+	}
+	var md = []MetadataEntry{{Label: LanguageMap{"en": {"Date"}}, Value: LanguageMap{"en": {"1911"}}}}
+	if diff := cmp.Diff(md, m.Metadata); diff != "" {
+		t.Errorf("metadata: %s", diff)
+	}
+
+	desc = &ManifestDescription{Summary: "A map"}
+	m = NewManifest("http://example.com/manifest/foo.jp2", testManifestInfo(), Version3, desc, "foo.jp2")
+	if diff := cmp.Diff(LanguageMap{"none": {"foo.jp2"}}, m.Label); diff != "" {
+		t.Errorf("empty label falls back: %s", diff)
+	}
+	if diff := cmp.Diff(LanguageMap{"none": {"A map"}}, m.Summary); diff != "" {
+		t.Errorf("empty language is none: %s", diff)
+	}
+}
@@ -82,7 +82,9 @@ func (r Region) Valid() bool {
 }
 
 // GetCrop determines the cropped area that this region represents given an
-// image width and height
+// image width and height.  Per the IIIF spec, a region extending past the
+// image's edges is clipped to the part that overlaps the image; if there is no
+// overlap, the result is an empty rectangle.
 func (r Region) GetCrop(w, h int) image.Rectangle {
 	crop := image.Rect(0, 0, w, h)
 
@@ -106,5 +108,5 @@ func (r Region) GetCrop(w, h int) image.Rectangle {
 		)
 	}
 
-	return crop
+	return crop.Intersect(image.Rect(0, 0, w, h))
 }
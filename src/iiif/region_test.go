@@ -1,6 +1,7 @@
 package iiif
 
 import (
+	"image"
 	"testing"
 
 	"github.com/uoregon-libraries/gopkg/assert"
@@ -43,3 +44,14 @@ func TestRegionTypeSquare(t *testing.T) {
 	r := StringToRegion("square")
 	assert.True(r.Type == RTSquare, "r.Type == RTSquare", t)
 }
+
+func TestGetCropClipped(t *testing.T) {
+	r := StringToRegion("300,200,400,400")
+	assert.Equal(image.Rect(300, 200, 400, 300), r.GetCrop(400, 300), "region is clipped to the image", t)
+
+	r = StringToRegion("400,0,100,100")
+	assert.True(r.GetCrop(400, 300).Empty(), "region starting at the image's edge is empty", t)
+
+	r = StringToRegion("pct:0,0,0.1,100")
+	assert.True(r.GetCrop(400, 300).Empty(), "region rounding to zero width is empty", t)
+}
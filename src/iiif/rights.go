@@ -0,0 +1,51 @@
+package iiif
+
+// PartOf identifies a larger resource, such as a manifest or collection,
+// which an image is part of
+type PartOf struct {
+	ID    string      `json:"id"`
+	Type  string      `json:"type"`
+	Label LanguageMap `json:"label,omitempty"`
+}
+
+// Rights holds an image's rights and attribution metadata.  IIIF 2.1 info
+// responses describe these with the attribution, license, and logo
+// properties, while 3.0 responses carry the license as "rights", along with
+// partOf.  3.0 has no place for attribution or a logo in info responses.
+type Rights struct {
+	Attribution string   `json:"attribution,omitempty"`
+	License     string   `json:"license,omitempty"`
+	Logo        string   `json:"logo,omitempty"`
+	PartOf      []PartOf `json:"partOf,omitempty"`
+}
+
+// Merge returns a copy of r with each non-empty value in o replacing r's, so
+// more specific sources of rights data can be layered over general defaults
+func (r Rights) Merge(o Rights) Rights {
+	if o.Attribution != "" {
+		r.Attribution = o.Attribution
+	}
+	if o.License != "" {
+		r.License = o.License
+	}
+	if o.Logo != "" {
+		r.Logo = o.Logo
+	}
+	if len(o.PartOf) > 0 {
+		r.PartOf = o.PartOf
+	}
+	return r
+}
+
+// Rights returns the info's rights data
+func (i *Info) Rights() Rights {
+	return Rights{Attribution: i.Attribution, License: i.License, Logo: i.Logo, PartOf: i.PartOf}
+}
+
+// SetRights replaces the info's rights data
+func (i *Info) SetRights(r Rights) {
+	i.Attribution = r.Attribution
+	i.License = r.License
+	i.Logo = r.Logo
+	i.PartOf = r.PartOf
+}
@@ -0,0 +1,35 @@
+package iiif
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestRightsMerge(t *testing.T) {
+	var global = Rights{Attribution: "Global", License: "http://example.com/license", Logo: "http://example.com/logo.png"}
+	var partOf = []PartOf{{ID: "http://example.com/collection", Type: "Collection"}}
+	var r = global.Merge(Rights{Attribution: "Specific", PartOf: partOf})
+
+	var want = Rights{Attribution: "Specific", License: "http://example.com/license", Logo: "http://example.com/logo.png", PartOf: partOf}
+	if diff := cmp.Diff(want, r); diff != "" {
+		t.Errorf("merged rights: %s", diff)
+	}
+	assert.Equal("Global", global.Attribution, "merging doesn't alter the original", t)
+}
+
+func TestInfoRights(t *testing.T) {
+	var i = FeatureSet2().Info()
+	var partOf = []PartOf{{ID: "http://example.com/manifest", Type: "Manifest", Label: LanguageMap{"en": {"A book"}}}}
+	i.SetRights(Rights{Attribution: "Someone", License: "http://example.com/license", PartOf: partOf})
+
+	assert.Equal("Someone", i.Attribution, "2.x attribution", t)
+	assert.Equal("http://example.com/license", i.License, "2.x license", t)
+
+	var i3 = i.V3()
+	assert.Equal("http://example.com/license", i3.Rights, "3.0 rights come from the license", t)
+	if diff := cmp.Diff(partOf, i3.PartOf); diff != "" {
+		t.Errorf("3.0 partOf: %s", diff)
+	}
+}
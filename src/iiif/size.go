@@ -35,27 +35,41 @@
 )
 
 // Size represents the type of scaling as well as the parameters for scaling
-// for a IIIF 2.0 server
+// for a IIIF server.  Upscale is set when the size was prefixed with "^",
+// which IIIF 3.0 requires for any request that would scale above the region's
+// dimensions.
 type Size struct {
 	Type    SizeType
 	Percent float64
 	W, H    int
+	Upscale bool
 }
 
-// StringToSize creates a Size from a string as seen in a IIIF URL.
+// StringToSize creates a Size from a string as seen in a IIIF URL.  A leading
+// "^" is stripped and recorded in the Size's Upscale field.
 func StringToSize(p string) Size {
 	if p == "" {
 		return Size{}
 	}
 
-	if p == "full" {
+	var upscale bool
+	if p[0] == '^' {
+		upscale = true
+		p = p[1:]
+	}
+
+	// "^full" isn't a thing: full is always exactly the region's size
+	if p == "full" && !upscale {
 		return Size{Type: STFull}
 	}
 	if p == "max" {
-		return Size{Type: STMax}
+		return Size{Type: STMax, Upscale: upscale}
 	}
 
-	s := Size{Type: STNone}
+	s := Size{Type: STNone, Upscale: upscale}
+	if p == "" {
+		return s
+	}
 
 	if len(p) > 4 && p[0:4] == "pct:" {
 		s.Type = STScalePercent
@@ -134,6 +148,12 @@ func (s Size) GetResize(region image.Rectangle) image.Rectangle {
 	return image.Rect(0, 0, w, h)
 }
 
+// Upscales returns true if the given resize rectangle is larger than the
+// region in either dimension
+func Upscales(region, resize image.Rectangle) bool {
+	return resize.Dx() > region.Dx() || resize.Dy() > region.Dy()
+}
+
 // getBestFit preserves the aspect ratio while determining the proper scaling
 // factor to get width and height adjusted to fit within the width and height
 // of the desired size operation
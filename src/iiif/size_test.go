@@ -52,6 +52,33 @@ func TestSizeTypeBestFit(t *testing.T) {
 	assert.Equal(50, s.H, "s.H", t)
 }
 
+func TestSizeUpscale(t *testing.T) {
+	var tests = map[string]Size{
+		"^125,":    {Type: STScaleToWidth, W: 125, Upscale: true},
+		"^,250":    {Type: STScaleToHeight, H: 250, Upscale: true},
+		"^pct:150": {Type: STScalePercent, Percent: 150, Upscale: true},
+		"^!25,50":  {Type: STBestFit, W: 25, H: 50, Upscale: true},
+		"^25,50":   {Type: STExact, W: 25, H: 50, Upscale: true},
+		"^max":     {Type: STMax, Upscale: true},
+	}
+
+	for str, expected := range tests {
+		var s = StringToSize(str)
+		assert.True(s.Valid(), str+" is valid", t)
+		assert.Equal(expected, s, str+" parsed", t)
+	}
+
+	assert.False(StringToSize("125,").Upscale, "no caret means no upscale", t)
+}
+
+func TestUpscales(t *testing.T) {
+	var region = image.Rect(0, 0, 600, 1200)
+	assert.False(Upscales(region, image.Rect(0, 0, 600, 1200)), "same size", t)
+	assert.False(Upscales(region, image.Rect(0, 0, 300, 600)), "smaller", t)
+	assert.True(Upscales(region, image.Rect(0, 0, 601, 1200)), "wider", t)
+	assert.True(Upscales(region, image.Rect(0, 0, 100, 1201)), "taller", t)
+}
+
 func TestInvalidSizes(t *testing.T) {
 	s := Size{}
 	assert.True(!s.Valid(), "!s.Valid()", t)
@@ -69,6 +96,10 @@ func TestInvalidSizes(t *testing.T) {
 	assert.True(!s.Valid(), "!s.Valid()", t)
 	s = StringToSize("pct:0")
 	assert.True(!s.Valid(), "!s.Valid()", t)
+	s = StringToSize("^full")
+	assert.True(!s.Valid(), "!s.Valid()", t)
+	s = StringToSize("^")
+	assert.True(!s.Valid(), "!s.Valid()", t)
 }
 
 func TestGetResize(t *testing.T) {
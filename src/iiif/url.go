@@ -24,6 +24,7 @@ func (id ID) Escaped() string {
 // URL represents the different options composed into a IIIF URL request
 type URL struct {
 	Path     string
+	Version  Version
 	ID       ID
 	Region   Region
 	Size     Size
@@ -70,8 +71,18 @@ func (p *pathParts) rejoin() string {
 // theoretically exist for a resource with *any* id.  In those cases it's up to
 // the caller to figure out what to do - the returned URL will have as much
 // information as we're able to parse.
+//
+// The path is validated against the IIIF Image API 2.x rules; use
+// NewVersionedURL for 3.0 requests.
 func NewURL(path string) (*URL, error) {
-	var u = &URL{Path: path}
+	return NewVersionedURL(path, Version2)
+}
+
+// NewVersionedURL works exactly like NewURL, but validates the path against
+// the rules for the given IIIF Image API version.  For instance, the "full"
+// size and "native" quality are valid in 2.x, but not in 3.0.
+func NewVersionedURL(path string, v Version) (*URL, error) {
+	var u = &URL{Path: path, Version: v}
 
 	// Check for an info request first since it's pretty trivial to do
 	if strings.HasSuffix(path, "info.json") {
@@ -105,6 +116,17 @@ func NewURL(path string) (*URL, error) {
 	return u, nil
 }
 
+// Params returns the region, size, rotation, and quality/format segments of
+// the URL's path exactly as they were requested, for comparison against the
+// canonical form.  Info requests have no parameters.
+func (u *URL) Params() string {
+	var parts = strings.Split(u.Path, "/")
+	if u.Info || len(parts) < 5 {
+		return ""
+	}
+	return strings.Join(parts[len(parts)-4:], "/")
+}
+
 // Valid returns the validity of the request - is the syntax is bad in any way?
 // Are any numbers outside a set range?  Was the identifier blank?  Etc.
 //
@@ -122,13 +144,13 @@ func (u *URL) Error() error {
 	if !u.Region.Valid() {
 		messages = append(messages, "invalid region")
 	}
-	if !u.Size.Valid() {
+	if !u.Size.Valid() || (u.Version == Version3 && u.Size.Type == STFull) {
 		messages = append(messages, "invalid size")
 	}
 	if !u.Rotation.Valid() {
 		messages = append(messages, "invalid rotation")
 	}
-	if !u.Quality.Valid() {
+	if !u.Quality.Valid() || (u.Version == Version3 && u.Quality == QNative) {
 		messages = append(messages, "invalid quality")
 	}
 	if !u.Format.Valid() {
@@ -57,3 +57,18 @@ func TestInfoBaseRedirect(t *testing.T) {
 	assert.Equal("empty id, invalid region, invalid size, invalid rotation, invalid quality", err.Error(), "base redirects are error cases the caller must handle", t)
 	assert.Equal("", string(i.ID), "identifier", t)
 }
+
+func TestVersion3Rules(t *testing.T) {
+	i, err := NewVersionedURL(url.QueryEscape(weirdID)+"/full/max/0/default.jpg", Version3)
+	assert.NilError(err, "3.0 max size is valid", t)
+	assert.Equal(Version3, i.Version, "version is stored", t)
+
+	_, err = NewVersionedURL(simplePath, Version3)
+	assert.Equal("invalid size", err.Error(), "3.0 doesn't allow the full size", t)
+
+	_, err = NewVersionedURL(url.QueryEscape(weirdID)+"/full/max/0/native.jpg", Version3)
+	assert.Equal("invalid quality", err.Error(), "3.0 doesn't allow the native quality", t)
+
+	_, err = NewURL(url.QueryEscape(weirdID) + "/full/full/0/native.jpg")
+	assert.NilError(err, "2.x allows full and native", t)
+}
@@ -0,0 +1,25 @@
+package iiif
+
+// Version identifies which major version of the IIIF Image API a request or
+// response conforms to
+type Version int
+
+// All IIIF Image API versions RAIS can speak
+const (
+	Version2 Version = 2
+	Version3 Version = 3
+)
+
+// Context URIs for the supported API versions
+const (
+	Context2 = "http://iiif.io/api/image/2/context.json"
+	Context3 = "http://iiif.io/api/image/3/context.json"
+)
+
+// Context returns the JSON-LD context URI for the version
+func (v Version) Context() string {
+	if v == Version3 {
+		return Context3
+	}
+	return Context2
+}
@@ -0,0 +1,255 @@
+package img
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"rais/src/transform"
+	"strings"
+)
+
+// BitonalMode identifies how bitonal output decides which pixels are black
+type BitonalMode int
+
+// Available bitonal modes.  Otsu, the zero value, picks a single threshold
+// for each requested region from its histogram.  Fixed uses a configured
+// threshold for everything.  Sauvola computes a threshold for each pixel from
+// its neighborhood, which copes with uneven lighting and faint scans.  Dither
+// uses Floyd-Steinberg error diffusion to approximate the gray levels.
+const (
+	BitonalOtsu BitonalMode = iota
+	BitonalFixed
+	BitonalSauvola
+	BitonalDither
+)
+
+var bitonalModeNames = map[BitonalMode]string{
+	BitonalOtsu:    "otsu",
+	BitonalFixed:   "fixed",
+	BitonalSauvola: "sauvola",
+	BitonalDither:  "dither",
+}
+
+// String returns the mode's name as ParseBitonalMode accepts it
+func (m BitonalMode) String() string {
+	var name, ok = bitonalModeNames[m]
+	if !ok {
+		return fmt.Sprintf("BitonalMode(%d)", int(m))
+	}
+	return name
+}
+
+// ParseBitonalMode returns the mode with the given name, ignoring case
+func ParseBitonalMode(name string) (BitonalMode, error) {
+	name = strings.ToLower(name)
+	for m, n := range bitonalModeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return BitonalOtsu, fmt.Errorf("unknown bitonal mode %q", name)
+}
+
+// Default bitonal settings, used when a Bitonal's values are zero
+const (
+	DefaultBitonalThreshold = 190
+	DefaultBitonalWindow    = 31
+	DefaultBitonalK         = 0.34
+)
+
+// Bitonal holds the settings for converting images to bitonal output.  The
+// zero value uses Otsu's method.
+type Bitonal struct {
+	Mode BitonalMode
+
+	// Threshold is the gray level above which pixels are white in Fixed mode
+	Threshold uint8
+
+	// Window is the width and height of the neighborhood Sauvola mode examines
+	// around each pixel, and K is its sensitivity: higher values make more of
+	// the image white
+	Window int
+	K      float64
+}
+
+// Convert returns a black-and-white copy of img
+func (b Bitonal) Convert(img image.Image) *image.Gray {
+	var g = gray8(img)
+	switch b.Mode {
+	case BitonalFixed:
+		var t = b.Threshold
+		if t == 0 {
+			t = DefaultBitonalThreshold
+		}
+		return threshold(g, t)
+	case BitonalSauvola:
+		return b.sauvola(g)
+	case BitonalDither:
+		return dither(g)
+	}
+	return threshold(g, otsu(g))
+}
+
+// gray8 returns img as an 8-bit grayscale image with bounds starting at the
+// origin
+func gray8(img image.Image) *image.Gray {
+	var g, ok = grayscale(img).(*image.Gray)
+	if ok && g.Bounds().Min == image.ZP {
+		return g
+	}
+
+	var b = img.Bounds()
+	g = image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	transform.Parallel(b.Dy(), b.Dx(), func(lo, hi int) {
+		draw.Draw(g, image.Rect(0, lo, b.Dx(), hi), img, image.Pt(b.Min.X, b.Min.Y+lo), draw.Src)
+	})
+	return g
+}
+
+// threshold returns a bitonal image where pixels of g brighter than t are
+// white and all others are black
+func threshold(g *image.Gray, t uint8) *image.Gray {
+	var b = g.Bounds()
+	var out = image.NewGray(b)
+	transform.Parallel(b.Dy(), b.Dx(), func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var src = g.Pix[y*g.Stride:][:b.Dx()]
+			var dst = out.Pix[y*out.Stride:][:b.Dx()]
+			for x, p := range src {
+				if p > t {
+					dst[x] = 255
+				}
+			}
+		}
+	})
+	return out
+}
+
+// otsu returns the threshold which best separates g's histogram into two
+// classes, by maximizing the variance between them
+func otsu(g *image.Gray) uint8 {
+	var b = g.Bounds()
+	var hist [256]int
+	for y := 0; y < b.Dy(); y++ {
+		for _, p := range g.Pix[y*g.Stride:][:b.Dx()] {
+			hist[p]++
+		}
+	}
+
+	var total = b.Dx() * b.Dy()
+	var sumAll float64
+	for i, n := range hist {
+		sumAll += float64(i * n)
+	}
+
+	var best uint8
+	var bestVar, sumBelow float64
+	var below int
+	for t, n := range hist {
+		below += n
+		if below == 0 {
+			continue
+		}
+		var above = total - below
+		if above == 0 {
+			break
+		}
+		sumBelow += float64(t * n)
+		var meanBelow = sumBelow / float64(below)
+		var meanAbove = (sumAll - sumBelow) / float64(above)
+		var diff = meanBelow - meanAbove
+		var v = float64(below) * float64(above) * diff * diff
+		if v > bestVar {
+			bestVar, best = v, uint8(t)
+		}
+	}
+
+	return best
+}
+
+// sauvola thresholds each pixel against its neighborhood's mean m and
+// standard deviation s: T = m * (1 + k * (s/128 - 1)).  Integral images of
+// the pixel values and their squares make each neighborhood's statistics
+// cheap to compute regardless of the window size.
+func (b Bitonal) sauvola(g *image.Gray) *image.Gray {
+	var window, k = b.Window, b.K
+	if window < 1 {
+		window = DefaultBitonalWindow
+	}
+	if k == 0 {
+		k = DefaultBitonalK
+	}
+
+	var bounds = g.Bounds()
+	var w, h = bounds.Dx(), bounds.Dy()
+	var iw = w + 1
+	var sum = make([]uint64, iw*(h+1))
+	var sq = make([]uint64, iw*(h+1))
+	for y := 0; y < h; y++ {
+		var rowSum, rowSq uint64
+		for x, p := range g.Pix[y*g.Stride:][:w] {
+			rowSum += uint64(p)
+			rowSq += uint64(p) * uint64(p)
+			sum[(y+1)*iw+x+1] = sum[y*iw+x+1] + rowSum
+			sq[(y+1)*iw+x+1] = sq[y*iw+x+1] + rowSq
+		}
+	}
+
+	var out = image.NewGray(bounds)
+	var r = window / 2
+	transform.Parallel(h, w, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var y0, y1 = max(y-r, 0), min(y+r+1, h)
+			var src = g.Pix[y*g.Stride:][:w]
+			var dst = out.Pix[y*out.Stride:][:w]
+			for x, p := range src {
+				var x0, x1 = max(x-r, 0), min(x+r+1, w)
+				var n = float64((x1 - x0) * (y1 - y0))
+				var s = sum[y1*iw+x1] - sum[y0*iw+x1] - sum[y1*iw+x0] + sum[y0*iw+x0]
+				var s2 = sq[y1*iw+x1] - sq[y0*iw+x1] - sq[y1*iw+x0] + sq[y0*iw+x0]
+				var mean = float64(s) / n
+				var stddev = math.Sqrt(max(float64(s2)/n-mean*mean, 0))
+				if float64(p) > mean*(1+k*(stddev/128-1)) {
+					dst[x] = 255
+				}
+			}
+		}
+	})
+
+	return out
+}
+
+// dither converts g to black and white with Floyd-Steinberg error diffusion.
+// Each pixel's error feeds into the pixels after it, so this has to run
+// serially.
+func dither(g *image.Gray) *image.Gray {
+	var b = g.Bounds()
+	var w, h = b.Dx(), b.Dy()
+	var out = image.NewGray(b)
+
+	// Errors are kept in sixteenths, with a pixel of padding on each side so
+	// the edges don't need special cases
+	var cur = make([]int, w+2)
+	var next = make([]int, w+2)
+	for y := 0; y < h; y++ {
+		var src = g.Pix[y*g.Stride:][:w]
+		var dst = out.Pix[y*out.Stride:][:w]
+		for x, p := range src {
+			var v = int(p) + (cur[x+1]+8)>>4
+			var e = v
+			if v > 127 {
+				dst[x] = 255
+				e = v - 255
+			}
+			cur[x+2] += e * 7
+			next[x] += e * 3
+			next[x+1] += e * 5
+			next[x+2] += e
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+
+	return out
+}
@@ -0,0 +1,113 @@
+package img
+
+import (
+	"image"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestParseBitonalMode(t *testing.T) {
+	for _, m := range []BitonalMode{BitonalOtsu, BitonalFixed, BitonalSauvola, BitonalDither} {
+		var got, err = ParseBitonalMode(m.String())
+		assert.NilError(err, "parsing "+m.String(), t)
+		assert.Equal(m, got, "round trip", t)
+	}
+	var _, err = ParseBitonalMode("nope")
+	assert.True(err != nil, "unknown modes are an error", t)
+}
+
+// grayImage returns a w x h grayscale image with each pixel set by fn
+func grayImage(w, h int, fn func(x, y int) uint8) *image.Gray {
+	var g = image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			g.Pix[y*g.Stride+x] = fn(x, y)
+		}
+	}
+	return g
+}
+
+// countWhite returns the number of white pixels in g
+func countWhite(g *image.Gray) int {
+	var n int
+	for _, p := range g.Pix {
+		if p == 255 {
+			n++
+		}
+	}
+	return n
+}
+
+// darkScan is a faint, dark scan: "ink" at 40 on "paper" at 110, which a
+// fixed threshold of 190 turns entirely black
+func darkScan(x, y int) uint8 {
+	if x%10 < 3 {
+		return 40
+	}
+	return 110
+}
+
+func TestBitonalOtsu(t *testing.T) {
+	var g = grayImage(100, 20, darkScan)
+	var out = Bitonal{}.Convert(g)
+	assert.Equal(uint8(0), out.GrayAt(1, 1).Y, "ink is black", t)
+	assert.Equal(uint8(255), out.GrayAt(5, 1).Y, "paper is white", t)
+	assert.Equal(1400, countWhite(out), "all paper is white", t)
+
+	var t2 = otsu(grayImage(10, 10, func(x, y int) uint8 { return 77 }))
+	assert.Equal(uint8(0), t2, "a flat image has no split", t)
+}
+
+func TestBitonalFixed(t *testing.T) {
+	var g = grayImage(100, 20, darkScan)
+	assert.Equal(0, countWhite(Bitonal{Mode: BitonalFixed}.Convert(g)), "default threshold is 190", t)
+	assert.Equal(1400, countWhite(Bitonal{Mode: BitonalFixed, Threshold: 100}.Convert(g)), "custom threshold", t)
+}
+
+// TestBitonalSauvola uses a page which is bright on the left and dark on the
+// right, with ink in both halves: no single threshold can separate ink from
+// paper on both sides, but Sauvola's local thresholds can
+func TestBitonalSauvola(t *testing.T) {
+	var g = grayImage(200, 40, func(x, y int) uint8 {
+		var paper, ink uint8 = 220, 120
+		if x >= 100 {
+			paper, ink = 110, 30
+		}
+		if x%10 < 3 {
+			return ink
+		}
+		return paper
+	})
+	var out = Bitonal{Mode: BitonalSauvola, Window: 15}.Convert(g)
+	assert.Equal(uint8(0), out.GrayAt(21, 20).Y, "bright-side ink is black", t)
+	assert.Equal(uint8(255), out.GrayAt(25, 20).Y, "bright-side paper is white", t)
+	assert.Equal(uint8(0), out.GrayAt(151, 20).Y, "dark-side ink is black", t)
+	assert.Equal(uint8(255), out.GrayAt(155, 20).Y, "dark-side paper is white", t)
+
+	out = Bitonal{}.Convert(g)
+	var lost = out.GrayAt(21, 20).Y == 255 || out.GrayAt(155, 20).Y == 0
+	assert.True(lost, "a global threshold can't handle both sides", t)
+}
+
+func TestBitonalDither(t *testing.T) {
+	var mid = Bitonal{Mode: BitonalDither}.Convert(grayImage(64, 64, func(x, y int) uint8 { return 128 }))
+	var white = countWhite(mid)
+	assert.True(white > 64*64*45/100 && white < 64*64*55/100, "mid-gray dithers to about half white", t)
+
+	var dark = Bitonal{Mode: BitonalDither}.Convert(grayImage(64, 64, func(x, y int) uint8 { return 64 }))
+	white = countWhite(dark)
+	assert.True(white > 64*64*20/100 && white < 64*64*30/100, "dark gray dithers to about a quarter white", t)
+
+	assert.Equal(0, countWhite(Bitonal{Mode: BitonalDither}.Convert(image.NewGray(image.Rect(0, 0, 8, 8)))), "black stays black", t)
+}
+
+func TestBitonalGray16(t *testing.T) {
+	var g = image.NewGray16(image.Rect(5, 5, 25, 15))
+	for n := 0; n < len(g.Pix); n += 4 {
+		g.Pix[n], g.Pix[n+1] = 0xff, 0xff
+	}
+	var out = Bitonal{Mode: BitonalFixed}.Convert(g)
+	assert.Equal(image.Rect(0, 0, 20, 10), out.Bounds(), "output bounds start at the origin", t)
+	assert.Equal(100, countWhite(out), "16-bit input is converted", t)
+}
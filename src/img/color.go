@@ -0,0 +1,122 @@
+package img
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"rais/src/icc"
+	"rais/src/iiif"
+	"strings"
+)
+
+// ICCDecoder is an optional interface for decoders which can report the
+// source image's embedded ICC color profile
+type ICCDecoder interface {
+	GetICCProfile() []byte
+}
+
+// ColorMode identifies what happens to images with embedded color profiles
+type ColorMode int
+
+// Available color modes.  ColorConvert, the zero value, converts pixels to
+// sRGB so browsers show them correctly without color management.
+// ColorEmbed leaves pixels alone and embeds the source profile in JPEG, PNG,
+// and TIFF output, falling back to conversion for formats which can't carry
+// a profile.  ColorIgnore treats all pixels as sRGB, which is how RAIS
+// behaved before profiles were read.
+const (
+	ColorConvert ColorMode = iota
+	ColorEmbed
+	ColorIgnore
+)
+
+var colorModeNames = map[ColorMode]string{
+	ColorConvert: "convert",
+	ColorEmbed:   "embed",
+	ColorIgnore:  "ignore",
+}
+
+// String returns the mode's name as ParseColorMode accepts it
+func (m ColorMode) String() string {
+	var name, ok = colorModeNames[m]
+	if !ok {
+		return fmt.Sprintf("ColorMode(%d)", int(m))
+	}
+	return name
+}
+
+// ParseColorMode returns the mode with the given name, ignoring case
+func ParseColorMode(name string) (ColorMode, error) {
+	name = strings.ToLower(name)
+	for m, n := range colorModeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return ColorConvert, fmt.Errorf("unknown color management mode %q", name)
+}
+
+// canEmbedProfile returns true if we know how to embed a profile in f
+func canEmbedProfile(f iiif.Format) bool {
+	switch f {
+	case iiif.FmtJPG, iiif.FmtPNG, iiif.FmtTIF:
+		return true
+	}
+	return false
+}
+
+// manageColor applies res.ColorMode to a freshly decoded image, converting
+// its pixels in place or keeping its profile for EmbeddedProfile.  Profiles
+// we can't convert from (e.g., LUT-based ones) are embedded instead when the
+// format allows, so color-managed viewers still get it right.
+func (res *Resource) manageColor(d Decoder, m image.Image, f iiif.Format) {
+	res.profile = nil
+	if res.ColorMode == ColorIgnore {
+		return
+	}
+	var id, ok = d.(ICCDecoder)
+	if !ok {
+		return
+	}
+	var data = id.GetICCProfile()
+	if len(data) == 0 {
+		return
+	}
+
+	if res.ColorMode == ColorEmbed && canEmbedProfile(f) {
+		res.profile = data
+		return
+	}
+
+	var p, err = icc.Parse(data)
+	if err == nil && p.IsSRGB() {
+		return
+	}
+	if err == nil {
+		err = p.ConvertToSRGB(m)
+	}
+	if err != nil && canEmbedProfile(f) {
+		res.profile = data
+	}
+}
+
+// keepProfile drops the embedded profile if the final image no longer has
+// the color space it describes, such as an RGB profile after a gray or
+// bitonal quality conversion
+func (res *Resource) keepProfile(m image.Image) {
+	if len(res.profile) < 20 {
+		res.profile = nil
+		return
+	}
+	var cm = m.ColorModel()
+	var gray = cm == color.GrayModel || cm == color.Gray16Model
+	if gray != (string(res.profile[16:20]) == icc.ColorSpaceGray) {
+		res.profile = nil
+	}
+}
+
+// EmbeddedProfile returns the ICC profile which should be embedded in the
+// image most recently returned by Apply, or nil if there isn't one
+func (res *Resource) EmbeddedProfile() []byte {
+	return res.profile
+}
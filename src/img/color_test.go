@@ -0,0 +1,100 @@
+package img
+
+import (
+	"encoding/binary"
+	"image"
+	"rais/src/iiif"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+// colorDecoder decodes a fixed image with an embedded profile
+type colorDecoder struct {
+	fakeDecoder
+	img     image.Image
+	profile []byte
+}
+
+func (d *colorDecoder) DecodeImage() (image.Image, error) { return d.img, nil }
+func (d *colorDecoder) GetICCProfile() []byte             { return d.profile }
+
+// grayProfile returns a grayscale ICC profile with a single gamma curve
+func grayProfile(gamma float64) []byte {
+	var p = make([]byte, 128+4+12+14)
+	binary.BigEndian.PutUint32(p, uint32(len(p)))
+	copy(p[16:], "GRAYXYZ ")
+	copy(p[36:], "acsp")
+	binary.BigEndian.PutUint32(p[128:], 1)
+	copy(p[132:], "kTRC")
+	binary.BigEndian.PutUint32(p[136:], 144)
+	binary.BigEndian.PutUint32(p[140:], 14)
+	copy(p[144:], "curv")
+	binary.BigEndian.PutUint32(p[152:], 1)
+	binary.BigEndian.PutUint16(p[156:], uint16(gamma*256))
+	return p
+}
+
+func newColorResource(mode ColorMode, profile []byte) (*Resource, *image.Gray) {
+	var m = image.NewGray(image.Rect(0, 0, 2, 1))
+	m.Pix = []uint8{128, 255}
+	var d = &colorDecoder{fakeDecoder: fakeDecoder{w: 2, h: 1}, img: m, profile: profile}
+	return &Resource{decoder: d, ColorMode: mode}, m
+}
+
+func applyColor(t *testing.T, res *Resource, params string) {
+	var url, _ = iiif.NewURL("identifier/full/max/0/" + params)
+	var _, err = res.Apply(url, unlimited)
+	assert.NilError(err, params+": img.Apply should not have errors", t)
+}
+
+func TestParseColorMode(t *testing.T) {
+	for _, m := range []ColorMode{ColorConvert, ColorEmbed, ColorIgnore} {
+		var got, err = ParseColorMode(m.String())
+		assert.NilError(err, "parsing "+m.String(), t)
+		assert.Equal(m, got, "round trip", t)
+	}
+	var _, err = ParseColorMode("perceptual")
+	assert.True(err != nil, "unknown modes are rejected", t)
+}
+
+func TestColorConvert(t *testing.T) {
+	var res, m = newColorResource(ColorConvert, grayProfile(1.8))
+	applyColor(t, res, "default.png")
+	assert.True(m.Pix[0] > 128, "gamma 1.8 mid gray is lightened for sRGB", t)
+	assert.Equal(uint8(255), m.Pix[1], "white stays white", t)
+	assert.Equal(0, len(res.EmbeddedProfile()), "converted images don't embed a profile", t)
+}
+
+func TestColorEmbed(t *testing.T) {
+	var res, m = newColorResource(ColorEmbed, grayProfile(1.8))
+	applyColor(t, res, "default.png")
+	assert.Equal(uint8(128), m.Pix[0], "pixels are left alone", t)
+	assert.Equal(158, len(res.EmbeddedProfile()), "profile is embedded", t)
+
+	res, m = newColorResource(ColorEmbed, grayProfile(1.8))
+	applyColor(t, res, "default.webp")
+	assert.True(m.Pix[0] > 128, "formats without profiles are converted instead", t)
+	assert.Equal(0, len(res.EmbeddedProfile()), "no profile for WebP", t)
+}
+
+func TestColorIgnore(t *testing.T) {
+	var res, m = newColorResource(ColorIgnore, grayProfile(1.8))
+	applyColor(t, res, "default.png")
+	assert.Equal(uint8(128), m.Pix[0], "pixels are left alone", t)
+	assert.Equal(0, len(res.EmbeddedProfile()), "no profile", t)
+}
+
+func TestColorUnsupportedProfile(t *testing.T) {
+	var profile = grayProfile(1.8)
+	copy(profile[16:], "RGB ")
+
+	// We can't convert an RGB profile without colorants, so it's embedded
+	// where possible, but an RGB profile makes no sense for bitonal output
+	var d = &colorDecoder{fakeDecoder: fakeDecoder{w: 2, h: 1}, img: image.NewRGBA(image.Rect(0, 0, 2, 1)), profile: profile}
+	var res = &Resource{decoder: d}
+	applyColor(t, res, "default.jpg")
+	assert.Equal(len(profile), len(res.EmbeddedProfile()), "unconvertible profile is embedded", t)
+	applyColor(t, res, "bitonal.jpg")
+	assert.Equal(0, len(res.EmbeddedProfile()), "RGB profile is dropped from gray output", t)
+}
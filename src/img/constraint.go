@@ -12,3 +12,9 @@ type Constraint struct {
 func (c Constraint) SmallerThanAny(w, h int) bool {
 	return w > c.Width || h > c.Height || int64(w)*int64(h) > c.Area
 }
+
+// Min returns a constraint holding the smaller of each of c's and o's
+// maximums
+func (c Constraint) Min(o Constraint) Constraint {
+	return Constraint{Width: min(c.Width, o.Width), Height: min(c.Height, o.Height), Area: min(c.Area, o.Area)}
+}
@@ -2,6 +2,7 @@
 
 import (
 	"image"
+	"rais/src/transform"
 )
 
 // Decoder defines an interface for reading images in a generic way.  It's
@@ -18,6 +19,33 @@ type Decoder interface {
 	SetResizeWH(int, int)
 }
 
+// Resolution is an image's physical pixel density in dots per inch.  Zero
+// values mean the density is unknown.
+type Resolution struct {
+	X, Y float64
+}
+
+// ResolutionDecoder is an optional interface for decoders which can report
+// the source image's physical resolution
+type ResolutionDecoder interface {
+	GetResolution() Resolution
+}
+
+// FilterDecoder is an optional interface for decoders which resample images
+// themselves (e.g., after decoding a lower resolution level) and can use a
+// filter other than the default bilinear one
+type FilterDecoder interface {
+	SetScaleFilter(transform.Filter)
+}
+
+// ScaleFilters holds the resampling filters used by decoders implementing
+// FilterDecoder.  Tile applies to requests for part of an image, while Full
+// applies to requests for the whole image, such as thumbnails and downloads.
+type ScaleFilters struct {
+	Tile transform.Filter
+	Full transform.Filter
+}
+
 // DecodeHandler is a function which takes a Streamer and returns a DecodeFunc and
 // optionally an error.  If the error is ErrSkipped, the function is stating
 // that it doesn't handle images the Streamer describes (typically just a brief
@@ -13,4 +13,6 @@ func (re imgError) Error() string {
 	ErrInvalidFiletype        imgError = "invalid or unknown file type"
 	ErrDimensionsExceedLimits imgError = "requested image size exceeds server maximums"
 	ErrNotStreamable          imgError = "no registered streamers"
+	ErrUpscaleNotAllowed      imgError = "requested size is larger than the region but upscaling wasn't requested"
+	ErrRegionOutsideImage     imgError = "requested region lies entirely outside the image"
 )
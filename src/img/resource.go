@@ -17,11 +17,35 @@
 // have for any image, as well as the image ID and URL.  The actual decoder is
 // lazy-loaded when it's needed.
 type Resource struct {
-	ID         iiif.ID
-	URL        *url.URL
+	ID  iiif.ID
+	URL *url.URL
+
+	// RotationFill is the color used for the corners exposed by arbitrary
+	// rotations when the output format can't store transparency.  White is used
+	// if this is nil.
+	RotationFill color.Color
+
+	// ScaleFilters tells decoders which resampling filter to use, if they
+	// implement FilterDecoder
+	ScaleFilters ScaleFilters
+
+	// Bitonal holds the settings for bitonal quality requests
+	Bitonal Bitonal
+
+	// ColorMode tells Apply what to do with images whose decoders report an
+	// embedded color profile
+	ColorMode ColorMode
+
 	streamer   Streamer
 	decoder    Decoder
 	decodeFunc DecodeFunc
+	profile    []byte
+
+	// scaleX and scaleY are the output image's pixels per source pixel, and
+	// swapAxes is true when a right-angle rotation turned the source's x axis
+	// into the output's y axis; all are set by Apply
+	scaleX, scaleY float64
+	swapAxes       bool
 }
 
 // NewResource initializes and returns an Resource for the given URL
@@ -88,18 +112,24 @@ func getDecodeFunc(s Streamer) (d DecodeFunc, err error) {
 }
 
 // getResizeWithConstraints returns a scaled rectangle, computing the best fit
-// for the given dimensions combined with our local constraints
-func getResizeWithConstraints(crop image.Rectangle, max Constraint) image.Rectangle {
+// for the given dimensions combined with our local constraints.  When upscale
+// is true ("^max"), the crop may be enlarged to fill the constraints, but only
+// if a width or height constraint exists; otherwise there's nothing sensible
+// to scale up to and the crop's size is used.
+func getResizeWithConstraints(crop image.Rectangle, max Constraint, upscale bool) image.Rectangle {
 	// First figure out the ideal width and height within our max width and height
 	cx := crop.Dx()
 	cy := crop.Dy()
 
-	// Sanity - we don't actually want any upscaling
-	if max.Width > cx {
-		max.Width = cx
-	}
-	if max.Height > cy {
-		max.Height = cy
+	// Sanity - we don't want any upscaling unless it was explicitly requested
+	// and there's a limit to scale up to
+	if !upscale || (max.Width == math.MaxInt32 && max.Height == math.MaxInt32) {
+		if max.Width > cx {
+			max.Width = cx
+		}
+		if max.Height > cy {
+			max.Height = cy
+		}
 	}
 
 	s := iiif.Size{Type: iiif.STBestFit, W: max.Width, H: max.Height}
@@ -120,6 +150,20 @@ func getResizeWithConstraints(crop image.Rectangle, max Constraint) image.Rectan
 	return image.Rect(0, 0, int(xf), int(yf))
 }
 
+// Dimensions returns the source region and the scaled output size a IIIF
+// request resolves to for an image of the given width and height.  No
+// validation is done; Apply is responsible for rejecting disallowed sizes.
+func Dimensions(u *iiif.URL, w, h int, max Constraint) (crop, scale image.Rectangle) {
+	crop = u.Region.GetCrop(w, h)
+
+	// If size is "max", we actually want the "best fit" size type, but with our
+	// constraints used instead of a user-supplied value.
+	if u.Size.Type == iiif.STMax {
+		return crop, getResizeWithConstraints(crop, max, u.Size.Upscale)
+	}
+	return crop, u.Size.GetResize(crop)
+}
+
 // Decoder attempts to initialize the registered decoder.  Because this can
 // read from disk, it should only be called when it has to be called.  It may
 // return errors if reading the image fails.
@@ -132,6 +176,35 @@ func (res *Resource) Decoder() (Decoder, error) {
 	return res.decoder, err
 }
 
+// Resolution returns the source image's DPI if the decoder knows it, or a
+// zero Resolution otherwise
+func (res *Resource) Resolution() Resolution {
+	var d, err = res.Decoder()
+	if err != nil {
+		return Resolution{}
+	}
+	if rd, ok := d.(ResolutionDecoder); ok {
+		return rd.GetResolution()
+	}
+	return Resolution{}
+}
+
+// OutputResolution returns the DPI of the image Apply produced: the source
+// image's DPI scaled along with its pixels, so the output still describes
+// the same physical size.  Before Apply is called, or if the source DPI is
+// unknown, this is the same as Resolution.
+func (res *Resource) OutputResolution() Resolution {
+	var r = res.Resolution()
+	if res.scaleX > 0 && res.scaleY > 0 {
+		r.X *= res.scaleX
+		r.Y *= res.scaleY
+	}
+	if res.swapAxes {
+		r.X, r.Y = r.Y, r.X
+	}
+	return r
+}
+
 // Streamer returns the contained Streamer interface
 func (res *Resource) Streamer() Streamer {
 	return res.streamer
@@ -147,42 +220,60 @@ func (res *Resource) Apply(u *iiif.URL, max Constraint) (image.Image, error) {
 	}
 
 	// Crop and resize have to be prepared before we can decode
-	w, h := decoder.GetWidth(), decoder.GetHeight()
-	crop := u.Region.GetCrop(w, h)
+	crop, scale := Dimensions(u, decoder.GetWidth(), decoder.GetHeight(), max)
 
-	// If size is "max", we actually want the "best fit" size type, but with our
-	// constraints used instead of a user-supplied value.
-	var scale image.Rectangle
-	if u.Size.Type == iiif.STMax {
-		scale = getResizeWithConstraints(crop, max)
-	} else {
-		scale = u.Size.GetResize(crop)
+	// Regions are clipped to the image, so an empty crop means there's nothing
+	// left to decode
+	if crop.Empty() {
+		return nil, ErrRegionOutsideImage
 	}
 
-	// Determine the final image output dimensions to test size constraints
-	sw, sh := scale.Dx(), scale.Dy()
-	if u.Rotation.Degrees == 90 || u.Rotation.Degrees == 270 {
-		sw, sh = sh, sw
+	// Scaling above the region's size is only allowed when explicitly requested
+	if !u.Size.Upscale && iiif.Upscales(crop, scale) {
+		return nil, ErrUpscaleNotAllowed
 	}
+
+	// Determine the final image output dimensions to test size constraints.
+	// Arbitrary rotations grow the canvas to hold the rotated image, so the
+	// rotated bounds are what has to fit.
+	sw, sh := transform.RotatedSize(scale.Dx(), scale.Dy(), u.Rotation.Degrees)
 	if max.SmallerThanAny(sw, sh) {
 		return nil, ErrDimensionsExceedLimits
 	}
 
+	res.scaleX = float64(scale.Dx()) / float64(crop.Dx())
+	res.scaleY = float64(scale.Dy()) / float64(crop.Dy())
+	res.swapAxes = u.Rotation.Degrees == 90 || u.Rotation.Degrees == 270
+
 	decoder.SetCrop(crop)
 	decoder.SetResizeWH(scale.Dx(), scale.Dy())
+	if fd, ok := decoder.(FilterDecoder); ok {
+		var f = res.ScaleFilters.Tile
+		if crop == image.Rect(0, 0, decoder.GetWidth(), decoder.GetHeight()) || u.Region.Type == iiif.RTSquare {
+			f = res.ScaleFilters.Full
+		}
+		fd.SetScaleFilter(f)
+	}
 
 	img, err := decoder.DecodeImage()
 	if err != nil {
 		return nil, errors.New("unable to decode image: " + err.Error())
 	}
+	res.manageColor(decoder, img, u.Format)
 
 	if u.Rotation.Mirror || u.Rotation.Degrees != 0 {
-		img, err = rotate(img, u.Rotation)
+		img, err = rotate(img, u.Rotation, res.rotationBackground(u.Format))
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// Gray and bitonal output have no alpha channel, and neither do some
+	// formats, so transparency has to be flattened onto a background first
+	if u.Quality == iiif.QGray || u.Quality == iiif.QBitonal || !keepsAlpha(u.Format) {
+		img = flatten(img, res.fillColor())
+	}
+
 	// Unless I'm missing something, QColor doesn't actually change an image -
 	// e.g., if it's already color, nothing happens.  If it's grayscale, there's
 	// nothing to do (obviously we shouldn't report it, but oh well)
@@ -190,13 +281,66 @@ func (res *Resource) Apply(u *iiif.URL, max Constraint) (image.Image, error) {
 	case iiif.QGray:
 		img = grayscale(img)
 	case iiif.QBitonal:
-		img, err = bitonal(img)
+		img = res.Bitonal.Convert(img)
 	}
+	res.keepProfile(img)
 
 	return img, nil
 }
 
-func rotate(img image.Image, rot iiif.Rotation) (image.Image, error) {
+// keepsAlpha returns true if we can encode transparency in f
+func keepsAlpha(f iiif.Format) bool {
+	switch f {
+	case iiif.FmtPNG, iiif.FmtWEBP, iiif.FmtTIF:
+		return true
+	}
+	return false
+}
+
+// fillColor returns the configured opaque background color
+func (res *Resource) fillColor() color.Color {
+	if res.RotationFill == nil {
+		return color.White
+	}
+	return res.RotationFill
+}
+
+// rotationBackground returns the color for areas an arbitrary rotation
+// exposes: transparent for formats which can store it, the configured fill
+// color otherwise
+func (res *Resource) rotationBackground(f iiif.Format) color.Color {
+	if keepsAlpha(f) {
+		return color.Transparent
+	}
+	return res.fillColor()
+}
+
+// flatten composites images with an alpha channel (NRGBA and NRGBA64, which
+// only decoders of images with alpha produce) onto bg.  Other images are
+// returned as-is.
+func flatten(img image.Image, bg color.Color) image.Image {
+	var dst draw.Image
+	switch i := img.(type) {
+	case *image.NRGBA:
+		dst = image.NewRGBA(image.Rect(0, 0, i.Rect.Dx(), i.Rect.Dy()))
+	case *image.NRGBA64:
+		dst = image.NewRGBA64(image.Rect(0, 0, i.Rect.Dx(), i.Rect.Dy()))
+	default:
+		return img
+	}
+
+	var b = img.Bounds()
+
+	var fill = image.NewUniform(bg)
+	transform.Parallel(b.Dy(), b.Dx(), func(lo, hi int) {
+		var band = image.Rect(0, lo, b.Dx(), hi)
+		draw.Draw(dst, band, fill, image.Point{}, draw.Src)
+		draw.Draw(dst, band, img, image.Pt(b.Min.X, b.Min.Y+lo), draw.Over)
+	})
+	return dst
+}
+
+func rotate(img image.Image, rot iiif.Rotation, bg color.Color) (image.Image, error) {
 	var r transform.Rotator
 	switch img0 := img.(type) {
 	case *image.Gray:
@@ -207,6 +351,10 @@ func rotate(img image.Image, rot iiif.Rotation) (image.Image, error) {
 		r = &transform.Gray16Rotator{Img: img0}
 	case *image.RGBA64:
 		r = &transform.RGBA64Rotator{Img: img0}
+	case *image.NRGBA:
+		r = &transform.NRGBARotator{Img: img0}
+	case *image.NRGBA64:
+		r = &transform.NRGBA64Rotator{Img: img0}
 	default:
 		return nil, fmt.Errorf("unable to rotate image: unsupported image type %T", img)
 	}
@@ -216,12 +364,15 @@ func rotate(img image.Image, rot iiif.Rotation) (image.Image, error) {
 	}
 
 	switch rot.Degrees {
+	case 0:
 	case 90:
 		r.Rotate90()
 	case 180:
 		r.Rotate180()
 	case 270:
 		r.Rotate270()
+	default:
+		return transform.Rotate(r.Image(), rot.Degrees, bg), nil
 	}
 
 	return r.Image(), nil
@@ -235,28 +386,12 @@ func grayscale(img image.Image) image.Image {
 
 	b := img.Bounds()
 	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
-	draw.Draw(dst, b, img, b.Min, draw.Src)
+	transform.Parallel(b.Dy(), b.Dx(), func(lo, hi int) {
+		draw.Draw(dst, image.Rect(0, lo, b.Dx(), hi), img, image.Pt(b.Min.X, b.Min.Y+lo), draw.Src)
+	})
 	return dst
 }
 
-func bitonal(img image.Image) (image.Image, error) {
-	// First turn the image into 8-bit grayscale for easier manipulation
-	imgGray, ok := grayscale(img).(*image.Gray)
-	if !ok {
-		return nil, fmt.Errorf("unable to cast image to grayscale")
-	}
-
-	b := imgGray.Bounds()
-	imgBitonal := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
-	for i, pixel := range imgGray.Pix {
-		if pixel > 190 {
-			imgBitonal.Pix[i] = 255
-		}
-	}
-
-	return imgBitonal, nil
-}
-
 // Destroy lets the resource clean up any open streams, etc.  This *must* be
 // called to prevent resource leaks!
 func (res *Resource) Destroy() {
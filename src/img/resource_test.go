@@ -2,8 +2,10 @@
 
 import (
 	"image"
+	"image/color"
 	"math"
 	"rais/src/iiif"
+	"rais/src/transform"
 	"testing"
 
 	"github.com/uoregon-libraries/gopkg/assert"
@@ -21,6 +23,7 @@ type fakeDecoder struct {
 	crop    image.Rectangle
 	resizeW int
 	resizeH int
+	filter  transform.Filter
 }
 
 func (d *fakeDecoder) DecodeImage() (image.Image, error) { return nil, nil }
@@ -31,6 +34,7 @@ func (d *fakeDecoder) GetTileHeight() int                { return d.th }
 func (d *fakeDecoder) GetLevels() int                    { return d.l }
 func (d *fakeDecoder) SetCrop(rect image.Rectangle)      { d.crop = rect }
 func (d *fakeDecoder) SetResizeWH(w, h int)              { d.resizeW, d.resizeH = w, h }
+func (d *fakeDecoder) SetScaleFilter(f transform.Filter) { d.filter = f }
 
 func TestSquareRegionTall(t *testing.T) {
 	var d = &fakeDecoder{w: 400, h: 950, tw: 64, th: 64, l: 1}
@@ -62,6 +66,44 @@ func TestSquareRegionWide(t *testing.T) {
 	assert.Equal(650, d.crop.Max.Y, "wide image bottom", t)
 }
 
+func TestRegionClipped(t *testing.T) {
+	var d = &fakeDecoder{w: 400, h: 300, tw: 128, th: 128, l: 4}
+	var img = &Resource{decoder: d}
+	var url, _ = iiif.NewURL("identifier/300,200,400,400/full/0/default.jpg")
+	var _, err = img.Apply(url, unlimited)
+	assert.True(err == nil, "img.Apply should not have errors", t)
+	assert.Equal(image.Rect(300, 200, 400, 300), d.crop, "crop is clipped to the image", t)
+	assert.Equal(100, d.resizeW, "resize width", t)
+	assert.Equal(100, d.resizeH, "resize height", t)
+}
+
+func TestRegionOutsideImage(t *testing.T) {
+	var d = &fakeDecoder{w: 400, h: 300, tw: 128, th: 128, l: 4}
+	var img = &Resource{decoder: d}
+	for _, region := range []string{"400,0,10,10", "0,300,10,10", "500,500,100,100"} {
+		var url, _ = iiif.NewURL("identifier/" + region + "/full/0/default.jpg")
+		var _, err = img.Apply(url, unlimited)
+		assert.Equal(ErrRegionOutsideImage, err, region+" should be rejected", t)
+	}
+}
+
+func TestScaleFilterBySizeClass(t *testing.T) {
+	var d = &fakeDecoder{w: 4000, h: 650, tw: 128, th: 128, l: 4}
+	var img = &Resource{decoder: d, ScaleFilters: ScaleFilters{Tile: transform.CatmullRom, Full: transform.Lanczos3}}
+	var tests = map[string]transform.Filter{
+		"full/200,":         transform.Lanczos3,
+		"square/75,":        transform.Lanczos3,
+		"0,0,4000,650/200,": transform.Lanczos3,
+		"0,0,1024,650/200,": transform.CatmullRom,
+	}
+	for params, want := range tests {
+		var url, _ = iiif.NewURL("identifier/" + params + "/0/default.jpg")
+		var _, err = img.Apply(url, unlimited)
+		assert.True(err == nil, "img.Apply should not have errors", t)
+		assert.Equal(want, d.filter, params+" filter", t)
+	}
+}
+
 func TestMaxSizeNoConstraints(t *testing.T) {
 	var d = &fakeDecoder{w: 4000, h: 650, tw: 128, th: 128, l: 4}
 	var img = &Resource{decoder: d}
@@ -108,16 +150,18 @@ func TestMaxSizeConstrainHeight(t *testing.T) {
 func TestRotateImageTypes(t *testing.T) {
 	r := image.Rect(0, 0, 4, 3)
 	cases := map[string]image.Image{
-		"Gray":   image.NewGray(r),
-		"RGBA":   image.NewRGBA(r),
-		"Gray16": image.NewGray16(r),
-		"RGBA64": image.NewRGBA64(r),
+		"Gray":    image.NewGray(r),
+		"RGBA":    image.NewRGBA(r),
+		"Gray16":  image.NewGray16(r),
+		"RGBA64":  image.NewRGBA64(r),
+		"NRGBA":   image.NewNRGBA(r),
+		"NRGBA64": image.NewNRGBA64(r),
 	}
 
 	for name, src := range cases {
 		for _, deg := range []int{90, 180, 270} {
 			rot := iiif.Rotation{Degrees: float64(deg)}
-			out, err := rotate(src, rot)
+			out, err := rotate(src, rot, color.White)
 			assert.NilError(err, name+" rotation should not error", t)
 			assert.True(out != nil, name+" rotation should produce an image", t)
 
@@ -133,17 +177,60 @@ func TestRotateImageTypes(t *testing.T) {
 		}
 
 		// Mirror should also work for every type
-		out, err := rotate(src, iiif.Rotation{Mirror: true})
+		out, err := rotate(src, iiif.Rotation{Mirror: true}, color.White)
 		assert.NilError(err, name+" mirror should not error", t)
 		assert.True(out != nil, name+" mirror should produce an image", t)
 	}
 }
 
+func TestRotateArbitrary(t *testing.T) {
+	var src = image.NewRGBA(image.Rect(0, 0, 40, 20))
+	var out, err = rotate(src, iiif.Rotation{Degrees: 30, Mirror: true}, color.Transparent)
+	assert.NilError(err, "arbitrary rotation should not error", t)
+	assert.Equal(45, out.Bounds().Dx(), "30-degree width", t)
+	assert.Equal(38, out.Bounds().Dy(), "30-degree height", t)
+}
+
+func TestRotationBackground(t *testing.T) {
+	var res = &Resource{}
+	assert.Equal(color.Transparent, res.rotationBackground(iiif.FmtPNG), "PNG background", t)
+	assert.Equal(color.Transparent, res.rotationBackground(iiif.FmtWEBP), "WebP background", t)
+	assert.Equal(color.Transparent, res.rotationBackground(iiif.FmtTIF), "TIFF background", t)
+	assert.Equal(color.White, res.rotationBackground(iiif.FmtJPG), "default JPG background", t)
+
+	res.RotationFill = color.Black
+	assert.Equal(color.Black, res.rotationBackground(iiif.FmtJPG), "configured JPG background", t)
+	assert.Equal(color.Transparent, res.rotationBackground(iiif.FmtPNG), "PNG ignores fill", t)
+}
+
+func TestAlphaFlattening(t *testing.T) {
+	var src = image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	var d = &colorDecoder{fakeDecoder: fakeDecoder{w: 2, h: 1}, img: src}
+	var res = &Resource{decoder: d, RotationFill: color.RGBA{0, 0, 255, 255}}
+
+	var red = color.RGBA{255, 0, 0, 255}
+	var tests = map[string][2]color.Color{
+		"default.png":  {color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 0, 0}},
+		"default.webp": {color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 0, 0}},
+		"default.tif":  {color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 0, 0}},
+		"default.jpg":  {red, color.RGBA{0, 0, 255, 255}},
+		"gray.png":     {color.GrayModel.Convert(red), color.GrayModel.Convert(res.RotationFill)},
+	}
+	for params, want := range tests {
+		var url, _ = iiif.NewURL("identifier/full/max/0/" + params)
+		var out, err = res.Apply(url, unlimited)
+		assert.NilError(err, params+": img.Apply should not have errors", t)
+		assert.Equal(want[0], out.At(0, 0), params+": opaque pixel", t)
+		assert.Equal(want[1], out.At(1, 0), params+": transparent pixel", t)
+	}
+}
+
 // TestRotateUnsupportedType verifies rotate returns an error rather than
 // panicking when handed an image type it doesn't know how to rotate.
 func TestRotateUnsupportedType(t *testing.T) {
-	src := image.NewNRGBA(image.Rect(0, 0, 4, 3))
-	out, err := rotate(src, iiif.Rotation{Degrees: 180})
+	src := image.NewCMYK(image.Rect(0, 0, 4, 3))
+	out, err := rotate(src, iiif.Rotation{Degrees: 180}, color.White)
 	assert.True(out == nil, "unsupported type should not produce an image", t)
 	assert.True(err != nil, "unsupported type should return an error", t)
 }
@@ -161,3 +248,139 @@ func TestMaxSizeConstrainArea(t *testing.T) {
 	assert.Equal(500, d.resizeW, "resize width", t)
 	assert.Equal(75, d.resizeH, "resize height", t)
 }
+
+func TestMaxSizeRotated(t *testing.T) {
+	var d = &colorDecoder{fakeDecoder: fakeDecoder{w: 100, h: 100}, img: image.NewRGBA(image.Rect(0, 0, 100, 100))}
+	var res = &Resource{decoder: d}
+	var url, _ = iiif.NewURL("identifier/full/max/45/default.jpg")
+
+	// A 45-degree rotation needs a 142x142 canvas
+	var c = unlimited
+	c.Width = 141
+	var _, err = res.Apply(url, c)
+	assert.Equal(ErrDimensionsExceedLimits, err, "rotated width exceeds the limit", t)
+
+	c = unlimited
+	c.Area = 20000
+	_, err = res.Apply(url, c)
+	assert.Equal(ErrDimensionsExceedLimits, err, "rotated area exceeds the limit", t)
+
+	c.Area = 142 * 142
+	var m image.Image
+	m, err = res.Apply(url, c)
+	assert.NilError(err, "rotated image fits", t)
+	assert.Equal(image.Rect(0, 0, 142, 142), m.Bounds(), "rotated bounds", t)
+
+	url, _ = iiif.NewURL("identifier/full/100,50/90/default.jpg")
+	c = unlimited
+	c.Width, c.Height = 100, 50
+	_, err = res.Apply(url, c)
+	assert.Equal(ErrDimensionsExceedLimits, err, "right angles are still checked", t)
+}
+
+// resolutionDecoder reports a fixed source resolution
+type resolutionDecoder struct {
+	colorDecoder
+	res Resolution
+}
+
+func (d *resolutionDecoder) GetResolution() Resolution { return d.res }
+
+func TestOutputResolution(t *testing.T) {
+	var d = &resolutionDecoder{res: Resolution{X: 600, Y: 300}}
+	d.fakeDecoder = fakeDecoder{w: 4000, h: 2000}
+	d.img = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	var res = &Resource{decoder: d}
+	assert.Equal(Resolution{X: 600, Y: 300}, res.OutputResolution(), "source resolution before Apply", t)
+
+	var url, _ = iiif.NewURL("identifier/full/pct:25/0/default.pdf")
+	var _, err = res.Apply(url, unlimited)
+	assert.NilError(err, "scaled request", t)
+	assert.Equal(Resolution{X: 150, Y: 75}, res.OutputResolution(), "DPI scales with the image", t)
+	assert.Equal(Resolution{X: 600, Y: 300}, res.Resolution(), "source resolution is unchanged", t)
+
+	url, _ = iiif.NewURL("identifier/0,0,1000,1000/500,250/90/default.pdf")
+	_, err = res.Apply(url, unlimited)
+	assert.NilError(err, "distorted, rotated request", t)
+	assert.Equal(Resolution{X: 75, Y: 300}, res.OutputResolution(), "each axis scales separately and follows rotation", t)
+}
+
+func TestUpscaleRejected(t *testing.T) {
+	var d = &fakeDecoder{w: 400, h: 300, tw: 128, th: 128, l: 4}
+	var img = &Resource{decoder: d}
+	for _, size := range []string{"800,", ",600", "pct:150", "!800,800", "400,301"} {
+		var url, _ = iiif.NewVersionedURL("identifier/full/"+size+"/0/default.jpg", iiif.Version3)
+		var _, err = img.Apply(url, unlimited)
+		assert.Equal(ErrUpscaleNotAllowed, err, size+" without ^ should be rejected", t)
+	}
+}
+
+func TestUpscale(t *testing.T) {
+	var d = &fakeDecoder{w: 400, h: 300, tw: 128, th: 128, l: 4}
+	var img = &Resource{decoder: d}
+	var url, _ = iiif.NewVersionedURL("identifier/full/^pct:200/0/default.jpg", iiif.Version3)
+	var _, err = img.Apply(url, unlimited)
+	assert.True(err == nil, "img.Apply should not have errors", t)
+	assert.Equal(800, d.resizeW, "resize width", t)
+	assert.Equal(600, d.resizeH, "resize height", t)
+
+	var c = unlimited
+	c.Width = 600
+	_, err = img.Apply(url, c)
+	assert.Equal(ErrDimensionsExceedLimits, err, "upscaling must respect constraints", t)
+}
+
+func TestMaxUpscale(t *testing.T) {
+	var d = &fakeDecoder{w: 400, h: 300, tw: 128, th: 128, l: 4}
+	var img = &Resource{decoder: d}
+	var url, _ = iiif.NewVersionedURL("identifier/full/^max/0/default.jpg", iiif.Version3)
+
+	// With no width or height constraint, there's nothing to scale up to
+	var _, err = img.Apply(url, unlimited)
+	assert.True(err == nil, "img.Apply should not have errors", t)
+	assert.Equal(400, d.resizeW, "unconstrained resize width", t)
+	assert.Equal(300, d.resizeH, "unconstrained resize height", t)
+
+	var c = unlimited
+	c.Width = 1000
+	c.Height = 600
+	_, err = img.Apply(url, c)
+	assert.True(err == nil, "img.Apply should not have errors", t)
+	assert.Equal(800, d.resizeW, "constrained resize width", t)
+	assert.Equal(600, d.resizeH, "constrained resize height", t)
+
+	c.Area = 120000
+	_, err = img.Apply(url, c)
+	assert.True(err == nil, "img.Apply should not have errors", t)
+	assert.Equal(400, d.resizeW, "area-constrained resize width", t)
+	assert.Equal(300, d.resizeH, "area-constrained resize height", t)
+}
+
+// TestColorConversionParallel verifies grayscale and bitonal conversion give
+// the same results with and without helper goroutines, including for images
+// whose bounds don't start at the origin
+func TestColorConversionParallel(t *testing.T) {
+	var src = image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for n := range src.Pix {
+		src.Pix[n] = uint8(n * 7 % 251)
+	}
+	var sub = src.SubImage(image.Rect(10, 20, 590, 380))
+
+	var orig = transform.MaxWorkers()
+	defer transform.SetMaxWorkers(orig)
+
+	for _, i := range []image.Image{src, sub} {
+		transform.SetMaxWorkers(0)
+		var gray = grayscale(i).(*image.Gray)
+		var bitonalSerial = Bitonal{Mode: BitonalSauvola}.Convert(i)
+		transform.SetMaxWorkers(5)
+		var grayParallel = grayscale(i).(*image.Gray)
+		var bitonalParallel = Bitonal{Mode: BitonalSauvola}.Convert(i)
+
+		assert.Equal(string(gray.Pix), string(grayParallel.Pix), "grayscale output", t)
+		assert.Equal(string(bitonalSerial.Pix), string(bitonalParallel.Pix), "bitonal output", t)
+
+		var b = i.Bounds()
+		assert.Equal(color.GrayModel.Convert(i.At(b.Min.X+5, b.Min.Y+5)), gray.At(5, 5), "grayscale is read from the image bounds", t)
+	}
+}
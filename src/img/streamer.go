@@ -38,3 +38,14 @@ type Streamer interface {
 func RegisterStreamReader(fn StreamReader) {
 	streamReaders = append(streamReaders, fn)
 }
+
+// Open returns a Streamer for u from the first registered reader which
+// handles it.  This is how anything stored alongside an image, such as an
+// info.json override, can be read from wherever the image itself lives.
+func Open(u *url.URL) (Streamer, error) {
+	var openStream, err = getStreamOpener(u)
+	if err != nil {
+		return nil, err
+	}
+	return openStream()
+}
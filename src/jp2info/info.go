@@ -6,7 +6,18 @@
 // Known color methods
 const (
 	CMEnumerated    ColorMethod = 1
-	CMRestrictedICC             = 2
+	CMRestrictedICC ColorMethod = 2
+	CMAnyICC        ColorMethod = 3
+)
+
+// Format tells us which kind of file wraps the JPEG 2000 codestream
+type Format uint8
+
+// Known formats
+const (
+	FormatJP2 Format = iota
+	FormatJPX
+	FormatJ2K
 )
 
 // ColorSpace tells us how to parse color data coming from openjpeg
@@ -22,16 +33,22 @@
 
 // Info stores a variety of data we can easily scan from a jpeg2000 header
 type Info struct {
-	// Main header info
+	Format Format
+
+	// Main header info; for raw codestreams, these are computed from the SIZ
+	// marker
 	Width, Height uint32
 	Comps         uint16
-	BPC           uint8
 
 	// Color data
 	ColorMethod  ColorMethod
 	ColorSpace   ColorSpace
 	Prec, Approx uint8
 
+	// ICCProfile holds the raw embedded color profile when ColorMethod is one
+	// of the ICC methods
+	ICCProfile []byte
+
 	// From SIZ box - this data can replace the main header data and
 	// some of the colorspace data if necessary
 	LSiz, RSiz     uint16
@@ -41,11 +58,58 @@ type Info struct {
 	XTOSiz, YTOSiz uint32
 	CSiz           uint16
 
+	// Components holds the SIZ marker's per-component data
+	Components []Component
+
 	// From COD box
 	LCod   uint16
 	SCod   uint8
 	SGCod  uint32
 	Levels uint8
+
+	// From the optional resolution boxes, in pixels per meter; zero when the
+	// image doesn't specify a resolution
+	CaptureRes, DisplayRes Resolution
+}
+
+// Component describes one image component's sample format and subsampling
+type Component struct {
+	// Precision is the number of bits per sample, from 1 to 38
+	Precision uint8
+	Signed    bool
+
+	// DX and DY are the horizontal and vertical subsampling factors, e.g., 2
+	// for the chroma of a 4:2:0 image
+	DX, DY uint8
+}
+
+// MaxPrecision returns the highest precision of any component
+func (i *Info) MaxPrecision() uint8 {
+	var p uint8
+	for _, c := range i.Components {
+		p = max(p, c.Precision)
+	}
+	return p
+}
+
+// Resolution holds the vertical and horizontal grid resolution from a JP2
+// "resc" or "resd" box, converted to pixels per meter
+type Resolution struct {
+	X, Y float64
+}
+
+// metersPerInch lets us convert the JP2 resolution boxes to DPI
+const metersPerInch = 0.0254
+
+// DPI returns the image's resolution in dots per inch, preferring the
+// display resolution over the capture resolution.  Zeroes are returned if the
+// image has no resolution data.
+func (i *Info) DPI() (x, y float64) {
+	var r = i.DisplayRes
+	if r.X == 0 || r.Y == 0 {
+		r = i.CaptureRes
+	}
+	return r.X * metersPerInch, r.Y * metersPerInch
 }
 
 // TileWidth computes width of tiles
@@ -70,3 +134,16 @@ func (cs ColorSpace) String() string {
 	}
 	return "Unknown"
 }
+
+// String reports the Format in a human-readable way
+func (f Format) String() string {
+	switch f {
+	case FormatJP2:
+		return "JP2"
+	case FormatJPX:
+		return "JPX"
+	case FormatJ2K:
+		return "J2K"
+	}
+	return "Unknown"
+}
@@ -6,11 +6,12 @@
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"os"
 )
 
-// JP2HEADER contains the raw bytes for the only JP2 header we currently
-// respect
+// JP2HEADER contains the raw bytes of the JP2 signature box, which JPX files
+// share
 var JP2HEADER = []byte{
 	0x00, 0x00, 0x00, 0x0c,
 	0x6a, 0x50, 0x20, 0x20,
@@ -19,17 +20,28 @@
 
 // Various hard-coded byte values for finding JP2 boxes
 var (
+	FTYP   = []byte{0x66, 0x74, 0x79, 0x70} // "ftyp"
 	IHDR   = []byte{0x69, 0x68, 0x64, 0x72} // "ihdr"
 	COLR   = []byte{0x63, 0x6f, 0x6c, 0x72} // "colr"
+	RES    = []byte{0x72, 0x65, 0x73, 0x20} // "res "
+	RESC   = []byte{0x72, 0x65, 0x73, 0x63} // "resc"
+	RESD   = []byte{0x72, 0x65, 0x73, 0x64} // "resd"
 	SOCSIZ = []byte{0xFF, 0x4F, 0xFF, 0x51}
 	COD    = []byte{0xFF, 0x52}
 )
 
+// Brands we accept in the file type box
+var (
+	BrandJP2 = []byte{0x6a, 0x70, 0x32, 0x20} // "jp2 "
+	BrandJPX = []byte{0x6a, 0x70, 0x78, 0x20} // "jpx "
+)
+
 // Scanner reads a Jpeg2000 header and parsing its data into an Info structure
 type Scanner struct {
-	r *bufio.Reader
-	e error
-	i *Info
+	r      *bufio.Reader
+	e      error
+	i      *Info
+	window []byte
 }
 
 // Scan reads the file and populates an Info pointer
@@ -53,42 +65,147 @@ func (s *Scanner) readInfo(ior io.Reader) {
 	s.i = &Info{}
 	s.r = bufio.NewReader(ior)
 
-	// Make sure the header bytes are legit - this doesn't cover all types of
-	// JP2, but it works for what RAIS needs
-	var header = make([]byte, 12)
-	_, s.e = s.r.Read(header)
-	if !bytes.Equal(header, JP2HEADER) {
+	// Sniff the signature: raw codestreams start right off with the SOC and SIZ
+	// markers, while JP2 and JPX share a signature box and are told apart by
+	// the brand in the file type box
+	var header, _ = s.r.Peek(len(JP2HEADER))
+	switch {
+	case bytes.HasPrefix(header, SOCSIZ):
+		s.i.Format = FormatJ2K
+		s.r.Discard(len(SOCSIZ))
+		s.readCodestream()
+		s.i.Width = s.i.XSiz - s.i.XOSiz
+		s.i.Height = s.i.YSiz - s.i.YOSiz
+		s.i.Comps = s.i.CSiz
+		return
+	case bytes.Equal(header, JP2HEADER):
+		s.r.Discard(len(JP2HEADER))
+		s.readBrand()
+	default:
 		s.e = fmt.Errorf("unknown file format")
 		return
 	}
 
-	// Find IHDR for basic information
+	// Find IHDR for basic information.  We skip its bit depth, as it can only
+	// describe components which all share one depth; the SIZ marker always has
+	// the per-component values.
 	s.scanUntil(IHDR)
-	s.readBE(&s.i.Height, &s.i.Width, &s.i.Comps, &s.i.BPC)
-
-	// For some reason this is always 7 or 15
-	s.i.BPC++
+	s.readBE(&s.i.Height, &s.i.Width, &s.i.Comps)
 
-	// Find COLR to get colorspace data
+	// Find COLR to get colorspace data.  JPX files may have several; the first
+	// is the preferred one.
 	s.scanUntil(COLR)
 	s.readColor()
 
-	// Find various SIZ data
-	s.scanUntil(SOCSIZ)
+	// The resolution box is optional, so we have to look for it and the
+	// codestream at the same time
+	if s.scanUntilEither(RES, SOCSIZ) == 0 {
+		s.readResolution()
+		s.scanUntil(SOCSIZ)
+	}
+
+	s.readCodestream()
+}
+
+// readBrand reads the file type box which must follow the signature box,
+// setting the format from its brand.  Files with another brand are still
+// read if their compatibility list includes JP2 or JPX, as any JP2 reader
+// must handle them.
+func (s *Scanner) readBrand() {
+	var lbox, minV uint32
+	var tbox, brand = make([]byte, 4), make([]byte, 4)
+	s.readBE(&lbox, tbox, brand, &minV)
+	if s.e != nil {
+		return
+	}
+	if !bytes.Equal(tbox, FTYP) {
+		s.e = fmt.Errorf("missing file type box")
+		return
+	}
+	if lbox < 16 || lbox%4 != 0 {
+		s.e = fmt.Errorf("invalid file type box length %d", lbox)
+		return
+	}
+
+	var compat = make([]byte, lbox-16)
+	s.readBE(compat)
+	if s.e != nil {
+		return
+	}
+
+	switch {
+	case bytes.Equal(brand, BrandJP2):
+		s.i.Format = FormatJP2
+	case bytes.Equal(brand, BrandJPX):
+		s.i.Format = FormatJPX
+	case hasBrand(compat, BrandJP2):
+		s.i.Format = FormatJP2
+	case hasBrand(compat, BrandJPX):
+		s.i.Format = FormatJPX
+	default:
+		s.e = fmt.Errorf("unsupported brand %q", brand)
+	}
+}
+
+// hasBrand returns true if the file type box's compatibility list includes
+// the given brand
+func hasBrand(compat, brand []byte) bool {
+	for i := 0; i+4 <= len(compat); i += 4 {
+		if bytes.Equal(compat[i:i+4], brand) {
+			return true
+		}
+	}
+	return false
+}
+
+// readCodestream reads the main header of the codestream, which must start
+// right after the SIZ marker
+func (s *Scanner) readCodestream() {
+	// Read various SIZ data
 	s.readBE(&s.i.LSiz, &s.i.RSiz, &s.i.XSiz, &s.i.YSiz, &s.i.XOSiz,
 		&s.i.YOSiz, &s.i.XTSiz, &s.i.YTSiz, &s.i.XTOSiz, &s.i.YTOSiz, &s.i.CSiz)
+	s.readComponents()
 
 	// Find COD, primarily to get resolution levels
 	s.scanUntil(COD)
 	s.readBE(&s.i.LCod, &s.i.SCod, &s.i.SGCod, &s.i.Levels)
 }
 
+// readComponents reads the Ssiz, XRsiz, and YRsiz values for each component
+// in the SIZ marker.  The high bit of Ssiz flags signed samples, and the rest
+// is the precision minus one.
+func (s *Scanner) readComponents() {
+	if s.e != nil {
+		return
+	}
+
+	var raw = make([]byte, int(s.i.CSiz)*3)
+	_, s.e = io.ReadFull(s.r, raw)
+	if s.e != nil {
+		return
+	}
+
+	s.i.Components = make([]Component, s.i.CSiz)
+	for n := range s.i.Components {
+		var ssiz = raw[n*3]
+		s.i.Components[n] = Component{
+			Precision: ssiz&0x7f + 1,
+			Signed:    ssiz&0x80 != 0,
+			DX:        raw[n*3+1],
+			DY:        raw[n*3+2],
+		}
+	}
+}
+
 func (s *Scanner) readColor() {
 	s.readBE(&s.i.ColorMethod, &s.i.Prec, &s.i.Approx)
-	if s.i.ColorMethod == CMEnumerated {
+	switch s.i.ColorMethod {
+	case CMEnumerated:
 		s.readEnumeratedColor()
-	} else {
+	case CMRestrictedICC, CMAnyICC:
 		s.readColorProfile()
+	default:
+		s.i.ColorSpace = CSUnknown
 	}
 }
 
@@ -113,9 +230,107 @@ func (s *Scanner) readEnumeratedColor() {
 	}
 }
 
+// maxICCProfile is the largest embedded color profile we'll read.  Real
+// matrix/TRC profiles are a few kilobytes; anything past this is more likely
+// a corrupt box than a profile worth keeping in memory.
+const maxICCProfile = 4 << 20
+
+// readColorProfile reads the ICC profile embedded in a "colr" box, setting
+// the color space from the profile's header.  Profiles which are too small
+// or too large to be real are skipped rather than treated as errors, since
+// the image itself can still be decoded.
 func (s *Scanner) readColorProfile() {
-	// TODO: make this a bit more useful
 	s.i.ColorSpace = CSUnknown
+
+	var size uint32
+	s.readBE(&size)
+	if s.e != nil || size < 132 || size > maxICCProfile {
+		return
+	}
+
+	var profile = make([]byte, size)
+	binary.BigEndian.PutUint32(profile, size)
+	_, s.e = io.ReadFull(s.r, profile[4:])
+	if s.e != nil {
+		return
+	}
+	s.i.ICCProfile = profile
+
+	switch string(profile[16:20]) {
+	case "RGB ":
+		s.i.ColorSpace = CSRGB
+	case "GRAY":
+		s.i.ColorSpace = CSGrayScale
+	}
+}
+
+// readResolution reads the sub-boxes of a "res " superbox.  We rely on the
+// box length from the window scanUntilEither leaves behind, since each
+// sub-box is a fixed size.
+func (s *Scanner) readResolution() {
+	if s.e != nil {
+		return
+	}
+
+	var remaining = int64(binary.BigEndian.Uint32(s.window[:4])) - 8
+	for remaining >= 18 {
+		var lbox uint32
+		var tbox = make([]byte, 4)
+		var vrn, vrd, hrn, hrd uint16
+		var vre, hre int8
+		s.readBE(&lbox, tbox, &vrn, &vrd, &hrn, &hrd, &vre, &hre)
+		if s.e != nil || lbox != 18 {
+			return
+		}
+		remaining -= 18
+
+		if vrd == 0 || hrd == 0 {
+			continue
+		}
+		var r = Resolution{
+			X: float64(hrn) / float64(hrd) * math.Pow10(int(hre)),
+			Y: float64(vrn) / float64(vrd) * math.Pow10(int(vre)),
+		}
+		switch {
+		case bytes.Equal(tbox, RESC):
+			s.i.CaptureRes = r
+		case bytes.Equal(tbox, RESD):
+			s.i.DisplayRes = r
+		}
+	}
+}
+
+// scanUntilEither reads until one of the two tokens has been fully read in,
+// returning the index of the token found, or -1 on error.  Unlike scanUntil,
+// this requires the token's bytes to be contiguous, and it keeps the last
+// eight bytes read in s.window so a box's length can be read when its type is
+// the token.
+func (s *Scanner) scanUntilEither(a, b []byte) int {
+	if s.e != nil {
+		return -1
+	}
+
+	s.window = make([]byte, 0, 8)
+	for {
+		var c byte
+		c, s.e = s.r.ReadByte()
+		if s.e != nil {
+			return -1
+		}
+
+		if len(s.window) == cap(s.window) {
+			copy(s.window, s.window[1:])
+			s.window = s.window[:len(s.window)-1]
+		}
+		s.window = append(s.window, c)
+
+		if bytes.HasSuffix(s.window, a) {
+			return 0
+		}
+		if bytes.HasSuffix(s.window, b) {
+			return 1
+		}
+	}
 }
 
 // scanUntil reads until the given token has been found and fully read
@@ -0,0 +1,203 @@
+package jp2info
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+// be writes all data to buf in big-endian order
+func be(buf *bytes.Buffer, data ...any) {
+	for _, d := range data {
+		binary.Write(buf, binary.BigEndian, d)
+	}
+}
+
+// box writes a JP2 box with the given type and big-endian data
+func box(buf *bytes.Buffer, typ string, data ...any) {
+	var content = new(bytes.Buffer)
+	be(content, data...)
+	be(buf, uint32(content.Len()+8))
+	buf.WriteString(typ)
+	buf.Write(content.Bytes())
+}
+
+// srgbColor is the "colr" box content for an enumerated sRGB image
+var srgbColor = []any{uint8(1), uint8(0), uint8(0), uint32(16)}
+
+// fakeJP2 builds the minimal set of boxes and markers the scanner reads,
+// with the given color box content, optionally adding a resolution superbox
+func fakeJP2(colr []any, res []byte) []byte {
+	var buf = new(bytes.Buffer)
+	buf.Write(JP2HEADER)
+	box(buf, "ftyp", []byte("jp2 "), uint32(0), []byte("jp2 "))
+
+	var jp2h = new(bytes.Buffer)
+	box(jp2h, "ihdr", uint32(300), uint32(400), uint16(3), uint8(7), uint8(7), uint8(0), uint8(0))
+	box(jp2h, "colr", colr...)
+	jp2h.Write(res)
+	box(buf, "jp2h", jp2h.Bytes())
+
+	buf.Write([]byte{0, 0, 0, 0})
+	buf.WriteString("jp2c")
+	buf.Write(fakeCodestream())
+	return buf.Bytes()
+}
+
+// fakeCodestream returns the start of a raw codestream: the SIZ and COD
+// markers the scanner reads
+func fakeCodestream() []byte {
+	var buf = new(bytes.Buffer)
+	buf.Write(SOCSIZ)
+	be(buf, uint16(47), uint16(0), uint32(400), uint32(300), uint32(0), uint32(0),
+		uint32(256), uint32(256), uint32(0), uint32(0), uint16(3))
+	buf.Write([]byte{7, 1, 1, 0x8b, 2, 2, 0, 2, 2})
+	buf.Write(COD)
+	be(buf, uint16(12), uint8(0), uint32(0x10001), uint8(5))
+	return buf.Bytes()
+}
+
+func scanFake(t *testing.T, colr []any, res []byte) *Info {
+	var info, err = new(Scanner).ScanStream(bytes.NewReader(fakeJP2(colr, res)))
+	assert.NilError(err, "scanning should work", t)
+	assert.Equal(uint32(400), info.Width, "width", t)
+	assert.Equal(uint32(300), info.Height, "height", t)
+	assert.Equal(uint32(256), info.TileWidth(), "tile width", t)
+	assert.Equal(uint8(5), info.Levels, "levels", t)
+	return info
+}
+
+func TestScanFormats(t *testing.T) {
+	var info = scanFake(t, srgbColor, nil)
+	assert.Equal(FormatJP2, info.Format, "JP2 brand", t)
+
+	var jpx = fakeJP2(srgbColor, nil)
+	copy(jpx[len(JP2HEADER)+8:], "jpx ")
+	info, _ = new(Scanner).ScanStream(bytes.NewReader(jpx))
+	assert.Equal(FormatJPX, info.Format, "JPX brand", t)
+	assert.Equal(uint32(400), info.Width, "JPX width", t)
+	assert.Equal(CSRGB, info.ColorSpace, "JPX color space", t)
+
+	var compat = fakeJP2(srgbColor, nil)
+	copy(compat[len(JP2HEADER)+8:], "jpm ")
+	info, _ = new(Scanner).ScanStream(bytes.NewReader(compat))
+	assert.Equal(FormatJP2, info.Format, "other brands compatible with JP2", t)
+	assert.Equal(uint32(400), info.Width, "compatible brand width", t)
+
+	copy(compat[len(JP2HEADER)+16:], "jpx ")
+	info, _ = new(Scanner).ScanStream(bytes.NewReader(compat))
+	assert.Equal(FormatJPX, info.Format, "other brands compatible with JPX", t)
+
+	var bad = fakeJP2(srgbColor, nil)
+	copy(bad[len(JP2HEADER)+8:], "qt  ")
+	copy(bad[len(JP2HEADER)+16:], "qt  ")
+	var _, err = new(Scanner).ScanStream(bytes.NewReader(bad))
+	assert.True(err != nil, "unknown brands are rejected", t)
+
+	_, err = new(Scanner).ScanStream(bytes.NewReader([]byte("GIF89a")))
+	assert.True(err != nil, "unknown signatures are rejected", t)
+}
+
+func TestScanCodestream(t *testing.T) {
+	var info, err = new(Scanner).ScanStream(bytes.NewReader(fakeCodestream()))
+	assert.NilError(err, "scanning a raw codestream should work", t)
+	assert.Equal(FormatJ2K, info.Format, "format", t)
+	assert.Equal(uint32(400), info.Width, "width comes from SIZ", t)
+	assert.Equal(uint32(300), info.Height, "height comes from SIZ", t)
+	assert.Equal(uint16(3), info.Comps, "components come from SIZ", t)
+	assert.Equal(uint32(256), info.TileWidth(), "tile width", t)
+	assert.Equal(uint8(5), info.Levels, "levels", t)
+	assert.Equal(uint8(12), info.MaxPrecision(), "precision", t)
+	assert.Equal(CSUnknown, info.ColorSpace, "raw codestreams have no color box", t)
+}
+
+func TestScanComponents(t *testing.T) {
+	var info = scanFake(t, srgbColor, nil)
+	var want = []Component{
+		{Precision: 8, DX: 1, DY: 1},
+		{Precision: 12, Signed: true, DX: 2, DY: 2},
+		{Precision: 1, DX: 2, DY: 2},
+	}
+	if diff := cmp.Diff(want, info.Components); diff != "" {
+		t.Errorf("components mismatch (-want +got):\n%s", diff)
+	}
+	assert.Equal(uint8(12), info.MaxPrecision(), "max precision", t)
+}
+
+func TestScanNoResolution(t *testing.T) {
+	var info = scanFake(t, srgbColor, nil)
+	var x, y = info.DPI()
+	assert.Equal(0.0, x, "no x resolution", t)
+	assert.Equal(0.0, y, "no y resolution", t)
+}
+
+func TestScanResolution(t *testing.T) {
+	// Capture is 11811 pixels per meter (~300 DPI) both ways; display is 5905.5
+	// (~150 DPI) horizontally and 1181.1e1 (~300 DPI) vertically, so we know
+	// the fractions, exponents, and axes are all read correctly
+	var res = new(bytes.Buffer)
+	var sub = new(bytes.Buffer)
+	box(sub, "resc", uint16(11811), uint16(1), uint16(11811), uint16(1), int8(0), int8(0))
+	box(sub, "resd", uint16(11811), uint16(10), uint16(59055), uint16(10), int8(1), int8(0))
+	box(res, "res ", sub.Bytes())
+
+	var info = scanFake(t, srgbColor, res.Bytes())
+	assert.Equal(11811.0, info.CaptureRes.X, "capture x", t)
+	assert.Equal(11811.0, info.CaptureRes.Y, "capture y", t)
+	assert.Equal(5905.5, info.DisplayRes.X, "display x", t)
+	assert.Equal(11811.0, info.DisplayRes.Y, "display y", t)
+
+	var x, y = info.DPI()
+	assert.Equal(150.0, math.Round(x), "display resolution is preferred", t)
+	assert.Equal(300.0, math.Round(y), "display y resolution", t)
+}
+
+func TestScanCaptureResolutionOnly(t *testing.T) {
+	var res = new(bytes.Buffer)
+	var sub = new(bytes.Buffer)
+	box(sub, "resc", uint16(3937), uint16(1), uint16(3937), uint16(1), int8(0), int8(0))
+	box(res, "res ", sub.Bytes())
+
+	var x, y = scanFake(t, srgbColor, res.Bytes()).DPI()
+	assert.Equal(100.0, math.Round(x), "capture x DPI", t)
+	assert.Equal(100.0, math.Round(y), "capture y DPI", t)
+}
+
+// fakeProfile returns a bare ICC profile header of the given size and color
+// space, with the remaining bytes filled with "res " so we can be sure the
+// scanner doesn't mistake profile data for other boxes
+func fakeProfile(size int, space string) []byte {
+	var p = bytes.Repeat([]byte("res "), size/4)
+	binary.BigEndian.PutUint32(p, uint32(size))
+	copy(p[16:], space)
+	copy(p[36:], "acsp")
+	return p
+}
+
+func TestScanEnumeratedColor(t *testing.T) {
+	var info = scanFake(t, srgbColor, nil)
+	assert.Equal(CMEnumerated, info.ColorMethod, "color method", t)
+	assert.Equal(CSRGB, info.ColorSpace, "color space", t)
+	assert.Equal(0, len(info.ICCProfile), "no profile", t)
+}
+
+func TestScanICCProfile(t *testing.T) {
+	var profile = fakeProfile(400, "GRAY")
+	var info = scanFake(t, []any{uint8(2), uint8(0), uint8(0), profile}, nil)
+	assert.Equal(CMRestrictedICC, info.ColorMethod, "color method", t)
+	assert.Equal(CSGrayScale, info.ColorSpace, "color space comes from the profile", t)
+	assert.True(bytes.Equal(profile, info.ICCProfile), "profile is read in full", t)
+	var x, _ = info.DPI()
+	assert.Equal(0.0, x, "profile data isn't read as a resolution box", t)
+}
+
+func TestScanInvalidICCProfile(t *testing.T) {
+	var profile = fakeProfile(100, "RGB ")
+	var info = scanFake(t, []any{uint8(2), uint8(0), uint8(0), profile}, nil)
+	assert.Equal(CSUnknown, info.ColorSpace, "color space", t)
+	assert.Equal(0, len(info.ICCProfile), "undersized profiles are skipped", t)
+}
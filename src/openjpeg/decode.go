@@ -5,139 +5,277 @@
 import "C"
 import (
 	"errors"
+	"fmt"
 	"image"
-	"reflect"
+	"math"
+	"rais/src/transform"
 	"unsafe"
 )
 
+// colorSpace is the subset of openjpeg's color spaces we know how to convert
+// to RGB or grayscale
+type colorSpace int
+
+// Supported color spaces.  csUnspecified is used when openjpeg doesn't know,
+// in which case we guess from the component count.
+const (
+	csUnspecified colorSpace = iota
+	csRGB
+	csGray
+	csYCC
+	csCMYK
+)
+
+// component is a Go view of one decoded openjpeg component.  data points
+// into openjpeg's memory, so it's only valid until the opj_image_t is
+// destroyed.
+type component struct {
+	data   []int32
+	w, h   int
+	prec   int
+	signed bool
+	alpha  bool
+}
+
 type opjp2 struct {
-	comps  []C.opj_image_comp_t
+	comps  []component
 	width  int
 	height int
 	bounds image.Rectangle
-	bpc    uint8
+	depth  int
+	space  colorSpace
 }
 
-func newOpjp2(comps []C.opj_image_comp_t, bpc uint8) (*opjp2, error) {
-	if bpc != 8 && bpc != 16 {
-		return nil, errors.New("bit depth must be 8 or 16")
+// newOpjp2 wraps the decoded jp2 image's components for conversion to an
+// image.Image.  Images whose components are all 8 bits or less are decoded
+// to 8-bit images, and anything up to 16 bits to 16-bit images.
+func newOpjp2(jp2 *C.opj_image_t) (*opjp2, error) {
+	var comps = unsafe.Slice(jp2.comps, int(jp2.numcomps))
+	var j = &opjp2{comps: make([]component, len(comps)), depth: 8}
+	for i, c := range comps {
+		if c.prec < 1 || c.prec > 16 {
+			return nil, fmt.Errorf("unsupported bit depth %d (must be 1 to 16)", c.prec)
+		}
+		j.comps[i] = component{
+			data:   unsafe.Slice((*int32)(unsafe.Pointer(c.data)), int(c.w)*int(c.h)),
+			w:      int(c.w),
+			h:      int(c.h),
+			prec:   int(c.prec),
+			signed: c.sgnd != 0,
+			alpha:  c.alpha != 0,
+		}
+		if c.prec > 8 {
+			j.depth = 16
+		}
+	}
+
+	switch jp2.color_space {
+	case C.OPJ_CLRSPC_SRGB:
+		j.space = csRGB
+	case C.OPJ_CLRSPC_GRAY:
+		j.space = csGray
+	case C.OPJ_CLRSPC_SYCC, C.OPJ_CLRSPC_EYCC:
+		j.space = csYCC
+	case C.OPJ_CLRSPC_CMYK:
+		j.space = csCMYK
 	}
 
-	var j = &opjp2{comps: comps}
-	j.width = int(comps[0].w)
-	j.height = int(comps[0].h)
+	j.width = j.comps[0].w
+	j.height = j.comps[0].h
 	j.bounds = image.Rect(0, 0, j.width, j.height)
-	j.bpc = bpc
 
 	return j, nil
 }
 
+// decode converts the components to RGB or grayscale and packs them into an
+// image.Image: Gray or RGBA (or their 16-bit versions) for opaque images, and
+// NRGBA or NRGBA64 when there's an alpha channel
 func (j *opjp2) decode() (image.Image, error) {
-	var gray = len(j.comps) < 3
-	var i image.Image
+	var colors, alpha, err = j.split()
+	if err != nil {
+		return nil, err
+	}
+
+	var maxval int32 = 1<<j.depth - 1
 	switch {
-	case j.bpc == 8 && gray:
-		i = j.decodeGray8()
-	case j.bpc == 8 && !gray:
-		i = j.decodeRGB8()
-	case j.bpc == 16 && gray:
-		i = j.decodeGray16()
-	case j.bpc == 16 && !gray:
-		i = j.decodeRGB16()
+	case j.space == csYCC && len(colors) == 3:
+		colors = yccToRGB(colors, maxval)
+	case j.space == csCMYK:
+		colors = cmykToRGB(colors, maxval)
 	}
 
-	return i, nil
-}
+	var wide = j.depth == 16
+	switch {
+	case len(colors) == 1 && alpha == nil && wide:
+		var m = image.NewGray16(j.bounds)
+		j.pack(m.Pix, m.Stride, colors, nil, true)
+		return m, nil
+	case len(colors) == 1 && alpha == nil:
+		var m = image.NewGray(j.bounds)
+		j.pack(m.Pix, m.Stride, colors, nil, false)
+		return m, nil
+	case len(colors) == 1:
+		colors = [][]int32{colors[0], colors[0], colors[0]}
+	}
 
-func (j *opjp2) decodeGray8() image.Image {
-	return &image.Gray{Pix: jp2ComponentData8(j.comps[0]), Stride: j.width, Rect: j.bounds}
+	switch {
+	case alpha == nil && wide:
+		var m = image.NewRGBA64(j.bounds)
+		j.pack(m.Pix, m.Stride, colors, opaque(len(colors[0]), maxval), true)
+		return m, nil
+	case alpha == nil:
+		var m = image.NewRGBA(j.bounds)
+		j.pack(m.Pix, m.Stride, colors, opaque(len(colors[0]), maxval), false)
+		return m, nil
+	case wide:
+		var m = image.NewNRGBA64(j.bounds)
+		j.pack(m.Pix, m.Stride, colors, alpha, true)
+		return m, nil
+	}
+	var m = image.NewNRGBA(j.bounds)
+	j.pack(m.Pix, m.Stride, colors, alpha, false)
+	return m, nil
 }
 
-func (j *opjp2) decodeGray16() image.Image {
-	return &image.Gray16{Pix: jp2ComponentData16(j.comps[0]), Stride: j.width << 1, Rect: j.bounds}
-}
+// split separates the color components from the alpha component, if any,
+// normalizing them to the image's depth and upsampling subsampled components
+// (e.g., 4:2:0 chroma) to full resolution.  When no component is flagged as
+// alpha, an extra component beyond what the color space needs is assumed to
+// be alpha, as most encoders write RGBA and gray+alpha images that way.
+func (j *opjp2) split() (colors [][]int32, alpha []int32, err error) {
+	var need = 3
+	switch {
+	case j.space == csGray, j.space == csUnspecified && len(j.comps) < 3:
+		need = 1
+	case j.space == csCMYK:
+		need = 4
+	}
 
-func (j *opjp2) decodeRGB8() image.Image {
-	var area = j.width * j.height
-	var bytes = area << 2
-	var realData = make([]uint8, bytes)
+	var comps []component
+	for _, c := range j.comps {
+		if c.alpha && alpha == nil {
+			alpha = j.plane(c)
+			continue
+		}
+		comps = append(comps, c)
+	}
+	if len(comps) < need {
+		return nil, nil, errors.New("not enough color components for the image's color space")
+	}
+	if alpha == nil && len(comps) > need {
+		alpha = j.plane(comps[need])
+	}
 
-	var red = jp2ComponentData8(j.comps[0])
-	var green = jp2ComponentData8(j.comps[1])
-	var blue = jp2ComponentData8(j.comps[2])
+	for _, c := range comps[:need] {
+		colors = append(colors, j.plane(c))
+	}
+	return colors, alpha, nil
+}
 
-	var offset = 0
-	for i := 0; i < area; i++ {
-		realData[offset] = red[i]
-		offset++
-		realData[offset] = green[i]
-		offset++
-		realData[offset] = blue[i]
-		offset++
-		realData[offset] = 255
-		offset++
+// plane returns c's samples at the image's full resolution and depth.
+// Signed samples are shifted to be unsigned, and other precisions are scaled
+// so the full range of the component maps to the full range of the depth:
+// e.g., a 1-bit sample of 1 becomes 255, and 12-bit 4095 becomes 65535.
+func (j *opjp2) plane(c component) []int32 {
+	var sized = c.w == j.width && c.h == j.height
+	if sized && c.prec == j.depth && !c.signed {
+		return c.data
 	}
 
-	return &image.RGBA{Pix: realData, Stride: j.width << 2, Rect: j.bounds}
+	var offset int32
+	if c.signed {
+		offset = 1 << (c.prec - 1)
+	}
+	var from, to = int64(1)<<c.prec - 1, int64(1)<<j.depth - 1
+	var normalize = func(v int32) int32 {
+		var n = int64(clamp(v+offset, int32(from)))
+		return int32((n*to + from/2) / from)
+	}
+
+	var p = make([]int32, j.width*j.height)
+	transform.Parallel(j.height, j.width, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var cy = min(y*c.h/j.height, c.h-1)
+			for x := 0; x < j.width; x++ {
+				var i = y*j.width + x
+				if !sized {
+					i = cy*c.w + min(x*c.w/j.width, c.w-1)
+				}
+				p[y*j.width+x] = normalize(c.data[i])
+			}
+		}
+	})
+	return p
 }
 
-func (j *opjp2) decodeRGB16() image.Image {
-	var red = jp2ComponentData16(j.comps[0])
-	var green = jp2ComponentData16(j.comps[1])
-	var blue = jp2ComponentData16(j.comps[2])
-
-	var offset = 0
-	var pixels = j.width * j.height
-	var realData = make([]uint8, j.width*j.height*8)
-	for i := 0; i < pixels; i++ {
-		offset = i << 3
-		realData[offset] = red[i<<1]
-		realData[offset+1] = red[i<<1+1]
-		realData[offset+2] = green[i<<1]
-		realData[offset+3] = green[i<<1+1]
-		realData[offset+4] = blue[i<<1]
-		realData[offset+5] = blue[i<<1+1]
-		realData[offset+6] = 0xFF
-		realData[offset+7] = 0xFF
-	}
-
-	return &image.RGBA64{Pix: realData, Stride: j.width << 3, Rect: j.bounds}
+// opaque returns an alpha plane with every sample set to maxval
+func opaque(n int, maxval int32) []int32 {
+	var p = make([]int32, n)
+	for i := range p {
+		p[i] = maxval
+	}
+	return p
 }
 
-// jp2ComponentData8 returns a slice of Image-usable uint8s from the JP2 raw
-// data in the given openjpeg component
-func jp2ComponentData8(comp C.struct_opj_image_comp) []uint8 {
-	var data []int32
-	dataSlice := (*reflect.SliceHeader)((unsafe.Pointer(&data)))
-	size := int(comp.w) * int(comp.h)
-	dataSlice.Cap = size
-	dataSlice.Len = size
-	dataSlice.Data = uintptr(unsafe.Pointer(comp.data))
+// clamp limits v to the valid range for a sample
+func clamp(v, maxval int32) int32 {
+	return min(max(v, 0), maxval)
+}
 
-	realData := make([]uint8, len(data))
-	for index, point := range data {
-		realData[index] = uint8(point)
+// yccToRGB converts sYCC planes to RGB.  Chroma is stored offset by half the
+// sample range.
+func yccToRGB(ycc [][]int32, maxval int32) [][]int32 {
+	var rgb = [][]int32{make([]int32, len(ycc[0])), make([]int32, len(ycc[0])), make([]int32, len(ycc[0]))}
+	var offset = float64(maxval+1) / 2
+	for i, y := range ycc[0] {
+		var fy, cb, cr = float64(y), float64(ycc[1][i]) - offset, float64(ycc[2][i]) - offset
+		rgb[0][i] = clamp(int32(math.Round(fy+1.402*cr)), maxval)
+		rgb[1][i] = clamp(int32(math.Round(fy-0.344136*cb-0.714136*cr)), maxval)
+		rgb[2][i] = clamp(int32(math.Round(fy+1.772*cb)), maxval)
 	}
-
-	return realData
+	return rgb
 }
 
-// jp2ComponentData16 returns a slice of Image-usable uint8s for a 16-bit
-// grayscale image, using the JP2 raw data in the given openjpeg component
-func jp2ComponentData16(comp C.struct_opj_image_comp) []uint8 {
-	var data []int32
-	dataSlice := (*reflect.SliceHeader)((unsafe.Pointer(&data)))
-	size := int(comp.w) * int(comp.h)
-	dataSlice.Cap = size
-	dataSlice.Len = size
-	dataSlice.Data = uintptr(unsafe.Pointer(comp.data))
+// cmykToRGB converts CMYK planes to RGB with the naive subtractive formula,
+// which is what openjpeg's own tools do: there's no way to do better without
+// a color profile
+func cmykToRGB(cmyk [][]int32, maxval int32) [][]int32 {
+	var rgb = [][]int32{make([]int32, len(cmyk[0])), make([]int32, len(cmyk[0])), make([]int32, len(cmyk[0]))}
+	var m = int64(maxval)
+	for i := range cmyk[0] {
+		var k = m - int64(clamp(cmyk[3][i], maxval))
+		for c := 0; c < 3; c++ {
+			rgb[c][i] = int32((m - int64(clamp(cmyk[c][i], maxval))) * k / m)
+		}
+	}
+	return rgb
+}
 
-	realData := make([]uint8, len(data)*2)
-	for i, point := range data {
-		var val = uint16(point)
-		realData[i<<1+0] = uint8(val >> 8)
-		realData[i<<1+1] = uint8(val)
+// pack interleaves the color and (optional) alpha planes into pix, one or
+// two bytes per sample
+func (j *opjp2) pack(pix []uint8, stride int, colors [][]int32, alpha []int32, wide bool) {
+	var planes = colors
+	if alpha != nil {
+		planes = append(planes[:len(planes):len(planes)], alpha)
 	}
+	var maxval int32 = 1<<j.depth - 1
+	var n = len(planes)
 
-	return realData
+	transform.Parallel(j.height, j.width, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row = pix[y*stride:]
+			for x := 0; x < j.width; x++ {
+				var i = y*j.width + x
+				for c, p := range planes {
+					var v = clamp(p[i], maxval)
+					if wide {
+						var o = (x*n + c) << 1
+						row[o], row[o+1] = uint8(v>>8), uint8(v)
+					} else {
+						row[x*n+c] = uint8(v)
+					}
+				}
+			}
+		}
+	})
 }
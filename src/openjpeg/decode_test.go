@@ -0,0 +1,108 @@
+package openjpeg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+// fakeDecoded builds an opjp2 from full-resolution, unsigned component data
+// with the given precision
+func fakeDecoded(space colorSpace, prec int, w, h int, planes ...[]int32) *opjp2 {
+	var j = &opjp2{width: w, height: h, bounds: image.Rect(0, 0, w, h), depth: 8, space: space}
+	if prec > 8 {
+		j.depth = 16
+	}
+	for _, p := range planes {
+		j.comps = append(j.comps, component{data: p, w: w, h: h, prec: prec})
+	}
+	return j
+}
+
+func TestDecodeGrayAndRGB(t *testing.T) {
+	var m, err = fakeDecoded(csGray, 8, 2, 1, []int32{10, 300}).decode()
+	assert.NilError(err, "gray decode", t)
+	assert.Equal(string([]uint8{10, 255}), string(m.(*image.Gray).Pix), "gray samples are clamped", t)
+
+	m, _ = fakeDecoded(csRGB, 16, 1, 1, []int32{0x1234}, []int32{0}, []int32{0xffff}).decode()
+	assert.Equal(color.RGBA64{0x1234, 0, 0xffff, 0xffff}, m.(*image.RGBA64).RGBA64At(0, 0), "16-bit RGB", t)
+
+	m, _ = fakeDecoded(csUnspecified, 8, 1, 1, []int32{1}, []int32{2}, []int32{3}).decode()
+	assert.Equal(color.RGBA{1, 2, 3, 255}, m.(*image.RGBA).RGBAAt(0, 0), "unspecified three-component images are RGB", t)
+}
+
+func TestDecodeAlpha(t *testing.T) {
+	var m, _ = fakeDecoded(csRGB, 8, 1, 1, []int32{200}, []int32{100}, []int32{50}, []int32{128}).decode()
+	assert.Equal(color.NRGBA{200, 100, 50, 128}, m.(*image.NRGBA).NRGBAAt(0, 0), "fourth RGB component is alpha", t)
+
+	m, _ = fakeDecoded(csGray, 16, 1, 1, []int32{1000}, []int32{0}).decode()
+	assert.Equal(color.NRGBA64{1000, 1000, 1000, 0}, m.(*image.NRGBA64).NRGBA64At(0, 0), "gray with alpha", t)
+
+	// An explicitly flagged alpha channel can come first
+	var j = fakeDecoded(csRGB, 8, 1, 1, []int32{64}, []int32{1}, []int32{2}, []int32{3})
+	j.comps[0].alpha = true
+	m, _ = j.decode()
+	assert.Equal(color.NRGBA{1, 2, 3, 64}, m.(*image.NRGBA).NRGBAAt(0, 0), "flagged alpha", t)
+}
+
+func TestDecodeYCC(t *testing.T) {
+	// Pure red in sYCC, with chroma subsampled horizontally
+	var j = fakeDecoded(csYCC, 8, 2, 1, []int32{76, 76}, []int32{85}, []int32{255})
+	j.comps[1].w, j.comps[2].w = 1, 1
+	var m, err = j.decode()
+	assert.NilError(err, "YCC decode", t)
+	var rgba = m.(*image.RGBA)
+	assert.Equal(color.RGBA{254, 0, 0, 255}, rgba.RGBAAt(0, 0), "red", t)
+	assert.Equal(color.RGBA{254, 0, 0, 255}, rgba.RGBAAt(1, 0), "upsampled chroma", t)
+
+	m, _ = fakeDecoded(csYCC, 8, 1, 1, []int32{128}, []int32{128}, []int32{128}).decode()
+	assert.Equal(color.RGBA{128, 128, 128, 255}, m.(*image.RGBA).RGBAAt(0, 0), "neutral gray", t)
+}
+
+func TestDecodeCMYK(t *testing.T) {
+	var m, err = fakeDecoded(csCMYK, 8, 3, 1,
+		[]int32{0, 255, 0}, []int32{0, 0, 0}, []int32{0, 0, 0}, []int32{0, 0, 255}).decode()
+	assert.NilError(err, "CMYK decode", t)
+	var rgba = m.(*image.RGBA)
+	assert.Equal(color.RGBA{255, 255, 255, 255}, rgba.RGBAAt(0, 0), "no ink is white", t)
+	assert.Equal(color.RGBA{0, 255, 255, 255}, rgba.RGBAAt(1, 0), "cyan", t)
+	assert.Equal(color.RGBA{0, 0, 0, 255}, rgba.RGBAAt(2, 0), "black", t)
+
+	_, err = fakeDecoded(csCMYK, 8, 1, 1, []int32{0}, []int32{0}, []int32{0}).decode()
+	assert.True(err != nil, "CMYK needs four components", t)
+}
+
+func TestDecodePrecision(t *testing.T) {
+	var m, _ = fakeDecoded(csGray, 1, 3, 1, []int32{0, 1, 1}).decode()
+	assert.Equal(string([]uint8{0, 255, 255}), string(m.(*image.Gray).Pix), "1-bit gray is stretched to 8 bits", t)
+
+	m, _ = fakeDecoded(csGray, 12, 3, 1, []int32{0, 2048, 4095}).decode()
+	var g16 = m.(*image.Gray16)
+	assert.Equal(color.Gray16{0}, g16.Gray16At(0, 0), "12-bit black", t)
+	assert.Equal(color.Gray16{32776}, g16.Gray16At(1, 0), "12-bit middle", t)
+	assert.Equal(color.Gray16{65535}, g16.Gray16At(2, 0), "12-bit white", t)
+
+	m, _ = fakeDecoded(csRGB, 5, 1, 1, []int32{31}, []int32{0}, []int32{16}).decode()
+	assert.Equal(color.RGBA{255, 0, 132, 255}, m.(*image.RGBA).RGBAAt(0, 0), "5-bit RGB", t)
+
+	// Mixed precisions use the deepest component's depth
+	var j = fakeDecoded(csRGB, 8, 1, 1, []int32{255}, []int32{0}, []int32{0}, []int32{1})
+	j.comps[3].prec = 1
+	m, _ = j.decode()
+	assert.Equal(color.NRGBA{255, 0, 0, 255}, m.(*image.NRGBA).NRGBAAt(0, 0), "1-bit alpha", t)
+}
+
+func TestDecodeSigned(t *testing.T) {
+	var j = fakeDecoded(csGray, 8, 3, 1, []int32{-128, 0, 127})
+	j.comps[0].signed = true
+	var m, _ = j.decode()
+	assert.Equal(string([]uint8{0, 128, 255}), string(m.(*image.Gray).Pix), "signed samples are shifted", t)
+
+	j = fakeDecoded(csGray, 16, 2, 1, []int32{-32768, 32767})
+	j.comps[0].signed = true
+	m, _ = j.decode()
+	assert.Equal(color.Gray16{0}, m.(*image.Gray16).Gray16At(0, 0), "signed 16-bit minimum", t)
+	assert.Equal(color.Gray16{65535}, m.(*image.Gray16).Gray16At(1, 0), "signed 16-bit maximum", t)
+}
@@ -0,0 +1,231 @@
+package openjpeg
+
+// #cgo pkg-config: libopenjp2
+// #include <openjpeg.h>
+// #include "handlers.h"
+// #include "stream.h"
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"unsafe"
+)
+
+// Encoding defaults, used when EncodeOptions are nil or a value is zero
+const (
+	DefaultTileSize = 512
+	DefaultLevels   = 5
+	DefaultRatio    = 20
+)
+
+// EncodeOptions control JP2 output.  TileSize is the width and height of the
+// codestream's tiles; a negative value writes a single tile.  Levels is the
+// number of wavelet decomposition levels, and is reduced automatically if the
+// image (or a tile) is too small to support it.  Ratio is the target
+// compression ratio for lossy output, and is ignored when Lossless is true.
+type EncodeOptions struct {
+	TileSize int
+	Levels   int
+	Lossless bool
+	Ratio    float32
+}
+
+// Encode writes m to w as a JP2.  Lossless output uses the reversible 5-3
+// wavelet, while lossy output uses the irreversible 9-7 wavelet.
+func Encode(w io.Writer, m image.Image, o *EncodeOptions) error {
+	var b = m.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return fmt.Errorf("openjpeg: invalid image size %dx%d", b.Dx(), b.Dy())
+	}
+
+	var opts EncodeOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.TileSize == 0 {
+		opts.TileSize = DefaultTileSize
+	}
+	if opts.Levels == 0 {
+		opts.Levels = DefaultLevels
+	}
+	if opts.Ratio == 0 {
+		opts.Ratio = DefaultRatio
+	}
+
+	var jp2 = newOpjImage(m)
+	if jp2 == nil {
+		return fmt.Errorf("openjpeg: unable to allocate image")
+	}
+	defer C.opj_image_destroy(jp2)
+
+	var parameters C.opj_cparameters_t
+	C.opj_set_default_encoder_parameters(&parameters)
+	var tile = 0
+	if opts.TileSize > 0 {
+		tile = opts.TileSize
+		parameters.tile_size_on = C.OPJ_TRUE
+		parameters.cp_tdx = C.int(tile)
+		parameters.cp_tdy = C.int(tile)
+	}
+	parameters.numresolution = C.int(encodeLevels(opts.Levels, b.Dx(), b.Dy(), tile) + 1)
+	parameters.prog_order = C.OPJ_RPCL
+	parameters.tcp_numlayers = 1
+	parameters.cp_disto_alloc = 1
+	parameters.tcp_rates[0] = 0
+	if !opts.Lossless {
+		parameters.irreversible = 1
+		parameters.tcp_rates[0] = C.float(opts.Ratio)
+	}
+	if jp2.numcomps == 3 {
+		parameters.tcp_mct = 1
+	}
+
+	var codec = C.opj_create_compress(C.OPJ_CODEC_JP2)
+	if codec == nil {
+		return fmt.Errorf("openjpeg: unable to create encoder")
+	}
+	defer C.opj_destroy_codec(codec)
+	C.set_handlers(codec)
+
+	if C.opj_setup_encoder(codec, &parameters, jp2) == C.OPJ_FALSE {
+		return fmt.Errorf("openjpeg: unable to setup encoder")
+	}
+
+	// The buffer is normally removed from the writers map when openjpeg frees
+	// the stream, so if there's no stream, we have to remove it ourselves
+	var buf = new(writeBuffer)
+	var id = storeWriter(buf)
+	var stream = C.new_write_stream(C.OPJ_UINT64(1024*1024), C.OPJ_UINT64(id))
+	if stream == nil {
+		freeWriteStream(id)
+		return fmt.Errorf("openjpeg: failed to create output stream")
+	}
+	var ok = C.opj_start_compress(codec, jp2, stream) != C.OPJ_FALSE &&
+		C.opj_encode(codec, stream) != C.OPJ_FALSE &&
+		C.opj_end_compress(codec, stream) != C.OPJ_FALSE
+	C.opj_stream_destroy(stream)
+	if !ok {
+		return fmt.Errorf("openjpeg: failed to encode image")
+	}
+
+	var _, err = w.Write(buf.Bytes())
+	return err
+}
+
+// encodeLevels caps the requested decomposition levels so the smallest
+// resolution of the image, or of a tile if tile is nonzero, is at least one
+// pixel.  openjpeg refuses to encode otherwise.
+func encodeLevels(levels, width, height, tile int) int {
+	var dim = min(width, height)
+	if tile > 0 {
+		dim = min(dim, tile)
+	}
+	for levels > 0 && dim>>levels == 0 {
+		levels--
+	}
+	return levels
+}
+
+// newOpjImage allocates an openjpeg image and copies m's pixel data into it
+func newOpjImage(m image.Image) *C.opj_image_t {
+	var b = m.Bounds()
+	var planes, prec = componentPlanes(m)
+
+	var params = make([]C.opj_image_cmptparm_t, len(planes))
+	for i := range params {
+		params[i].dx = 1
+		params[i].dy = 1
+		params[i].w = C.OPJ_UINT32(b.Dx())
+		params[i].h = C.OPJ_UINT32(b.Dy())
+		params[i].prec = C.OPJ_UINT32(prec)
+		params[i].bpp = C.OPJ_UINT32(prec)
+	}
+
+	var cs C.OPJ_COLOR_SPACE = C.OPJ_CLRSPC_SRGB
+	if len(planes) == 1 {
+		cs = C.OPJ_CLRSPC_GRAY
+	}
+	var jp2 = C.opj_image_create(C.OPJ_UINT32(len(params)), &params[0], cs)
+	if jp2 == nil {
+		return nil
+	}
+	jp2.x1 = C.OPJ_UINT32(b.Dx())
+	jp2.y1 = C.OPJ_UINT32(b.Dy())
+
+	var comps = unsafe.Slice(jp2.comps, len(planes))
+	for i, plane := range planes {
+		copy(unsafe.Slice((*int32)(unsafe.Pointer(comps[i].data)), len(plane)), plane)
+	}
+
+	return jp2
+}
+
+// componentPlanes splits m into one plane of samples per component, the
+// layout openjpeg uses, and returns the planes and their bit depth.  Gray
+// images produce a single plane, and everything else produces red, green,
+// and blue planes.  Alpha is discarded.
+func componentPlanes(m image.Image) (planes [][]int32, prec int) {
+	var b = m.Bounds()
+	var w, h = b.Dx(), b.Dy()
+	var alloc = func(n int) [][]int32 {
+		var p = make([][]int32, n)
+		for i := range p {
+			p[i] = make([]int32, w*h)
+		}
+		return p
+	}
+
+	switch src := m.(type) {
+	case *image.Gray:
+		planes = alloc(1)
+		for y := 0; y < h; y++ {
+			var row = src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+			for x := 0; x < w; x++ {
+				planes[0][y*w+x] = int32(row[x])
+			}
+		}
+		return planes, 8
+
+	case *image.Gray16:
+		planes = alloc(1)
+		for y := 0; y < h; y++ {
+			var row = src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+			for x := 0; x < w; x++ {
+				planes[0][y*w+x] = int32(row[x*2])<<8 | int32(row[x*2+1])
+			}
+		}
+		return planes, 16
+
+	case *image.RGBA64:
+		planes = alloc(3)
+		for y := 0; y < h; y++ {
+			var row = src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+			for x := 0; x < w; x++ {
+				for c := 0; c < 3; c++ {
+					planes[c][y*w+x] = int32(row[x*8+c*2])<<8 | int32(row[x*8+c*2+1])
+				}
+			}
+		}
+		return planes, 16
+	}
+
+	var src, ok = m.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Rect, m, b.Min, draw.Src)
+		b = src.Rect
+	}
+	planes = alloc(3)
+	for y := 0; y < h; y++ {
+		var row = src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			for c := 0; c < 3; c++ {
+				planes[c][y*w+x] = int32(row[x*4+c])
+			}
+		}
+	}
+	return planes, 8
+}
@@ -0,0 +1,79 @@
+package openjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"rais/src/img"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestEncodeLevels(t *testing.T) {
+	assert.Equal(5, encodeLevels(5, 800, 400, 0), "large untiled image keeps its levels", t)
+	assert.Equal(5, encodeLevels(5, 800, 400, 512), "large tiles keep their levels", t)
+	assert.Equal(4, encodeLevels(5, 800, 400, 16), "16px tiles support 4 levels", t)
+	assert.Equal(3, encodeLevels(5, 100, 8, 512), "8px-tall image supports 3 levels", t)
+	assert.Equal(0, encodeLevels(5, 1, 1, 512), "1px image can't be decomposed", t)
+}
+
+func TestComponentPlanes(t *testing.T) {
+	var full = image.NewRGBA(image.Rect(0, 0, 4, 4))
+	full.SetRGBA(1, 1, color.RGBA{10, 20, 30, 255})
+	full.SetRGBA(2, 1, color.RGBA{40, 50, 60, 255})
+	var planes, prec = componentPlanes(full.SubImage(image.Rect(1, 1, 3, 2)))
+	assert.Equal(8, prec, "RGBA precision", t)
+	if diff := cmp.Diff([][]int32{{10, 40}, {20, 50}, {30, 60}}, planes); diff != "" {
+		t.Errorf("RGBA planes: %s", diff)
+	}
+
+	var gray16 = image.NewGray16(image.Rect(0, 0, 2, 1))
+	gray16.SetGray16(1, 0, color.Gray16{Y: 0x1234})
+	planes, prec = componentPlanes(gray16)
+	assert.Equal(16, prec, "Gray16 precision", t)
+	if diff := cmp.Diff([][]int32{{0, 0x1234}}, planes); diff != "" {
+		t.Errorf("Gray16 planes: %s", diff)
+	}
+
+	planes, prec = componentPlanes(image.NewNRGBA(image.Rect(0, 0, 3, 2)))
+	assert.Equal(8, prec, "other types are converted to 8-bit RGB", t)
+	assert.Equal(3, len(planes), "other types have three planes", t)
+}
+
+func TestWriteBuffer(t *testing.T) {
+	var b = new(writeBuffer)
+	b.Write([]byte("abc"))
+	b.Seek(2, 1)
+	b.Write([]byte("f"))
+	b.Seek(0, 0)
+	b.Write([]byte("A"))
+	assert.Equal("Abc\x00\x00f", string(b.Bytes()), "skips are zero-filled and seeks overwrite", t)
+}
+
+func TestEncodeLosslessRoundTrip(t *testing.T) {
+	var src = image.NewGray(image.Rect(0, 0, 64, 48))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+
+	var buf bytes.Buffer
+	var err = Encode(&buf, src, &EncodeOptions{Lossless: true, TileSize: 32})
+	assert.NilError(err, "encoding should work", t)
+
+	var fname = filepath.Join(t.TempDir(), "out.jp2")
+	assert.NilError(os.WriteFile(fname, buf.Bytes(), 0644), "writing the JP2", t)
+	s, err := img.NewFileStream(fname)
+	assert.NilError(err, "opening the JP2", t)
+	jp2, err := NewJP2Image(s)
+	assert.NilError(err, "reading the JP2 header", t)
+	assert.Equal(32, jp2.GetTileWidth(), "tile width", t)
+	assert.Equal(5, jp2.GetLevels(), "levels", t)
+
+	i, err := jp2.DecodeImage()
+	assert.NilError(err, "decoding the JP2", t)
+	assert.True(bytes.Equal(src.Pix, i.(*image.Gray).Pix), "lossless data is unchanged", t)
+}
@@ -10,8 +10,6 @@
 	"rais/src/img"
 	"rais/src/jp2info"
 	"rais/src/transform"
-	"reflect"
-	"unsafe"
 )
 
 // JP2Image is a container for our simple JP2 operations
@@ -23,6 +21,7 @@ type JP2Image struct {
 	decodeHeight int
 	decodeArea   image.Rectangle
 	srcRect      image.Rectangle
+	filter       transform.Filter
 }
 
 // NewJP2Image reads basic information about a file and returns a decode-ready
@@ -54,6 +53,12 @@ func (i *JP2Image) SetCrop(r image.Rectangle) {
 	i.decodeArea = r
 }
 
+// SetScaleFilter sets the filter used when the decoded resolution level has
+// to be resized to the requested dimensions
+func (i *JP2Image) SetScaleFilter(f transform.Filter) {
+	i.filter = f
+}
+
 // DecodeImage returns an image.Image that holds the decoded image data,
 // resized and cropped if resizing or cropping was requested.  Both cropping
 // and resizing happen here due to the nature of openjpeg, so SetScale,
@@ -70,14 +75,8 @@ func (i *JP2Image) DecodeImage() (im image.Image, err error) {
 		return nil, err
 	}
 
-	var comps []C.opj_image_comp_t
-	var compsSlice = (*reflect.SliceHeader)((unsafe.Pointer(&comps)))
-	compsSlice.Cap = int(jp2.numcomps)
-	compsSlice.Len = int(jp2.numcomps)
-	compsSlice.Data = uintptr(unsafe.Pointer(jp2.comps))
-
 	var j *opjp2
-	j, err = newOpjp2(comps, i.info.BPC)
+	j, err = newOpjp2(jp2)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +91,7 @@ func (i *JP2Image) DecodeImage() (im image.Image, err error) {
 	// scaling would be a very expensive no-op
 	var db = decoded.Bounds()
 	if i.decodeWidth != db.Dx() || i.decodeHeight != db.Dy() {
-		var resized = transform.Scale(decoded, i.decodeWidth, i.decodeHeight)
+		var resized = transform.ScaleFilter(decoded, i.decodeWidth, i.decodeHeight, i.filter)
 		if resized == nil {
 			return nil, fmt.Errorf("unsupported image type %T", decoded)
 		}
@@ -127,6 +126,17 @@ func (i *JP2Image) GetLevels() int {
 	return int(i.info.Levels)
 }
 
+// GetResolution returns the image's DPI from its JP2 resolution boxes, if any
+func (i *JP2Image) GetResolution() img.Resolution {
+	var x, y = i.info.DPI()
+	return img.Resolution{X: x, Y: y}
+}
+
+// GetICCProfile returns the color profile embedded in the JP2 header, if any
+func (i *JP2Image) GetICCProfile() []byte {
+	return i.info.ICCProfile
+}
+
 // computeDecodeParameters sets up decode area, decode width, and decode height
 // based on the image's info
 func (i *JP2Image) computeDecodeParameters() {
@@ -9,6 +9,7 @@
 
 import (
 	"fmt"
+	"rais/src/jp2info"
 )
 
 // rawDecode runs the low-level operations necessary to actually get the
@@ -31,8 +32,14 @@ func (i *JP2Image) rawDecode() (jp2 *C.opj_image_t, err error) {
 	}
 	defer C.opj_stream_destroy(stream)
 
-	// Create codec
-	codec := C.opj_create_decompress(C.OPJ_CODEC_JP2)
+	// Create codec: JPX files are close enough to JP2 for openjpeg to decode
+	// as long as the codestream is contiguous, but raw codestreams need the
+	// J2K codec
+	var format C.OPJ_CODEC_FORMAT = C.OPJ_CODEC_JP2
+	if i.info.Format == jp2info.FormatJ2K {
+		format = C.OPJ_CODEC_J2K
+	}
+	codec := C.opj_create_decompress(format)
 	defer C.opj_destroy_codec(codec)
 
 	// Connect our info/warning/error handlers
@@ -43,6 +50,15 @@ func (i *JP2Image) rawDecode() (jp2 *C.opj_image_t, err error) {
 		return jp2, fmt.Errorf("unable to setup decoder")
 	}
 
+	// Let openjpeg decode code-blocks in parallel if we can spare the threads.
+	// Failure here just means the library was built without thread support,
+	// so we decode on this thread as usual.
+	var lease = reserveThreads()
+	defer lease.release()
+	if lease.n > 1 && C.opj_codec_set_threads(codec, C.int(lease.n)) == C.OPJ_FALSE {
+		Logger.Debugf("Unable to use %d threads for decoding; openjpeg may lack thread support", lease.n)
+	}
+
 	// Read the header to set up the image data
 	if C.opj_read_header(stream, codec, &jp2) == C.OPJ_FALSE {
 		return jp2, fmt.Errorf("failed to read the header")
@@ -8,13 +8,6 @@
 // MaxProgressionLevel represents the maximum resolution factor for a JP2
 const MaxProgressionLevel = 32
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // Returns the scale in powers of two between two numbers
 func getScale(v1, v2 int) int {
 	if v1 == v2 {
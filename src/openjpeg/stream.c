@@ -35,3 +35,35 @@ opj_stream_t* new_stream(OPJ_UINT64 buffer_size, OPJ_UINT64 stream_id, OPJ_UINT6
 
     return l_stream;
 }
+
+OPJ_SIZE_T write_stream_write(void * p_buffer, OPJ_SIZE_T p_nb_bytes, void *stream_id) {
+  return opjWriteStreamWrite(p_buffer, p_nb_bytes, (OPJ_UINT64)stream_id);
+}
+
+OPJ_OFF_T write_stream_skip(OPJ_OFF_T p_nb_bytes, void *stream_id) {
+  return opjWriteStreamSkip(p_nb_bytes, (OPJ_UINT64)stream_id);
+}
+
+OPJ_BOOL write_stream_seek(OPJ_OFF_T p_nb_bytes, void *stream_id) {
+  return opjWriteStreamSeek(p_nb_bytes, (OPJ_UINT64)stream_id);
+}
+
+void free_write_stream(void *stream_id) {
+  freeWriteStream((OPJ_UINT64)stream_id);
+}
+
+opj_stream_t* new_write_stream(OPJ_UINT64 buffer_size, OPJ_UINT64 stream_id) {
+    opj_stream_t* l_stream = 00;
+
+    l_stream = opj_stream_create(buffer_size, 0);
+    if (! l_stream) {
+        return NULL;
+    }
+
+    opj_stream_set_user_data(l_stream, (void*)stream_id, free_write_stream);
+    opj_stream_set_write_function(l_stream, (opj_stream_write_fn) write_stream_write);
+    opj_stream_set_skip_function(l_stream, (opj_stream_skip_fn) write_stream_skip);
+    opj_stream_set_seek_function(l_stream, (opj_stream_seek_fn) write_stream_seek);
+
+    return l_stream;
+}
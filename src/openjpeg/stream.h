@@ -1,4 +1,5 @@
 #include <openjpeg.h>
 
 extern opj_stream_t* new_stream(OPJ_UINT64 buffer_size, OPJ_UINT64 stream_id, OPJ_UINT64 data_size);
+extern opj_stream_t* new_write_stream(OPJ_UINT64 buffer_size, OPJ_UINT64 stream_id);
 extern void GoLog(int level, char *message);
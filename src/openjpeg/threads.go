@@ -0,0 +1,78 @@
+package openjpeg
+
+import (
+	"runtime"
+)
+
+// decodeThreads is how many threads a single decode asks openjpeg for
+var decodeThreads = 1
+
+// threads holds one token per openjpeg worker thread allowed to exist at
+// once.  Each decode creates its own thread pool, so without a shared limit a
+// handful of concurrent requests could start hundreds of threads.
+var threads = make(chan struct{}, runtime.NumCPU())
+
+// SetDecodeThreads sets how many threads each decode may use.  Values below
+// 2 decode on the calling goroutine's thread.
+func SetDecodeThreads(n int) {
+	decodeThreads = max(n, 1)
+}
+
+// DecodeThreads returns the per-decode thread count
+func DecodeThreads() int {
+	return decodeThreads
+}
+
+// SetMaxThreads sets the process-wide limit on openjpeg worker threads.  Zero
+// disables multi-threaded decoding.  This must be called before any images
+// are decoded, as it replaces the thread pool.
+func SetMaxThreads(n int) {
+	threads = make(chan struct{}, max(n, 0))
+}
+
+// MaxThreads returns the process-wide openjpeg thread limit
+func MaxThreads() int {
+	return cap(threads)
+}
+
+// ThreadsInUse returns how many openjpeg worker threads are currently
+// reserved by decodes
+func ThreadsInUse() int {
+	return len(threads)
+}
+
+// threadLease is a reservation of worker threads for one decode
+type threadLease struct {
+	sem chan struct{}
+	n   int
+}
+
+// reserveThreads reserves up to the per-decode thread count without waiting,
+// so a busy server degrades to single-threaded decodes rather than stalling
+// requests.  A lease of fewer than two threads isn't worth a thread pool, so
+// it's given back immediately and the decode runs on the caller's thread.
+func reserveThreads() *threadLease {
+	var l = &threadLease{sem: threads}
+reserve:
+	for l.n < decodeThreads {
+		select {
+		case l.sem <- struct{}{}:
+			l.n++
+		default:
+			break reserve
+		}
+	}
+	if l.n < 2 {
+		l.release()
+	}
+	return l
+}
+
+// release returns the lease's threads to the pool.  It's safe to call more
+// than once.
+func (l *threadLease) release() {
+	for range l.n {
+		<-l.sem
+	}
+	l.n = 0
+}
@@ -0,0 +1,43 @@
+package openjpeg
+
+import (
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestReserveThreads(t *testing.T) {
+	var oldThreads, oldMax = DecodeThreads(), MaxThreads()
+	defer func() {
+		SetDecodeThreads(oldThreads)
+		SetMaxThreads(oldMax)
+	}()
+
+	SetDecodeThreads(4)
+	SetMaxThreads(6)
+	var a = reserveThreads()
+	assert.Equal(4, a.n, "first decode gets its full share", t)
+	var b = reserveThreads()
+	assert.Equal(2, b.n, "second decode gets what's left", t)
+	var c = reserveThreads()
+	assert.Equal(0, c.n, "third decode runs single-threaded", t)
+	assert.Equal(6, ThreadsInUse(), "threads in use", t)
+
+	a.release()
+	a.release()
+	assert.Equal(2, ThreadsInUse(), "released threads are returned once", t)
+	b.release()
+	c.release()
+	assert.Equal(0, ThreadsInUse(), "all threads returned", t)
+
+	SetMaxThreads(5)
+	a = reserveThreads()
+	b = reserveThreads()
+	assert.Equal(0, b.n, "a single spare thread isn't worth a pool", t)
+	assert.Equal(4, ThreadsInUse(), "the lone thread is given back", t)
+	a.release()
+
+	SetDecodeThreads(0)
+	assert.Equal(1, DecodeThreads(), "per-decode threads can't go below one", t)
+	assert.Equal(0, reserveThreads().n, "one thread per decode never reserves", t)
+}
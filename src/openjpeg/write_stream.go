@@ -0,0 +1,128 @@
+package openjpeg
+
+// #cgo pkg-config: libopenjp2
+// #include <openjpeg.h>
+import "C"
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// writeBuffer is an in-memory io.WriteSeeker.  openjpeg seeks backward to
+// fill in box lengths when it writes a JP2, so we can't hand it the client's
+// writer directly.
+type writeBuffer struct {
+	data []byte
+	pos  int64
+}
+
+// Write puts p at the current position, growing the buffer as needed
+func (b *writeBuffer) Write(p []byte) (int, error) {
+	var end = b.pos + int64(len(p))
+	if end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+	copy(b.data[b.pos:], p)
+	b.pos = end
+	return len(p), nil
+}
+
+// Seek moves the write position.  Seeking past the end is allowed; the gap
+// is zero-filled on the next write.
+func (b *writeBuffer) Seek(offset int64, whence int) (int64, error) {
+	var pos = offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += b.pos
+	case io.SeekEnd:
+		pos += int64(len(b.data))
+	}
+	if pos < 0 {
+		return b.pos, errors.New("openjpeg: negative write position")
+	}
+	b.pos = pos
+	return pos, nil
+}
+
+// Bytes returns everything written to the buffer
+func (b *writeBuffer) Bytes() []byte {
+	return b.data
+}
+
+var writers = make(map[uint64]*writeBuffer)
+
+// storeWriter indexes b under the next sequence id so the opj write stream
+// functions can find it, returning the id
+func storeWriter(b *writeBuffer) uint64 {
+	imageMutex.Lock()
+	nextStreamID++
+	var id = nextStreamID
+	writers[id] = b
+	imageMutex.Unlock()
+
+	return id
+}
+
+func lookupWriter(id uint64) (*writeBuffer, bool) {
+	imageMutex.Lock()
+	var b, ok = writers[id]
+	imageMutex.Unlock()
+
+	return b, ok
+}
+
+//export freeWriteStream
+func freeWriteStream(id uint64) {
+	imageMutex.Lock()
+	delete(writers, id)
+	imageMutex.Unlock()
+}
+
+//export opjWriteStreamWrite
+func opjWriteStreamWrite(readBuffer unsafe.Pointer, numBytes C.OPJ_SIZE_T, id uint64) C.OPJ_SIZE_T {
+	var b, ok = lookupWriter(id)
+	if !ok {
+		Logger.Errorf("Unable to find write stream %d", id)
+		return opjMinusOneSizeT
+	}
+
+	var n, _ = b.Write(unsafe.Slice((*byte)(readBuffer), int(numBytes)))
+	return C.OPJ_SIZE_T(n)
+}
+
+// opjWriteStreamSkip moves numBytes forward (or backward) in the output
+//
+//export opjWriteStreamSkip
+func opjWriteStreamSkip(numBytes C.OPJ_OFF_T, id uint64) C.OPJ_OFF_T {
+	var b, ok = lookupWriter(id)
+	if !ok {
+		Logger.Errorf("Unable to find write stream ID %d", id)
+		return -1
+	}
+	var _, err = b.Seek(int64(numBytes), io.SeekCurrent)
+	if err != nil {
+		Logger.Errorf("Unable to skip %d bytes: %s", numBytes, err)
+		return -1
+	}
+
+	return numBytes
+}
+
+// opjWriteStreamSeek jumps to the absolute position offset in the output
+//
+//export opjWriteStreamSeek
+func opjWriteStreamSeek(offset C.OPJ_OFF_T, id uint64) C.OPJ_BOOL {
+	var b, ok = lookupWriter(id)
+	if !ok {
+		Logger.Errorf("Unable to find write stream ID %d", id)
+		return C.OPJ_FALSE
+	}
+	var _, err = b.Seek(int64(offset), io.SeekStart)
+	if err != nil {
+		Logger.Errorf("Unable to seek to offset %d: %s", offset, err)
+		return C.OPJ_FALSE
+	}
+
+	return C.OPJ_TRUE
+}
@@ -0,0 +1,211 @@
+// Package pdf writes an image as a minimal single-page PDF.  The image is the
+// page's only content, and the page is sized so the image prints at its
+// source resolution.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"strconv"
+)
+
+// DefaultDPI is used when an image's resolution is unknown.  At 72 DPI, one
+// pixel is one PDF point.
+const DefaultDPI = 72
+
+// DefaultQuality is the JPEG quality used when Options are nil
+const DefaultQuality = 75
+
+// Options are the encoding parameters.  DPIX and DPIY determine the page
+// size; zero or negative values fall back to DefaultDPI.  Quality is only
+// used for images which get JPEG compression.
+type Options struct {
+	DPIX    float64
+	DPIY    float64
+	Quality int
+}
+
+// xobject holds the data and dictionary values for an image XObject
+type xobject struct {
+	colorSpace string
+	bpc        int
+	filter     string
+	data       []byte
+}
+
+// Encode writes m to w as a single-page PDF.  16-bit and bitonal images are
+// Flate-compressed to avoid losing data; everything else is stored as JPEG.
+func Encode(w io.Writer, m image.Image, o *Options) error {
+	var b = m.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return fmt.Errorf("pdf: invalid image size %dx%d", b.Dx(), b.Dy())
+	}
+
+	var opts = Options{Quality: DefaultQuality}
+	if o != nil {
+		opts = *o
+	}
+
+	var xo, err = newXObject(m, opts.Quality)
+	if err != nil {
+		return err
+	}
+
+	var pw = &writer{w: w}
+	var pageW = points(b.Dx(), opts.DPIX)
+	var pageH = points(b.Dy(), opts.DPIY)
+	var content = fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q", pageW, pageH)
+
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	pw.object("<< /Type /Catalog /Pages 2 0 R >>")
+	pw.object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	pw.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+		"/Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", pageW, pageH))
+	pw.stream(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d "+
+		"/ColorSpace /%s /BitsPerComponent %d /Filter /%s /Length %d >>",
+		b.Dx(), b.Dy(), xo.colorSpace, xo.bpc, xo.filter, len(xo.data)), xo.data)
+	pw.stream(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+	pw.trailer()
+
+	return pw.err
+}
+
+// points converts a pixel count to PDF points (1/72 inch) at the given DPI
+func points(px int, dpi float64) string {
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+	var pt = math.Round(float64(px)*72/dpi*100) / 100
+	return strconv.FormatFloat(pt, 'f', -1, 64)
+}
+
+// newXObject picks the compression and color space for m and encodes its
+// pixel data accordingly
+func newXObject(m image.Image, quality int) (*xobject, error) {
+	switch src := m.(type) {
+	case *image.Gray:
+		if isBitonal(src) {
+			return &xobject{"DeviceGray", 1, "FlateDecode", deflate(packBits(src))}, nil
+		}
+	case *image.Gray16:
+		return &xobject{"DeviceGray", 16, "FlateDecode", deflate(rows(src.Pix, src.PixOffset, src.Rect, 2, 2))}, nil
+	case *image.RGBA64:
+		return &xobject{"DeviceRGB", 16, "FlateDecode", deflate(rows(src.Pix, src.PixOffset, src.Rect, 8, 6))}, nil
+	}
+
+	var buf bytes.Buffer
+	var err = jpeg.Encode(&buf, m, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+	var cs = "DeviceRGB"
+	if _, ok := m.(*image.Gray); ok {
+		cs = "DeviceGray"
+	}
+	return &xobject{cs, 8, "DCTDecode", buf.Bytes()}, nil
+}
+
+// isBitonal returns true if every pixel in m is pure black or pure white
+func isBitonal(m *image.Gray) bool {
+	var b = m.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row = m.Pix[m.PixOffset(b.Min.X, y):]
+		for _, v := range row[:b.Dx()] {
+			if v != 0 && v != 255 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// packBits converts a bitonal image to one bit per pixel, with each row
+// padded to a whole byte as PDF requires
+func packBits(m *image.Gray) []byte {
+	var b = m.Rect
+	var stride = (b.Dx() + 7) / 8
+	var out = make([]byte, stride*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		var row = m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < b.Dx(); x++ {
+			if row[x] != 0 {
+				out[y*stride+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return out
+}
+
+// rows copies pixel data out of a (possibly sub-) image, keeping the first
+// keep bytes of each size-byte pixel.  The stdlib's 16-bit types already store
+// samples big-endian, which is what PDF wants.
+func rows(pix []byte, offset func(x, y int) int, r image.Rectangle, size, keep int) []byte {
+	var out = make([]byte, 0, r.Dx()*r.Dy()*keep)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		var row = pix[offset(r.Min.X, y):]
+		for x := 0; x < r.Dx(); x++ {
+			out = append(out, row[x*size:x*size+keep]...)
+		}
+	}
+	return out
+}
+
+// deflate zlib-compresses data, which is what PDF's FlateDecode expects
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	var zw = zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// writer tracks byte offsets of each object for the cross-reference table,
+// and holds onto the first write error so callers needn't check every write
+type writer struct {
+	w       io.Writer
+	n       int
+	offsets []int
+	err     error
+}
+
+func (pw *writer) write(data []byte) {
+	if pw.err != nil {
+		return
+	}
+	var n int
+	n, pw.err = pw.w.Write(data)
+	pw.n += n
+}
+
+func (pw *writer) printf(format string, args ...any) {
+	pw.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+// object writes the next numbered object with the given body
+func (pw *writer) object(body string) {
+	pw.offsets = append(pw.offsets, pw.n)
+	pw.printf("%d 0 obj\n%s\nendobj\n", len(pw.offsets), body)
+}
+
+// stream writes the next numbered object as a stream
+func (pw *writer) stream(dict string, data []byte) {
+	pw.offsets = append(pw.offsets, pw.n)
+	pw.printf("%d 0 obj\n%s\nstream\n", len(pw.offsets), dict)
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// trailer writes the cross-reference table and trailer, finishing the file
+func (pw *writer) trailer() {
+	var xref = pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, off := range pw.offsets {
+		pw.printf("%010d 00000 n \n", off)
+	}
+	pw.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, xref)
+}
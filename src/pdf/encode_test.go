@@ -0,0 +1,87 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func encode(t *testing.T, m image.Image, o *Options) string {
+	var buf bytes.Buffer
+	var err = Encode(&buf, m, o)
+	assert.NilError(err, "encoding should work", t)
+	return buf.String()
+}
+
+func TestEncodeStructure(t *testing.T) {
+	var pdf = encode(t, image.NewRGBA(image.Rect(0, 0, 20, 10)), nil)
+	assert.True(strings.HasPrefix(pdf, "%PDF-1.4\n"), "PDF header", t)
+	assert.True(strings.HasSuffix(pdf, "%%EOF\n"), "PDF trailer", t)
+
+	// Every xref entry must point at the start of its object
+	var start = strings.Index(pdf, "\nxref\n") + 1
+	var m = regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdf)
+	assert.Equal(strconv.Itoa(start), m[1], "startxref points at the xref table", t)
+	var entries = regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[start:], -1)
+	assert.Equal(5, len(entries), "five objects", t)
+	for i, e := range entries {
+		var off, _ = strconv.Atoi(e[1])
+		var want = fmt.Sprintf("%d 0 obj\n", i+1)
+		assert.Equal(want, pdf[off:off+len(want)], "xref offset for object "+strconv.Itoa(i+1), t)
+	}
+}
+
+func TestEncodeFilters(t *testing.T) {
+	var gray = image.NewGray(image.Rect(0, 0, 4, 4))
+	gray.Pix[0] = 128
+	var tests = map[string]struct {
+		img  image.Image
+		want string
+	}{
+		"rgba":    {image.NewRGBA(image.Rect(0, 0, 4, 4)), "/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode"},
+		"gray":    {gray, "/ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode"},
+		"bitonal": {image.NewGray(image.Rect(0, 0, 4, 4)), "/ColorSpace /DeviceGray /BitsPerComponent 1 /Filter /FlateDecode"},
+		"gray16":  {image.NewGray16(image.Rect(0, 0, 4, 4)), "/ColorSpace /DeviceGray /BitsPerComponent 16 /Filter /FlateDecode"},
+		"rgba64":  {image.NewRGBA64(image.Rect(0, 0, 4, 4)), "/ColorSpace /DeviceRGB /BitsPerComponent 16 /Filter /FlateDecode"},
+	}
+
+	for name, tc := range tests {
+		var pdf = encode(t, tc.img, nil)
+		assert.True(strings.Contains(pdf, tc.want), name+" uses "+tc.want, t)
+	}
+}
+
+func TestEncodePageSize(t *testing.T) {
+	var m = image.NewRGBA(image.Rect(0, 0, 300, 200))
+	var pdf = encode(t, m, nil)
+	assert.True(strings.Contains(pdf, "/MediaBox [0 0 300 200]"), "default is one point per pixel", t)
+
+	pdf = encode(t, m, &Options{DPIX: 300, DPIY: 150})
+	assert.True(strings.Contains(pdf, "/MediaBox [0 0 72 96]"), "page size comes from DPI", t)
+	assert.True(strings.Contains(pdf, "q 72 0 0 96 0 0 cm /Im0 Do Q"), "image fills the page", t)
+
+	pdf = encode(t, m, &Options{DPIX: 90, DPIY: 90})
+	assert.True(strings.Contains(pdf, "/MediaBox [0 0 240 160]"), "page size at 90 DPI", t)
+}
+
+func TestPackBits(t *testing.T) {
+	var full = image.NewGray(image.Rect(0, 0, 12, 3))
+	for i := range full.Pix {
+		full.Pix[i] = 255
+	}
+	full.Pix[full.PixOffset(1, 1)] = 0
+	full.Pix[full.PixOffset(10, 1)] = 0
+
+	// Rows are padded to whole bytes, and subimages must start at their own origin
+	var got = packBits(full.SubImage(image.Rect(1, 1, 11, 2)).(*image.Gray))
+	if diff := cmp.Diff([]byte{0x7f, 0x80}, got); diff != "" {
+		t.Errorf("packed bits: %s", diff)
+	}
+}
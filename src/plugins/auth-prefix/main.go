@@ -0,0 +1,93 @@
+// This file is an example IIIF Auth policy plugin, restricting images by the
+// start of their identifiers.  It's meant for trying out the auth flow (e.g.,
+// with the local stand-in identity provider), but it may also be a starting
+// point for real policies.
+//
+// Images whose IDs start with any prefix in "AuthDeniedPrefixes" are hidden
+// entirely from anonymous users, while those starting with any prefix in
+// "AuthDegradedPrefixes" are served to anonymous users at no more than
+// "AuthDegradedMaxWidth" pixels wide (default 400).  Logged-in users can see
+// everything.  Prefixes are comma-separated, e.g.:
+//
+//	RAIS_AUTHDENIEDPREFIXES="donor/,private/"
+//	RAIS_AUTHDEGRADEDPREFIXES="preview/"
+//
+// Images which don't match any prefix are left to other plugins.
+
+package main
+
+import (
+	"rais/src/auth"
+	"rais/src/iiif"
+	"rais/src/img"
+	"rais/src/plugins"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/uoregon-libraries/gopkg/logger"
+)
+
+var l *logger.Logger
+var denied, degraded []string
+var maxWidth int
+
+// Disabled lets the plugin manager know not to add this plugin's functions to
+// the global list unless sanity checks in Initialize() pass
+var Disabled = true
+
+// Initialize reads the prefix lists from configuration
+func Initialize() {
+	viper.SetDefault("AuthDegradedMaxWidth", 400)
+	maxWidth = viper.GetInt("AuthDegradedMaxWidth")
+	denied = splitPrefixes(viper.GetString("AuthDeniedPrefixes"))
+	degraded = splitPrefixes(viper.GetString("AuthDegradedPrefixes"))
+
+	if len(denied) == 0 && len(degraded) == 0 {
+		l.Warnf("AuthDeniedPrefixes or AuthDegradedPrefixes must be configured  **Auth prefix plugin is disabled**")
+		return
+	}
+
+	Disabled = false
+}
+
+func splitPrefixes(s string) []string {
+	var list []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+func hasPrefix(id iiif.ID, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(string(id), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthPolicy restricts anonymous access to images matching the configured
+// prefixes
+func AuthPolicy(id iiif.ID, user string) (auth.Decision, error) {
+	var restricted = hasPrefix(id, denied) || hasPrefix(id, degraded)
+	if !restricted {
+		return auth.Decision{}, plugins.ErrSkipped
+	}
+	if user != "" {
+		return auth.Decision{Access: auth.Full}, nil
+	}
+	if hasPrefix(id, denied) {
+		return auth.Decision{Access: auth.Denied}, nil
+	}
+	return auth.Decision{Access: auth.Degraded, Max: img.Constraint{Width: maxWidth}}, nil
+}
+
+// SetLogger is called by the RAIS server's plugin manager to let plugins use
+// the central logger
+func SetLogger(raisLogger *logger.Logger) {
+	l = raisLogger
+}
@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"image"
+)
+
+// Images with an alpha channel come out of the decoders as NRGBA or NRGBA64,
+// but scaling and rotation have to blend neighboring pixels, which is only
+// correct with premultiplied color: otherwise the color of fully transparent
+// pixels bleeds into their neighbors.  So these types are premultiplied into
+// an RGBA64 for processing and converted back afterward.  Sixteen bits keeps
+// the round trip lossless for 8-bit images except where alpha is very low.
+
+// premultiply returns a premultiplied copy of an NRGBA or NRGBA64 image, with
+// bounds starting at the origin
+func premultiply(src image.Image) *image.RGBA64 {
+	var b = src.Bounds()
+	var w, h = b.Dx(), b.Dy()
+	var dst = image.NewRGBA64(image.Rect(0, 0, w, h))
+
+	var pix []uint8
+	var stride, bps int
+	switch s := src.(type) {
+	case *image.NRGBA:
+		pix, stride, bps = s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, 1
+	case *image.NRGBA64:
+		pix, stride, bps = s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, 2
+	default:
+		return nil
+	}
+
+	Parallel(h, w, func(lo, hi int) {
+		var px [4]uint32
+		for y := lo; y < hi; y++ {
+			var row = pix[y*stride:]
+			var drow = dst.Pix[y*dst.Stride:]
+			for x := 0; x < w; x++ {
+				for c := range px {
+					if bps == 1 {
+						px[c] = uint32(row[x*4+c]) * 0x101
+					} else {
+						px[c] = uint32(be16(row, (x*4+c)*2))
+					}
+				}
+				for c := 0; c < 3; c++ {
+					px[c] = px[c] * px[3] / 0xffff
+				}
+				for c, v := range px {
+					putbe16(drow, (x*4+c)*2, uint16(v))
+				}
+			}
+		}
+	})
+
+	return dst
+}
+
+// unpremultiply converts a premultiplied RGBA64 image back to NRGBA64 if
+// wide is true, or NRGBA otherwise
+func unpremultiply(src *image.RGBA64, wide bool) image.Image {
+	var b = src.Bounds()
+	var w, h = b.Dx(), b.Dy()
+
+	var pix []uint8
+	var stride int
+	var dst image.Image
+	if wide {
+		var d = image.NewNRGBA64(image.Rect(0, 0, w, h))
+		pix, stride, dst = d.Pix, d.Stride, d
+	} else {
+		var d = image.NewNRGBA(image.Rect(0, 0, w, h))
+		pix, stride, dst = d.Pix, d.Stride, d
+	}
+
+	var base = src.PixOffset(b.Min.X, b.Min.Y)
+	Parallel(h, w, func(lo, hi int) {
+		var px [4]uint32
+		for y := lo; y < hi; y++ {
+			var row = src.Pix[base+y*src.Stride:]
+			var drow = pix[y*stride:]
+			for x := 0; x < w; x++ {
+				for c := range px {
+					px[c] = uint32(be16(row, (x*4+c)*2))
+				}
+				if px[3] == 0 {
+					continue
+				}
+				for c := 0; c < 3; c++ {
+					px[c] = min(px[c]*0xffff/px[3], 0xffff)
+				}
+				for c, v := range px {
+					if wide {
+						putbe16(drow, (x*4+c)*2, uint16(v))
+					} else {
+						drow[x*4+c] = uint8(v >> 8)
+					}
+				}
+			}
+		}
+	})
+
+	return dst
+}
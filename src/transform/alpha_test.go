@@ -0,0 +1,61 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestPremultiplyRoundTrip(t *testing.T) {
+	var src = randomImage("RGBA", image.Rect(0, 0, 16, 16)).(*image.RGBA)
+	var n = &image.NRGBA{Pix: src.Pix, Stride: src.Stride, Rect: src.Rect}
+	for i := 3; i < len(n.Pix); i += 4 {
+		n.Pix[i] = 255
+	}
+	var out = unpremultiply(premultiply(n), false).(*image.NRGBA)
+	assert.Equal(string(n.Pix), string(out.Pix), "opaque images survive the round trip", t)
+
+	var n64 = image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	n64.SetNRGBA64(0, 0, color.NRGBA64{R: 40000, G: 1000, B: 65535, A: 65535})
+	var out64 = unpremultiply(premultiply(n64), true).(*image.NRGBA64)
+	assert.Equal(n64.NRGBA64At(0, 0), out64.NRGBA64At(0, 0), "16-bit round trip", t)
+}
+
+// TestScaleAlpha shrinks an opaque red pixel next to a fully transparent
+// green one: the transparent pixel's color must not bleed into the result
+func TestScaleAlpha(t *testing.T) {
+	var src = image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 0})
+
+	for _, f := range []Filter{Bilinear, CatmullRom, Lanczos3} {
+		var dst, ok = ScaleFilter(src, 1, 1, f).(*image.NRGBA)
+		assert.True(ok, f.String()+" returns NRGBA", t)
+		var c = dst.NRGBAAt(0, 0)
+		assert.Equal(uint8(255), c.R, f.String()+" red", t)
+		assert.Equal(uint8(0), c.G, f.String()+" transparent green doesn't bleed", t)
+		assert.True(c.A > 100 && c.A < 155, f.String()+" alpha is averaged", t)
+	}
+
+	var src64 = image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	var _, ok = Scale(src64, 2, 2).(*image.NRGBA64)
+	assert.True(ok, "NRGBA64 stays NRGBA64", t)
+}
+
+func TestRotateAlpha(t *testing.T) {
+	var src = image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+	var dst, ok = Rotate(src, 45, color.Transparent).(*image.NRGBA)
+	assert.True(ok, "NRGBA stays NRGBA", t)
+	var b = dst.Bounds()
+	assert.Equal(uint8(0), dst.NRGBAAt(0, 0).A, "exposed corners are transparent", t)
+	assert.Equal(color.NRGBA{200, 200, 200, 200}, dst.NRGBAAt(b.Dx()/2, b.Dy()/2), "center keeps its color and alpha", t)
+
+	var r = &NRGBA64Rotator{Img: image.NewNRGBA64(image.Rect(0, 0, 3, 2))}
+	r.Rotate90()
+	assert.Equal(image.Rect(0, 0, 2, 3), r.Image().Bounds(), "right angle rotators handle NRGBA64", t)
+}
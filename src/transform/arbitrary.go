@@ -0,0 +1,271 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Rotate turns src clockwise by any number of degrees, returning a new image
+// sized to the bounding box of the rotated source.  Pixels are sampled with
+// bilinear interpolation, and any part of the output the source doesn't cover
+// is filled with bg, which is also blended into the source's edges so they
+// don't look jagged.
+//
+// Only the concrete image types RAIS decoders produce are supported (Gray,
+// Gray16, RGBA, RGBA64, NRGBA, and NRGBA64); anything else returns nil.
+// Grayscale sources are promoted to RGBA / RGBA64 when bg isn't fully opaque,
+// as they'd otherwise have no way to store the transparent corners.
+//
+// Right angles are supported, but the Rotator types are far faster for those.
+func Rotate(src image.Image, degrees float64, bg color.Color) image.Image {
+	var _, _, _, a = bg.RGBA()
+	var opaque = a == 0xffff
+
+	switch s := src.(type) {
+	case *image.Gray:
+		if !opaque {
+			return RotateRGBA(toRGBA(s), degrees, color.RGBAModel.Convert(bg).(color.RGBA))
+		}
+		return RotateGray(s, degrees, color.GrayModel.Convert(bg).(color.Gray))
+	case *image.Gray16:
+		if !opaque {
+			return RotateRGBA64(toRGBA64(s), degrees, color.RGBA64Model.Convert(bg).(color.RGBA64))
+		}
+		return RotateGray16(s, degrees, color.Gray16Model.Convert(bg).(color.Gray16))
+	case *image.RGBA:
+		return RotateRGBA(s, degrees, color.RGBAModel.Convert(bg).(color.RGBA))
+	case *image.RGBA64:
+		return RotateRGBA64(s, degrees, color.RGBA64Model.Convert(bg).(color.RGBA64))
+	case *image.NRGBA:
+		return unpremultiply(RotateRGBA64(premultiply(s), degrees, color.RGBA64Model.Convert(bg).(color.RGBA64)), false)
+	case *image.NRGBA64:
+		return unpremultiply(RotateRGBA64(premultiply(s), degrees, color.RGBA64Model.Convert(bg).(color.RGBA64)), true)
+	}
+	return nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	var b = src.Bounds()
+	var dst = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+func toRGBA64(src image.Image) *image.RGBA64 {
+	var b = src.Bounds()
+	var dst = image.NewRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// rotateGeometry holds everything needed to map a destination pixel back to
+// its source location for a given source size and rotation
+type rotateGeometry struct {
+	srcW, srcH   int
+	dstW, dstH   int
+	sin, cos     float64
+	srcCX, srcCY float64
+	dstCX, dstCY float64
+}
+
+// RotatedSize returns the canvas size Rotate produces for a w x h image
+// rotated by the given degrees
+func RotatedSize(w, h int, degrees float64) (int, int) {
+	var g = newRotateGeometry(image.Rect(0, 0, w, h), degrees)
+	return g.dstW, g.dstH
+}
+
+func newRotateGeometry(b image.Rectangle, degrees float64) rotateGeometry {
+	var g = rotateGeometry{srcW: b.Dx(), srcH: b.Dy()}
+	g.sin, g.cos = math.Sincos(degrees * math.Pi / 180)
+
+	// Snap right angles so they don't pick up floating-point noise, which
+	// would otherwise blur every pixel a tiny bit and can grow the canvas
+	switch math.Mod(degrees, 360) {
+	case 0:
+		g.sin, g.cos = 0, 1
+	case 90:
+		g.sin, g.cos = 1, 0
+	case 180:
+		g.sin, g.cos = 0, -1
+	case 270:
+		g.sin, g.cos = -1, 0
+	}
+
+	var w, h = float64(g.srcW), float64(g.srcH)
+	g.dstW = int(math.Ceil(math.Abs(w*g.cos) + math.Abs(h*g.sin) - 1e-6))
+	g.dstH = int(math.Ceil(math.Abs(w*g.sin) + math.Abs(h*g.cos) - 1e-6))
+	g.srcCX, g.srcCY = w/2, h/2
+	g.dstCX, g.dstCY = float64(g.dstW)/2, float64(g.dstH)/2
+	return g
+}
+
+// sample returns the top-left source pixel of the 2x2 block to interpolate
+// for the destination pixel (x, y), and the 16.16 fixed-point weights of the
+// right and bottom pixels.  The mapping is the inverse of a clockwise
+// rotation about the images' centers.
+func (g rotateGeometry) sample(x, y int) (x0, y0 int, fx, fy int64) {
+	var dx = float64(x) + 0.5 - g.dstCX
+	var dy = float64(y) + 0.5 - g.dstCY
+	var sx = dx*g.cos + dy*g.sin + g.srcCX - 0.5
+	var sy = -dx*g.sin + dy*g.cos + g.srcCY - 0.5
+	var fx0, fy0 = math.Floor(sx), math.Floor(sy)
+	return int(fx0), int(fy0), int64((sx - fx0) * 65536), int64((sy - fy0) * 65536)
+}
+
+// outside returns true if the 2x2 block at (x0, y0) doesn't touch the source
+func (g rotateGeometry) outside(x0, y0 int) bool {
+	return x0 < -1 || y0 < -1 || x0 >= g.srcW || y0 >= g.srcH
+}
+
+// taps returns the Pix offsets of the 2x2 block at (x0, y0) in top-left,
+// top-right, bottom-left, bottom-right order, using -1 for pixels which fall
+// outside the source
+func (g rotateGeometry) taps(x0, y0, base, stride, bpp int) [4]int {
+	var o [4]int
+	for i := range 4 {
+		var x, y = x0 + i&1, y0 + i>>1
+		if x < 0 || y < 0 || x >= g.srcW || y >= g.srcH {
+			o[i] = -1
+			continue
+		}
+		o[i] = base + y*stride + x*bpp
+	}
+	return o
+}
+
+// pick8 returns the 8-bit sample at offset o, or bg if o is outside the source
+func pick8(pix []uint8, o int, bg uint8) uint8 {
+	if o < 0 {
+		return bg
+	}
+	return pix[o]
+}
+
+// pick16 returns the 16-bit sample at offset o, or bg if o is outside the
+// source
+func pick16(pix []uint8, o int, bg uint16) uint16 {
+	if o < 0 {
+		return bg
+	}
+	return be16(pix, o)
+}
+
+// RotateGray rotates src clockwise by degrees, filling uncovered areas with bg
+func RotateGray(src *image.Gray, degrees float64, bg color.Gray) *image.Gray {
+	var g = newRotateGeometry(src.Bounds(), degrees)
+	var dst = image.NewGray(image.Rect(0, 0, g.dstW, g.dstH))
+	var base = src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y)
+
+	for y := 0; y < g.dstH; y++ {
+		var drow = dst.Pix[y*dst.Stride:]
+		for x := 0; x < g.dstW; x++ {
+			var x0, y0, fx, fy = g.sample(x, y)
+			if g.outside(x0, y0) {
+				drow[x] = bg.Y
+				continue
+			}
+			var o = g.taps(x0, y0, base, src.Stride, 1)
+			drow[x] = bilerp8(pick8(src.Pix, o[0], bg.Y), pick8(src.Pix, o[1], bg.Y),
+				pick8(src.Pix, o[2], bg.Y), pick8(src.Pix, o[3], bg.Y), fx, fy)
+		}
+	}
+
+	return dst
+}
+
+// RotateGray16 rotates src clockwise by degrees, filling uncovered areas with
+// bg
+func RotateGray16(src *image.Gray16, degrees float64, bg color.Gray16) *image.Gray16 {
+	var g = newRotateGeometry(src.Bounds(), degrees)
+	var dst = image.NewGray16(image.Rect(0, 0, g.dstW, g.dstH))
+	var base = src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y)
+
+	for y := 0; y < g.dstH; y++ {
+		var drow = dst.Pix[y*dst.Stride:]
+		for x := 0; x < g.dstW; x++ {
+			var x0, y0, fx, fy = g.sample(x, y)
+			if g.outside(x0, y0) {
+				putbe16(drow, x<<1, bg.Y)
+				continue
+			}
+			var o = g.taps(x0, y0, base, src.Stride, 2)
+			putbe16(drow, x<<1, bilerp16(pick16(src.Pix, o[0], bg.Y), pick16(src.Pix, o[1], bg.Y),
+				pick16(src.Pix, o[2], bg.Y), pick16(src.Pix, o[3], bg.Y), fx, fy))
+		}
+	}
+
+	return dst
+}
+
+// RotateRGBA rotates src clockwise by degrees, filling uncovered areas with
+// bg.  As with scaling, channels are interpolated independently, which is
+// correct for premultiplied alpha.
+func RotateRGBA(src *image.RGBA, degrees float64, bg color.RGBA) *image.RGBA {
+	var g = newRotateGeometry(src.Bounds(), degrees)
+	var dst = image.NewRGBA(image.Rect(0, 0, g.dstW, g.dstH))
+	var base = src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y)
+	var bgc = [4]uint8{bg.R, bg.G, bg.B, bg.A}
+
+	for y := 0; y < g.dstH; y++ {
+		var drow = dst.Pix[y*dst.Stride:]
+		for x := 0; x < g.dstW; x++ {
+			var d = x << 2
+			var x0, y0, fx, fy = g.sample(x, y)
+			if g.outside(x0, y0) {
+				copy(drow[d:d+4], bgc[:])
+				continue
+			}
+			var o = g.taps(x0, y0, base, src.Stride, 4)
+			for c := range 4 {
+				var b = bgc[c]
+				drow[d+c] = bilerp8(pick8(src.Pix, tap(o[0], c), b), pick8(src.Pix, tap(o[1], c), b),
+					pick8(src.Pix, tap(o[2], c), b), pick8(src.Pix, tap(o[3], c), b), fx, fy)
+			}
+		}
+	}
+
+	return dst
+}
+
+// RotateRGBA64 rotates src clockwise by degrees, filling uncovered areas with
+// bg.  As with scaling, channels are interpolated independently, which is
+// correct for premultiplied alpha.
+func RotateRGBA64(src *image.RGBA64, degrees float64, bg color.RGBA64) *image.RGBA64 {
+	var g = newRotateGeometry(src.Bounds(), degrees)
+	var dst = image.NewRGBA64(image.Rect(0, 0, g.dstW, g.dstH))
+	var base = src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y)
+	var bgc = [4]uint16{bg.R, bg.G, bg.B, bg.A}
+
+	for y := 0; y < g.dstH; y++ {
+		var drow = dst.Pix[y*dst.Stride:]
+		for x := 0; x < g.dstW; x++ {
+			var d = x << 3
+			var x0, y0, fx, fy = g.sample(x, y)
+			if g.outside(x0, y0) {
+				for c := range 4 {
+					putbe16(drow, d+c<<1, bgc[c])
+				}
+				continue
+			}
+			var o = g.taps(x0, y0, base, src.Stride, 8)
+			for c := range 4 {
+				var b, co = bgc[c], c << 1
+				putbe16(drow, d+co, bilerp16(pick16(src.Pix, tap(o[0], co), b), pick16(src.Pix, tap(o[1], co), b),
+					pick16(src.Pix, tap(o[2], co), b), pick16(src.Pix, tap(o[3], co), b), fx, fy))
+			}
+		}
+	}
+
+	return dst
+}
+
+// tap offsets o by a channel's byte offset, preserving -1 for outside pixels
+func tap(o, c int) int {
+	if o < 0 {
+		return o
+	}
+	return o + c
+}
@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+// sameImage avoids dumping huge pixel arrays when images don't match
+func sameImage(a, b image.Image) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func TestRotateRightAnglesMatchRotator(t *testing.T) {
+	for _, kind := range []string{"Gray", "Gray16", "RGBA", "RGBA64"} {
+		var src = randomImage(kind, image.Rect(0, 0, 7, 5))
+		var r Rotator
+		switch s := src.(type) {
+		case *image.Gray:
+			r = &GrayRotator{Img: s}
+		case *image.Gray16:
+			r = &Gray16Rotator{Img: s}
+		case *image.RGBA:
+			r = &RGBARotator{Img: s}
+		case *image.RGBA64:
+			r = &RGBA64Rotator{Img: s}
+		}
+		r.Rotate90()
+
+		var got = Rotate(src, 90, color.Black)
+		assert.True(sameImage(r.Image(), got), kind+" 90-degree rotation", t)
+		assert.True(sameImage(src, Rotate(src, 0, color.Black)), kind+" 0-degree rotation", t)
+	}
+}
+
+func TestRotateBounds(t *testing.T) {
+	var src = image.NewGray(image.Rect(0, 0, 100, 50))
+	var b = Rotate(src, 45, color.White).Bounds()
+
+	// 100*cos(45) + 50*sin(45) == 106.066...
+	assert.Equal(107, b.Dx(), "45-degree width", t)
+	assert.Equal(107, b.Dy(), "45-degree height", t)
+
+	b = Rotate(src, 30, color.White).Bounds()
+	assert.Equal(112, b.Dx(), "30-degree width", t)
+	assert.Equal(94, b.Dy(), "30-degree height", t)
+}
+
+func TestRotateFill(t *testing.T) {
+	var src = image.NewGray(image.Rect(0, 0, 40, 40))
+	for i := range src.Pix {
+		src.Pix[i] = 100
+	}
+
+	var opaque = Rotate(src, 45, color.Gray{Y: 255})
+	var gray, ok = opaque.(*image.Gray)
+	assert.True(ok, "opaque background keeps grayscale images gray", t)
+	assert.Equal(uint8(255), gray.GrayAt(0, 0).Y, "corner is filled", t)
+	var c = gray.Bounds().Dx() / 2
+	assert.Equal(uint8(100), gray.GrayAt(c, c).Y, "center is untouched", t)
+
+	var clear = Rotate(src, 45, color.Transparent)
+	rgba, ok := clear.(*image.RGBA)
+	assert.True(ok, "transparent background promotes gray to RGBA", t)
+	assert.Equal(color.RGBA{}, rgba.RGBAAt(0, 0), "corner is transparent", t)
+	assert.Equal(color.RGBA{100, 100, 100, 255}, rgba.RGBAAt(c, c), "center is opaque", t)
+
+	var src16 = image.NewGray16(image.Rect(0, 0, 40, 40))
+	_, ok = Rotate(src16, 45, color.Transparent).(*image.RGBA64)
+	assert.True(ok, "transparent background promotes gray16 to RGBA64", t)
+}
+
+func TestRotateSubImage(t *testing.T) {
+	var full = randomImage("RGBA", image.Rect(0, 0, 30, 30)).(*image.RGBA)
+	var sub = full.SubImage(image.Rect(5, 5, 25, 15)).(*image.RGBA)
+	var copied = toRGBA(sub)
+	assert.True(sameImage(Rotate(copied, 17.5, color.White), Rotate(sub, 17.5, color.White)), "subimages rotate like their copies", t)
+}
+
+func TestRotateUnsupportedType(t *testing.T) {
+	var src = image.NewCMYK(image.Rect(0, 0, 4, 3))
+	assert.True(Rotate(src, 45, color.White) == nil, "unsupported type returns nil", t)
+}
+
+func BenchmarkRotateRGBA(b *testing.B) {
+	var src = benchSetup("RGBA")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Rotate(src, 12.5, color.White)
+	}
+}
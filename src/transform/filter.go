@@ -0,0 +1,256 @@
+package transform
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Filter identifies a resampling filter for ScaleFilter
+type Filter int
+
+// Available filters.  Bilinear is the fastest, and the zero value, while
+// CatmullRom (bicubic) and Lanczos3 are slower but keep fine detail, such as
+// newspaper text, from aliasing when an image is shrunk.
+const (
+	Bilinear Filter = iota
+	CatmullRom
+	Lanczos3
+)
+
+var filterNames = map[Filter]string{
+	Bilinear:   "bilinear",
+	CatmullRom: "catmullrom",
+	Lanczos3:   "lanczos3",
+}
+
+// String returns the filter's name as ParseFilter accepts it
+func (f Filter) String() string {
+	var name, ok = filterNames[f]
+	if !ok {
+		return fmt.Sprintf("Filter(%d)", int(f))
+	}
+	return name
+}
+
+// ParseFilter returns the filter with the given name, ignoring case
+func ParseFilter(name string) (Filter, error) {
+	name = strings.ToLower(name)
+	for f, n := range filterNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return Bilinear, fmt.Errorf("unknown scale filter %q", name)
+}
+
+// kernel returns the filter's support radius (in source pixels at 1:1) and
+// its weight function
+func (f Filter) kernel() (float64, func(float64) float64) {
+	switch f {
+	case CatmullRom:
+		return 2, catmullRom
+	case Lanczos3:
+		return 3, lanczos3
+	}
+	return 0, nil
+}
+
+// catmullRom is the cubic convolution kernel with a = -0.5
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return (1.5*x-2.5)*x*x + 1
+	case x < 2:
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	}
+	return 0
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// lanczos3 is the windowed sinc kernel with three lobes
+func lanczos3(x float64) float64 {
+	if x <= -3 || x >= 3 {
+		return 0
+	}
+	return sinc(x) * sinc(x/3)
+}
+
+// weightBits is the fixed-point precision of filter weights
+const weightBits = 14
+
+// interBits is the number of fractional bits kept in the intermediate
+// (horizontally filtered) samples, so the two passes don't round twice
+const interBits = 8
+
+// filterTaps holds, for each destination index along one axis, the first
+// source index to sample and the fixed-point weights of the samples starting
+// there
+type filterTaps struct {
+	start   []int
+	weights [][]int32
+}
+
+// filterCoords precomputes the taps for resampling srcDim samples to dstDim.
+// Sample positions are center-aligned, as in bilinearCoords.  When shrinking,
+// the kernel is stretched to cover every source pixel contributing to a
+// destination pixel, which is what keeps downscaling from aliasing.  Taps
+// past the edges are folded into the edge pixels, and each pixel's weights
+// are adjusted to sum to exactly one so flat areas stay flat.
+func filterCoords(srcDim, dstDim int, f Filter) filterTaps {
+	var radius, k = f.kernel()
+	var scale = float64(srcDim) / float64(dstDim)
+	var stretch = math.Max(scale, 1)
+	var support = radius * stretch
+
+	var taps = filterTaps{start: make([]int, dstDim), weights: make([][]int32, dstDim)}
+	for x := 0; x < dstDim; x++ {
+		var center = (float64(x)+0.5)*scale - 0.5
+		var lo = int(math.Ceil(center - support))
+		var hi = int(math.Floor(center + support))
+		var first, last = max(lo, 0), min(hi, srcDim-1)
+
+		var fw = make([]float64, last-first+1)
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			var w = k((float64(j) - center) / stretch)
+			var idx = min(max(j, first), last) - first
+			fw[idx] += w
+			sum += w
+		}
+
+		var iw = make([]int32, len(fw))
+		var total int32
+		var peak int
+		for i, w := range fw {
+			iw[i] = int32(math.Round(w / sum * (1 << weightBits)))
+			total += iw[i]
+			if iw[i] > iw[peak] {
+				peak = i
+			}
+		}
+		iw[peak] += 1<<weightBits - total
+
+		taps.start[x], taps.weights[x] = first, iw
+	}
+
+	return taps
+}
+
+// ScaleFilter resizes src to dstW x dstH using the given filter.  Bilinear
+// is handled by Scale; the other filters support the same image types and
+// return nil for anything else.
+func ScaleFilter(src image.Image, dstW, dstH int, f Filter) image.Image {
+	if f == Bilinear {
+		return Scale(src, dstW, dstH)
+	}
+
+	var b = src.Bounds()
+	switch s := src.(type) {
+	case *image.Gray:
+		var dst = image.NewGray(image.Rect(0, 0, dstW, dstH))
+		convolve(s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, b.Dx(), b.Dy(), dst.Pix, dst.Stride, dstW, dstH, 1, false, f)
+		return dst
+	case *image.Gray16:
+		var dst = image.NewGray16(image.Rect(0, 0, dstW, dstH))
+		convolve(s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, b.Dx(), b.Dy(), dst.Pix, dst.Stride, dstW, dstH, 1, true, f)
+		return dst
+	case *image.RGBA:
+		var dst = image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+		convolve(s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, b.Dx(), b.Dy(), dst.Pix, dst.Stride, dstW, dstH, 4, false, f)
+		return dst
+	case *image.RGBA64:
+		var dst = image.NewRGBA64(image.Rect(0, 0, dstW, dstH))
+		convolve(s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, b.Dx(), b.Dy(), dst.Pix, dst.Stride, dstW, dstH, 4, true, f)
+		return dst
+	case *image.NRGBA:
+		return unpremultiply(ScaleFilter(premultiply(s), dstW, dstH, f).(*image.RGBA64), false)
+	case *image.NRGBA64:
+		return unpremultiply(ScaleFilter(premultiply(s), dstW, dstH, f).(*image.RGBA64), true)
+	}
+	return nil
+}
+
+// convolve resamples a buffer of srcW x srcH pixels with the given number of
+// channels (8-bit, or 16-bit big-endian if wide) into dst, filtering rows and
+// then columns.  Four-channel pixels are assumed to be premultiplied, so
+// color is clamped to alpha: the negative lobes of these filters can
+// otherwise produce colors brighter than the pixel's coverage allows.
+func convolve(src []uint8, srcStride, srcW, srcH int, dst []uint8, dstStride, dstW, dstH, channels int, wide bool, f Filter) {
+	var xt = filterCoords(srcW, dstW, f)
+	var yt = filterCoords(srcH, dstH, f)
+
+	var maxval int64 = 255
+	var bps = 1
+	if wide {
+		maxval, bps = 65535, 2
+	}
+
+	// Horizontal pass: every source row is filtered into an intermediate row
+	// of dstW pixels with interBits of extra precision
+	var iw = dstW * channels
+	var inter = make([]int32, srcH*iw)
+	Parallel(srcH, srcW, func(lo, hi int) {
+		var row = make([]int64, srcW*channels)
+		for y := lo; y < hi; y++ {
+			var sp = src[y*srcStride:]
+			for i := range row {
+				if wide {
+					row[i] = int64(be16(sp, i<<1))
+				} else {
+					row[i] = int64(sp[i])
+				}
+			}
+
+			var out = inter[y*iw : (y+1)*iw]
+			for x := 0; x < dstW; x++ {
+				var start, weights = xt.start[x] * channels, xt.weights[x]
+				for c := 0; c < channels; c++ {
+					var sum int64
+					for i, w := range weights {
+						sum += row[start+i*channels+c] * int64(w)
+					}
+					out[x*channels+c] = int32((sum + 1<<(weightBits-interBits-1)) >> (weightBits - interBits))
+				}
+			}
+		}
+	})
+
+	// Vertical pass: each destination row combines intermediate rows
+	const shift = weightBits + interBits
+	Parallel(dstH, dstW, func(lo, hi int) {
+		var px = make([]int64, channels)
+		for y := lo; y < hi; y++ {
+			var start, weights = yt.start[y], yt.weights[y]
+			var drow = dst[y*dstStride:]
+			for x := 0; x < iw; x += channels {
+				for c := 0; c < channels; c++ {
+					var sum int64
+					for i, w := range weights {
+						sum += int64(inter[(start+i)*iw+x+c]) * int64(w)
+					}
+					px[c] = min(max((sum+1<<(shift-1))>>shift, 0), maxval)
+				}
+				if channels == 4 {
+					px[0], px[1], px[2] = min(px[0], px[3]), min(px[1], px[3]), min(px[2], px[3])
+				}
+				for c, v := range px {
+					if wide {
+						putbe16(drow, (x+c)*bps, uint16(v))
+					} else {
+						drow[x+c] = uint8(v)
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package transform
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+var filters = []Filter{CatmullRom, Lanczos3}
+
+func TestParseFilter(t *testing.T) {
+	for _, f := range []Filter{Bilinear, CatmullRom, Lanczos3} {
+		var got, err = ParseFilter(f.String())
+		assert.NilError(err, "parsing "+f.String(), t)
+		assert.Equal(f, got, "round trip", t)
+	}
+	var got, err = ParseFilter("Lanczos3")
+	assert.NilError(err, "names are case-insensitive", t)
+	assert.Equal(Lanczos3, got, "mixed-case name", t)
+
+	_, err = ParseFilter("nearest")
+	assert.True(err != nil, "unknown names are an error", t)
+}
+
+// TestScaleFilterIdentity verifies that scaling to the same size returns the
+// source pixels exactly: both kernels are zero at every nonzero integer
+func TestScaleFilterIdentity(t *testing.T) {
+	for _, f := range filters {
+		for _, kind := range []string{"Gray", "Gray16", "RGBA64"} {
+			var src = randomImage(kind, image.Rect(0, 0, 21, 13))
+			// Random color data is only valid premultiplied RGBA when it's opaque
+			if rgba, ok := src.(*image.RGBA64); ok {
+				for n := 6; n < len(rgba.Pix); n += 8 {
+					rgba.Pix[n], rgba.Pix[n+1] = 0xFF, 0xFF
+				}
+			}
+			var dst = ScaleFilter(src, 21, 13, f)
+			for y := 0; y < 13; y++ {
+				for x := 0; x < 21; x++ {
+					if src.At(x, y) != dst.At(x, y) {
+						t.Fatalf("%s %s: pixel (%d, %d) changed from %v to %v", f, kind, x, y, src.At(x, y), dst.At(x, y))
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestScaleFilterConstant verifies solid colors stay exactly solid when
+// shrinking and enlarging, including across the edges
+func TestScaleFilterConstant(t *testing.T) {
+	var c = color.RGBA64{0xBEEF, 0x1234, 0x8000, 0xFFFF}
+	var src = image.NewRGBA64(image.Rect(0, 0, 50, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 50; x++ {
+			src.SetRGBA64(x, y, c)
+		}
+	}
+	for _, f := range filters {
+		for _, size := range []image.Point{{33, 21}, {117, 64}, {1, 1}} {
+			var dst = ScaleFilter(src, size.X, size.Y, f).(*image.RGBA64)
+			for y := 0; y < size.Y; y++ {
+				for x := 0; x < size.X; x++ {
+					if dst.RGBA64At(x, y) != c {
+						t.Fatalf("%s to %v: pixel (%d, %d) is %v", f, size, x, y, dst.RGBA64At(x, y))
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestScaleFilterAntialias verifies that shrinking fine detail by a
+// non-integer factor averages it away instead of aliasing, which bilinear
+// can't do once the scale drops below one half
+func TestScaleFilterAntialias(t *testing.T) {
+	var src = image.NewGray(image.Rect(0, 0, 300, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 300; x++ {
+			if x%2 == 0 {
+				src.Pix[y*src.Stride+x] = 255
+			}
+		}
+	}
+	for _, f := range filters {
+		var dst = ScaleFilter(src, 70, 2, f).(*image.Gray)
+		for x := 2; x < 68; x++ {
+			var p = int(dst.Pix[x])
+			if p < 118 || p > 138 {
+				t.Fatalf("%s: stripes should average to mid-gray, got %d at x=%d", f, p, x)
+			}
+		}
+	}
+}
+
+// TestScaleFilterPremultiplied verifies ringing never leaves a color channel
+// above alpha
+func TestScaleFilterPremultiplied(t *testing.T) {
+	var src = image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if x < 8 {
+				src.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				src.SetRGBA(x, y, color.RGBA{0, 0, 0, 40})
+			}
+		}
+	}
+	for _, f := range filters {
+		var dst = ScaleFilter(src, 37, 37, f).(*image.RGBA)
+		for n := 0; n < len(dst.Pix); n += 4 {
+			var a = dst.Pix[n+3]
+			if dst.Pix[n] > a || dst.Pix[n+1] > a || dst.Pix[n+2] > a {
+				t.Fatalf("%s: pixel %d has color above alpha: %v", f, n/4, dst.Pix[n:n+4])
+			}
+		}
+	}
+}
+
+func TestScaleFilterSubImage(t *testing.T) {
+	var full = randomImage("RGBA", image.Rect(0, 0, 64, 64)).(*image.RGBA)
+	var sub = full.SubImage(image.Rect(16, 8, 48, 40)).(*image.RGBA)
+	var copied = image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		copy(copied.Pix[y*copied.Stride:], sub.Pix[y*sub.Stride:y*sub.Stride+128])
+	}
+	for _, f := range filters {
+		var a, b = ScaleFilter(sub, 20, 20, f).(*image.RGBA), ScaleFilter(copied, 20, 20, f).(*image.RGBA)
+		assert.Equal(string(b.Pix), string(a.Pix), fmt.Sprintf("%s sub-image is read from its bounds", f), t)
+	}
+}
+
+func TestScaleFilterUnsupportedType(t *testing.T) {
+	var dst = ScaleFilter(image.NewCMYK(image.Rect(0, 0, 8, 8)), 4, 4, Lanczos3)
+	if dst != nil {
+		t.Fatalf("expected nil for unsupported image type, got %T", dst)
+	}
+}
+
+func BenchmarkScaleLanczos3RGBA(b *testing.B) {
+	var src = benchSetup("RGBA")
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ScaleFilter(src, 1024, 1024, Lanczos3)
+	}
+}
@@ -115,6 +115,22 @@ type imageType struct {
 	ByteSize:          8,
 }
 
+var typeNRGBA = imageType{
+	String:            "*image.NRGBA",
+	Shortstring:       "NRGBA",
+	ConstructorMethod: "image.NewNRGBA",
+	CopyStatement:     "copy(dstPix[dstIdx:dstIdx+4], srcPix[srcIdx:srcIdx+4])",
+	ByteSize:          4,
+}
+
+var typeNRGBA64 = imageType{
+	String:            "*image.NRGBA64",
+	Shortstring:       "NRGBA64",
+	ConstructorMethod: "image.NewNRGBA64",
+	CopyStatement:     "copy(dstPix[dstIdx:dstIdx+8], srcPix[srcIdx:srcIdx+8])",
+	ByteSize:          8,
+}
+
 type page struct {
 	Rotations []rotation
 	Types     []imageType
@@ -129,7 +145,7 @@ func main() {
 
 	p := page{
 		Rotations: []rotation{rotate90, rotate180, rotate270, rotateMirror},
-		Types:     []imageType{typeGray, typeRGBA, typeGray16, typeRGBA64},
+		Types:     []imageType{typeGray, typeRGBA, typeGray16, typeRGBA64, typeNRGBA, typeNRGBA64},
 	}
 
 	err = t.Execute(f, p)
@@ -0,0 +1,62 @@
+package transform
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minBandPixels is the smallest amount of work worth handing to another
+// goroutine; anything smaller (e.g., a typical tile) is processed serially
+const minBandPixels = 1 << 16
+
+// workers holds one token per helper goroutine allowed to run at once.  It's
+// shared by every request in the process, so large images being processed at
+// the same time can't oversubscribe the CPU.
+var workers = make(chan struct{}, runtime.NumCPU())
+
+// SetMaxWorkers sets the process-wide number of helper goroutines Parallel
+// may use.  Zero disables parallel processing.  This must be called before
+// any images are processed, as it replaces the worker pool.
+func SetMaxWorkers(n int) {
+	workers = make(chan struct{}, max(n, 0))
+}
+
+// MaxWorkers returns the process-wide helper goroutine limit
+func MaxWorkers() int {
+	return cap(workers)
+}
+
+// Parallel splits rows into bands and calls fn(lo, hi) for each band, with
+// rows lo through hi-1, returning once all bands are done.  width is the
+// number of pixels per row, used to avoid splitting small jobs.  The calling
+// goroutine always processes one band itself; the others go to helper
+// goroutines when a worker is free, or are processed by the caller when none
+// are, so the results never depend on how much parallelism was available.
+// fn must only write to its own band's output.
+func Parallel(rows, width int, fn func(lo, hi int)) {
+	var bands = min(cap(workers)+1, rows*width/minBandPixels, rows)
+	if bands <= 1 {
+		fn(0, rows)
+		return
+	}
+
+	var sem = workers
+	var wg sync.WaitGroup
+	var size = (rows + bands - 1) / bands
+	for lo := size; lo < rows; lo += size {
+		var hi = min(lo+size, rows)
+		select {
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fn(lo, hi)
+				<-sem
+			}()
+		default:
+			fn(lo, hi)
+		}
+	}
+	fn(0, min(size, rows))
+	wg.Wait()
+}
@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"fmt"
+	"image"
+	"sync/atomic"
+	"testing"
+
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+// withWorkers runs fn with the worker limit set to n, restoring the original
+// limit afterward
+func withWorkers(n int, fn func()) {
+	var orig = MaxWorkers()
+	SetMaxWorkers(n)
+	defer SetMaxWorkers(orig)
+	fn()
+}
+
+func TestParallelCoversEveryRow(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 16} {
+		for _, rows := range []int{1, 7, 100, 1001} {
+			withWorkers(n, func() {
+				var seen = make([]int32, rows)
+				Parallel(rows, minBandPixels, func(lo, hi int) {
+					for y := lo; y < hi; y++ {
+						atomic.AddInt32(&seen[y], 1)
+					}
+				})
+				for y, count := range seen {
+					if count != 1 {
+						t.Fatalf("%d workers, %d rows: row %d processed %d times", n, rows, y, count)
+					}
+				}
+			})
+		}
+	}
+}
+
+// pix returns the pixel data for any image type Scale supports
+func pix(i image.Image) []uint8 {
+	switch i := i.(type) {
+	case *image.Gray:
+		return i.Pix
+	case *image.Gray16:
+		return i.Pix
+	case *image.RGBA:
+		return i.Pix
+	case *image.RGBA64:
+		return i.Pix
+	}
+	return nil
+}
+
+// TestParallelIdenticalOutput verifies the parallel scalers produce exactly
+// what the serial path does
+func TestParallelIdenticalOutput(t *testing.T) {
+	for _, kind := range []string{"Gray", "Gray16", "RGBA", "RGBA64"} {
+		var src = randomImage(kind, image.Rect(0, 0, 700, 500))
+		for _, f := range []Filter{Bilinear, CatmullRom, Lanczos3} {
+			var serial, parallel image.Image
+			withWorkers(0, func() { serial = ScaleFilter(src, 333, 411, f) })
+			withWorkers(7, func() { parallel = ScaleFilter(src, 333, 411, f) })
+			assert.Equal(string(pix(serial)), string(pix(parallel)), fmt.Sprintf("%s %s output", kind, f), t)
+		}
+	}
+}
@@ -459,4 +459,224 @@ func (r *RGBA64Rotator) Mirror() {
 	r.Img = dst
 }
 
+// NRGBARotator decorates *image.NRGBA with rotation functions
+type NRGBARotator struct {
+	Img *image.NRGBA
+}
+
+// Image returns the underlying image as an image.Image value
+func (r *NRGBARotator) Image() image.Image {
+	return r.Img
+}
+
+// Rotate90 does a simple 90-degree clockwise rotation
+func (r *NRGBARotator) Rotate90() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, srcHeight, srcWidth))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 2)
+			dstIdx = x*dstStride + ((maxY - 1 - y) << 2)
+			copy(dstPix[dstIdx:dstIdx+4], srcPix[srcIdx:srcIdx+4])
+		}
+	}
+
+	r.Img = dst
+}
+
+// Rotate180 does a simple 180-degree clockwise rotation
+func (r *NRGBARotator) Rotate180() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 2)
+			dstIdx = (maxY-1-y)*dstStride + ((maxX - 1 - x) << 2)
+			copy(dstPix[dstIdx:dstIdx+4], srcPix[srcIdx:srcIdx+4])
+		}
+	}
+
+	r.Img = dst
+}
+
+// Rotate270 does a simple 270-degree clockwise rotation
+func (r *NRGBARotator) Rotate270() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, srcHeight, srcWidth))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 2)
+			dstIdx = (maxX-1-x)*dstStride + (y << 2)
+			copy(dstPix[dstIdx:dstIdx+4], srcPix[srcIdx:srcIdx+4])
+		}
+	}
+
+	r.Img = dst
+}
+
+// Mirror flips the image around its vertical axis
+func (r *NRGBARotator) Mirror() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 2)
+			dstIdx = y*dstStride + ((maxX - 1 - x) << 2)
+			copy(dstPix[dstIdx:dstIdx+4], srcPix[srcIdx:srcIdx+4])
+		}
+	}
+
+	r.Img = dst
+}
+
+// NRGBA64Rotator decorates *image.NRGBA64 with rotation functions
+type NRGBA64Rotator struct {
+	Img *image.NRGBA64
+}
+
+// Image returns the underlying image as an image.Image value
+func (r *NRGBA64Rotator) Image() image.Image {
+	return r.Img
+}
+
+// Rotate90 does a simple 90-degree clockwise rotation
+func (r *NRGBA64Rotator) Rotate90() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA64(image.Rect(0, 0, srcHeight, srcWidth))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 3)
+			dstIdx = x*dstStride + ((maxY - 1 - y) << 3)
+			copy(dstPix[dstIdx:dstIdx+8], srcPix[srcIdx:srcIdx+8])
+		}
+	}
+
+	r.Img = dst
+}
+
+// Rotate180 does a simple 180-degree clockwise rotation
+func (r *NRGBA64Rotator) Rotate180() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA64(image.Rect(0, 0, srcWidth, srcHeight))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 3)
+			dstIdx = (maxY-1-y)*dstStride + ((maxX - 1 - x) << 3)
+			copy(dstPix[dstIdx:dstIdx+8], srcPix[srcIdx:srcIdx+8])
+		}
+	}
+
+	r.Img = dst
+}
+
+// Rotate270 does a simple 270-degree clockwise rotation
+func (r *NRGBA64Rotator) Rotate270() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA64(image.Rect(0, 0, srcHeight, srcWidth))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 3)
+			dstIdx = (maxX-1-x)*dstStride + (y << 3)
+			copy(dstPix[dstIdx:dstIdx+8], srcPix[srcIdx:srcIdx+8])
+		}
+	}
+
+	r.Img = dst
+}
+
+// Mirror flips the image around its vertical axis
+func (r *NRGBA64Rotator) Mirror() {
+	src := r.Img
+	srcB := src.Bounds()
+	srcWidth := srcB.Dx()
+	srcHeight := srcB.Dy()
+
+	dst := image.NewNRGBA64(image.Rect(0, 0, srcWidth, srcHeight))
+
+	var x, y, srcIdx, dstIdx int64
+	maxX, maxY := int64(srcWidth), int64(srcHeight)
+	srcStride, dstStride := int64(src.Stride), int64(dst.Stride)
+	srcPix := src.Pix
+	dstPix := dst.Pix
+	for y = 0; y < maxY; y++ {
+		for x = 0; x < maxX; x++ {
+			srcIdx = y*srcStride + (x << 3)
+			dstIdx = y*dstStride + ((maxX - 1 - x) << 3)
+			copy(dstPix[dstIdx:dstIdx+8], srcPix[srcIdx:srcIdx+8])
+		}
+	}
+
+	r.Img = dst
+}
+
 // GENERATED CODE; DO NOT EDIT!
@@ -5,8 +5,9 @@
 )
 
 // Scale resizes src to dstW x dstH using bilinear interpolation, returning
-// the scaled image.  Only the four concrete image types RAIS decoders produce
-// are supported (Gray, Gray16, RGBA, and RGBA64); anything else returns nil.
+// the scaled image.  Only the concrete image types RAIS decoders produce are
+// supported (Gray, Gray16, RGBA, RGBA64, NRGBA, and NRGBA64); anything else
+// returns nil.  ScaleFilter offers slower, higher-quality filters.
 //
 // These hand-rolled scalers exist because golang.org/x/image/draw only has
 // fast paths for *image.RGBA destinations: scaling grayscale or 16-bit images
@@ -22,6 +23,10 @@ func Scale(src image.Image, dstW, dstH int) image.Image {
 		return ScaleRGBA(s, dstW, dstH)
 	case *image.RGBA64:
 		return ScaleRGBA64(s, dstW, dstH)
+	case *image.NRGBA:
+		return unpremultiply(ScaleRGBA64(premultiply(s), dstW, dstH), false)
+	case *image.NRGBA64:
+		return unpremultiply(ScaleRGBA64(premultiply(s), dstW, dstH), true)
 	}
 	return nil
 }
@@ -84,16 +89,18 @@ func ScaleGray(src *image.Gray, dstW, dstH int) *image.Gray {
 	var y0s, y1s, yfs = bilinearCoords(b.Dy(), dstH)
 	var base = src.PixOffset(b.Min.X, b.Min.Y)
 
-	for y := 0; y < dstH; y++ {
-		var row0 = src.Pix[base+y0s[y]*src.Stride:]
-		var row1 = src.Pix[base+y1s[y]*src.Stride:]
-		var fy = int64(yfs[y])
-		var drow = dst.Pix[y*dst.Stride : y*dst.Stride+dstW]
-		for x := 0; x < dstW; x++ {
-			var x0, x1, fx = x0s[x], x1s[x], int64(xfs[x])
-			drow[x] = bilerp8(row0[x0], row0[x1], row1[x0], row1[x1], fx, fy)
+	Parallel(dstH, dstW, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row0 = src.Pix[base+y0s[y]*src.Stride:]
+			var row1 = src.Pix[base+y1s[y]*src.Stride:]
+			var fy = int64(yfs[y])
+			var drow = dst.Pix[y*dst.Stride : y*dst.Stride+dstW]
+			for x := 0; x < dstW; x++ {
+				var x0, x1, fx = x0s[x], x1s[x], int64(xfs[x])
+				drow[x] = bilerp8(row0[x0], row0[x1], row1[x0], row1[x1], fx, fy)
+			}
 		}
-	}
+	})
 
 	return dst
 }
@@ -106,16 +113,18 @@ func ScaleGray16(src *image.Gray16, dstW, dstH int) *image.Gray16 {
 	var y0s, y1s, yfs = bilinearCoords(b.Dy(), dstH)
 	var base = src.PixOffset(b.Min.X, b.Min.Y)
 
-	for y := 0; y < dstH; y++ {
-		var row0 = src.Pix[base+y0s[y]*src.Stride:]
-		var row1 = src.Pix[base+y1s[y]*src.Stride:]
-		var fy = int64(yfs[y])
-		var drow = dst.Pix[y*dst.Stride:]
-		for x := 0; x < dstW; x++ {
-			var s0, s1, fx = x0s[x] << 1, x1s[x] << 1, int64(xfs[x])
-			putbe16(drow, x<<1, bilerp16(be16(row0, s0), be16(row0, s1), be16(row1, s0), be16(row1, s1), fx, fy))
+	Parallel(dstH, dstW, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row0 = src.Pix[base+y0s[y]*src.Stride:]
+			var row1 = src.Pix[base+y1s[y]*src.Stride:]
+			var fy = int64(yfs[y])
+			var drow = dst.Pix[y*dst.Stride:]
+			for x := 0; x < dstW; x++ {
+				var s0, s1, fx = x0s[x] << 1, x1s[x] << 1, int64(xfs[x])
+				putbe16(drow, x<<1, bilerp16(be16(row0, s0), be16(row0, s1), be16(row1, s0), be16(row1, s1), fx, fy))
+			}
 		}
-	}
+	})
 
 	return dst
 }
@@ -130,20 +139,22 @@ func ScaleRGBA(src *image.RGBA, dstW, dstH int) *image.RGBA {
 	var y0s, y1s, yfs = bilinearCoords(b.Dy(), dstH)
 	var base = src.PixOffset(b.Min.X, b.Min.Y)
 
-	for y := 0; y < dstH; y++ {
-		var row0 = src.Pix[base+y0s[y]*src.Stride:]
-		var row1 = src.Pix[base+y1s[y]*src.Stride:]
-		var fy = int64(yfs[y])
-		var drow = dst.Pix[y*dst.Stride:]
-		for x := 0; x < dstW; x++ {
-			var s0, s1, fx = x0s[x] << 2, x1s[x] << 2, int64(xfs[x])
-			var o = x << 2
-			drow[o] = bilerp8(row0[s0], row0[s1], row1[s0], row1[s1], fx, fy)
-			drow[o+1] = bilerp8(row0[s0+1], row0[s1+1], row1[s0+1], row1[s1+1], fx, fy)
-			drow[o+2] = bilerp8(row0[s0+2], row0[s1+2], row1[s0+2], row1[s1+2], fx, fy)
-			drow[o+3] = bilerp8(row0[s0+3], row0[s1+3], row1[s0+3], row1[s1+3], fx, fy)
+	Parallel(dstH, dstW, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row0 = src.Pix[base+y0s[y]*src.Stride:]
+			var row1 = src.Pix[base+y1s[y]*src.Stride:]
+			var fy = int64(yfs[y])
+			var drow = dst.Pix[y*dst.Stride:]
+			for x := 0; x < dstW; x++ {
+				var s0, s1, fx = x0s[x] << 2, x1s[x] << 2, int64(xfs[x])
+				var o = x << 2
+				drow[o] = bilerp8(row0[s0], row0[s1], row1[s0], row1[s1], fx, fy)
+				drow[o+1] = bilerp8(row0[s0+1], row0[s1+1], row1[s0+1], row1[s1+1], fx, fy)
+				drow[o+2] = bilerp8(row0[s0+2], row0[s1+2], row1[s0+2], row1[s1+2], fx, fy)
+				drow[o+3] = bilerp8(row0[s0+3], row0[s1+3], row1[s0+3], row1[s1+3], fx, fy)
+			}
 		}
-	}
+	})
 
 	return dst
 }
@@ -158,19 +169,21 @@ func ScaleRGBA64(src *image.RGBA64, dstW, dstH int) *image.RGBA64 {
 	var y0s, y1s, yfs = bilinearCoords(b.Dy(), dstH)
 	var base = src.PixOffset(b.Min.X, b.Min.Y)
 
-	for y := 0; y < dstH; y++ {
-		var row0 = src.Pix[base+y0s[y]*src.Stride:]
-		var row1 = src.Pix[base+y1s[y]*src.Stride:]
-		var fy = int64(yfs[y])
-		var drow = dst.Pix[y*dst.Stride:]
-		for x := 0; x < dstW; x++ {
-			var s0, s1, fx = x0s[x] << 3, x1s[x] << 3, int64(xfs[x])
-			var o = x << 3
-			for c := 0; c < 8; c += 2 {
-				putbe16(drow, o+c, bilerp16(be16(row0, s0+c), be16(row0, s1+c), be16(row1, s0+c), be16(row1, s1+c), fx, fy))
+	Parallel(dstH, dstW, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			var row0 = src.Pix[base+y0s[y]*src.Stride:]
+			var row1 = src.Pix[base+y1s[y]*src.Stride:]
+			var fy = int64(yfs[y])
+			var drow = dst.Pix[y*dst.Stride:]
+			for x := 0; x < dstW; x++ {
+				var s0, s1, fx = x0s[x] << 3, x1s[x] << 3, int64(xfs[x])
+				var o = x << 3
+				for c := 0; c < 8; c += 2 {
+					putbe16(drow, o+c, bilerp16(be16(row0, s0+c), be16(row0, s1+c), be16(row1, s0+c), be16(row1, s1+c), fx, fy))
+				}
 			}
 		}
-	}
+	})
 
 	return dst
 }
@@ -179,7 +179,7 @@ func TestScaleCheckerboard(t *testing.T) {
 }
 
 func TestScaleUnsupportedType(t *testing.T) {
-	var dst = Scale(image.NewNRGBA(image.Rect(0, 0, 8, 8)), 4, 4)
+	var dst = Scale(image.NewCMYK(image.Rect(0, 0, 8, 8)), 4, 4)
 	if dst != nil {
 		t.Fatalf("expected nil for unsupported image type, got %T", dst)
 	}
@@ -0,0 +1,124 @@
+// Package webp wraps libwebp's simple encoding API so RAIS can serve WebP
+// images.  Decoding isn't needed: RAIS only ever writes WebP.
+package webp
+
+// #cgo pkg-config: libwebp
+// #include <webp/encode.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"unsafe"
+)
+
+// MaxDimension is the largest width or height a WebP image can have
+const MaxDimension = C.WEBP_MAX_DIMENSION
+
+// ErrEncodeFailed is returned when libwebp doesn't give us any data back,
+// which is the only failure signal the simple encoding API offers
+var ErrEncodeFailed = errors.New("webp: libwebp was unable to encode the image")
+
+// Options are the encoding parameters.  Quality ranges from 0 to 100 and is
+// ignored when Lossless is true.
+type Options struct {
+	Lossless bool
+	Quality  float32
+}
+
+// DefaultQuality is the lossy quality used when Options are nil
+const DefaultQuality = 75
+
+// Encode writes m to w in WebP format with the given options.  Images which
+// aren't fully opaque keep their alpha channel; everything else is encoded as
+// plain RGB.
+func Encode(w io.Writer, m image.Image, o *Options) error {
+	var b = m.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > MaxDimension || b.Dy() > MaxDimension {
+		return fmt.Errorf("webp: invalid image size %dx%d", b.Dx(), b.Dy())
+	}
+
+	var opts = Options{Quality: DefaultQuality}
+	if o != nil {
+		opts = *o
+	}
+
+	var pix, stride, alpha = rawPixels(m)
+	var in = (*C.uint8_t)(unsafe.Pointer(&pix[0]))
+	var width, height, cstride = C.int(b.Dx()), C.int(b.Dy()), C.int(stride)
+	var q = C.float(opts.Quality)
+	var out *C.uint8_t
+	var size C.size_t
+
+	switch {
+	case opts.Lossless && alpha:
+		size = C.WebPEncodeLosslessRGBA(in, width, height, cstride, &out)
+	case opts.Lossless:
+		size = C.WebPEncodeLosslessRGB(in, width, height, cstride, &out)
+	case alpha:
+		size = C.WebPEncodeRGBA(in, width, height, cstride, q, &out)
+	default:
+		size = C.WebPEncodeRGB(in, width, height, cstride, q, &out)
+	}
+
+	if size == 0 || out == nil {
+		return ErrEncodeFailed
+	}
+	defer C.WebPFree(unsafe.Pointer(out))
+
+	var _, err = w.Write(C.GoBytes(unsafe.Pointer(out), C.int(size)))
+	return err
+}
+
+// opaque is implemented by all the stdlib image types, and lets us avoid
+// scanning pixels to figure out if an alpha channel is needed
+type opaque interface {
+	Opaque() bool
+}
+
+// rawPixels converts m to the packed 8-bit RGB or (non-premultiplied) RGBA
+// buffer libwebp wants, returning the buffer, its stride, and whether it
+// includes alpha
+func rawPixels(m image.Image) (pix []uint8, stride int, alpha bool) {
+	var b = m.Bounds()
+	if o, ok := m.(opaque); !ok || !o.Opaque() {
+		var dst = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(dst, dst.Rect, m, b.Min, draw.Src)
+		return dst.Pix, dst.Stride, true
+	}
+
+	var w, h = b.Dx(), b.Dy()
+	stride = w * 3
+	pix = make([]uint8, stride*h)
+	switch src := m.(type) {
+	case *image.Gray:
+		for y := 0; y < h; y++ {
+			var row = src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+			var drow = pix[y*stride:]
+			for x := 0; x < w; x++ {
+				drow[x*3], drow[x*3+1], drow[x*3+2] = row[x], row[x], row[x]
+			}
+		}
+	case *image.RGBA:
+		for y := 0; y < h; y++ {
+			var row = src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+			var drow = pix[y*stride:]
+			for x := 0; x < w; x++ {
+				copy(drow[x*3:x*3+3], row[x*4:x*4+3])
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			var drow = pix[y*stride:]
+			for x := 0; x < w; x++ {
+				var r, g, bl, _ = m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				drow[x*3], drow[x*3+1], drow[x*3+2] = uint8(r>>8), uint8(g>>8), uint8(bl>>8)
+			}
+		}
+	}
+
+	return pix, stride, false
+}
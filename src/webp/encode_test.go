@@ -0,0 +1,74 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/uoregon-libraries/gopkg/assert"
+)
+
+func TestRawPixelsGray(t *testing.T) {
+	var src = image.NewGray(image.Rect(0, 0, 2, 2))
+	src.Pix = []uint8{1, 2, 3, 4}
+	var pix, stride, alpha = rawPixels(src)
+	assert.False(alpha, "gray images have no alpha", t)
+	assert.Equal(6, stride, "RGB stride", t)
+	if diff := cmp.Diff([]uint8{1, 1, 1, 2, 2, 2, 3, 3, 3, 4, 4, 4}, pix); diff != "" {
+		t.Errorf("gray expanded to RGB: %s", diff)
+	}
+}
+
+func TestRawPixelsRGBASubImage(t *testing.T) {
+	var full = image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range full.Pix {
+		full.Pix[i] = 255
+	}
+	full.SetRGBA(2, 2, color.RGBA{10, 20, 30, 255})
+	var sub = full.SubImage(image.Rect(2, 2, 4, 3))
+
+	var pix, stride, alpha = rawPixels(sub)
+	assert.False(alpha, "opaque RGBA has no alpha", t)
+	assert.Equal(6, stride, "RGB stride", t)
+	if diff := cmp.Diff([]uint8{10, 20, 30, 255, 255, 255}, pix); diff != "" {
+		t.Errorf("subimage pixels: %s", diff)
+	}
+}
+
+func TestRawPixelsAlpha(t *testing.T) {
+	var src = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	src.SetRGBA(0, 0, color.RGBA{50, 0, 0, 128})
+	var pix, stride, alpha = rawPixels(src)
+	assert.True(alpha, "translucent images keep alpha", t)
+	assert.Equal(4, stride, "RGBA stride", t)
+	if diff := cmp.Diff([]uint8{99, 0, 0, 128}, pix); diff != "" {
+		t.Errorf("alpha is un-premultiplied: %s", diff)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var src = image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255
+	}
+
+	for _, opts := range []*Options{nil, {Quality: 90}, {Lossless: true}} {
+		var buf bytes.Buffer
+		var err = Encode(&buf, src, opts)
+		assert.NilError(err, "encoding should work", t)
+		var data = buf.Bytes()
+		assert.True(len(data) > 12, "output has a header", t)
+		assert.Equal("RIFF", string(data[0:4]), "RIFF container", t)
+		assert.Equal("WEBP", string(data[8:12]), "WebP data", t)
+	}
+}
+
+func TestEncodeInvalidSize(t *testing.T) {
+	var err = Encode(&bytes.Buffer{}, image.NewGray(image.Rect(0, 0, 0, 10)), nil)
+	assert.True(err != nil, "empty images can't be encoded", t)
+}